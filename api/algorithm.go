@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+)
+
+type KeyGenAlgorithmResponse struct {
+	Name       domain.KeyGenAlgorithm `json:"name"`
+	Family     string                 `json:"family"`
+	KeySize    int                    `json:"key_size"`
+	Curve      string                 `json:"curve,omitempty"`
+	Deprecated bool                   `json:"deprecated,omitempty"`
+}
+
+type KeyGenAlgorithmListResponse struct {
+	Algorithms []KeyGenAlgorithmResponse `json:"algorithms"`
+}
+
+type KeyGenAlgorithmsResponse struct {
+	Data KeyGenAlgorithmListResponse `json:"data"`
+}
+
+// HandleKeyGenAlgorithmsRetrieval lists the key generation algorithms signature devices
+// can be created with, as accepted by the key_type creation parameter.
+func (s *Server) HandleKeyGenAlgorithmsRetrieval(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	algorithms := []KeyGenAlgorithmResponse{}
+	for _, algorithm := range domain.KeyGenAlgorithms() {
+		parameters, err := algorithm.Parameters()
+		if err != nil {
+			WriteError(response, err)
+			return
+		}
+		algorithmResponse := KeyGenAlgorithmResponse{Name: algorithm, Family: string(parameters.Family), KeySize: parameters.KeySize, Deprecated: parameters.Deprecated}
+		if parameters.Curve != nil {
+			algorithmResponse.Curve = parameters.Curve.Params().Name
+		}
+		algorithms = append(algorithms, algorithmResponse)
+	}
+	WriteAPIResponse(response, http.StatusOK, KeyGenAlgorithmListResponse{Algorithms: algorithms})
+}
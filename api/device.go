@@ -1,26 +1,101 @@
 package api
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/PaoloModica/signing-service-challenge-go/domain"
 )
 
+const (
+	DefaultDevicesPageSize = 100
+	MaxDevicesPageSize     = 1000
+)
+
 type SignatureDeviceParams struct {
 	Label   string                 `json:"label"`
 	KeyType domain.KeyGenAlgorithm `json:"key_type"`
+	Owner   string                 `json:"owner"`
+	Tags    map[string]string      `json:"tags"`
 }
 
 type SignatureDeviceInfoResponse struct {
-	Id      string `json:"id"`
-	Label   string `json:"label"`
-	Counter int    `json:"counter"`
+	Id           string                 `json:"id"`
+	Label        string                 `json:"label"`
+	KeyType      domain.KeyGenAlgorithm `json:"key_type"`
+	Owner        string                 `json:"owner"`
+	Tags         map[string]string      `json:"tags"`
+	Counter      int                    `json:"counter"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	LastSignedAt *time.Time             `json:"last_signed_at"`
+	State        domain.DeviceState     `json:"state"`
+	Retirement   *RetirementResponse    `json:"retirement,omitempty"`
+	KeyVersion   int                    `json:"key_version"`
+	KeyVersions  []KeyVersionResponse   `json:"key_versions"`
+	DeletedAt    *time.Time             `json:"deleted_at,omitempty"`
+}
+
+// KeyVersionResponse describes a key version of a device, whose public key is retrieved
+// from /api/v0/devices/{id}/public-key?version={version}.
+type KeyVersionResponse struct {
+	Version           int `json:"version"`
+	ActiveFromCounter int `json:"active_from_counter"`
+}
+
+type RetirementResponse struct {
+	Reason    string    `json:"reason"`
+	RetiredAt time.Time `json:"retired_at"`
+}
+
+type SignatureDeviceInfoDataResponse struct {
+	Data SignatureDeviceInfoResponse `json:"data"`
+}
+
+// SignatureDeviceUpdateParams are the changes applied to a device by PATCH /api/v0/devices/{id}:
+// its label, its tags, replaced as a whole, and its lifecycle state, along with the reason
+// when the device is retired. Omitted fields are left unchanged.
+type SignatureDeviceUpdateParams struct {
+	Label  *string            `json:"label"`
+	Tags   map[string]string  `json:"tags"`
+	State  domain.DeviceState `json:"state"`
+	Reason string             `json:"reason"`
+}
+
+func newSignatureDeviceInfoResponse(device *domain.SignatureDevice) SignatureDeviceInfoResponse {
+	info := SignatureDeviceInfoResponse{
+		Id:           device.Id,
+		Label:        device.Label,
+		KeyType:      device.KeyType,
+		Owner:        device.Owner,
+		Tags:         map[string]string{},
+		Counter:      device.GetSignatureCounter(),
+		CreatedAt:    device.GetCreatedAt(),
+		UpdatedAt:    device.GetUpdatedAt(),
+		LastSignedAt: device.GetLastSignedAt(),
+		State:        device.GetState(),
+		KeyVersion:   device.GetKeyVersion(),
+		KeyVersions:  []KeyVersionResponse{},
+		DeletedAt:    device.GetDeletedAt(),
+	}
+	for key, value := range device.Tags {
+		info.Tags[key] = value
+	}
+	for _, keyVersion := range device.GetKeyVersions() {
+		info.KeyVersions = append(info.KeyVersions, KeyVersionResponse{Version: keyVersion.Version, ActiveFromCounter: keyVersion.ActiveFromCounter})
+	}
+	if retirement := device.GetRetirement(); retirement != nil {
+		info.Retirement = &RetirementResponse{Reason: retirement.Reason, RetiredAt: retirement.RetiredAt}
+	}
+	return info
 }
 
 type SignatureDeviceInfoListResponse struct {
-	Devices []SignatureDeviceInfoResponse `json:"devices"`
+	Devices    []SignatureDeviceInfoResponse `json:"devices"`
+	NextCursor string                        `json:"next_cursor,omitempty"`
 }
 
 type SignatureDevicesResponse struct {
@@ -37,21 +112,25 @@ type SignatureDeviceResponse struct {
 
 func (s *Server) HandleSignatureDeviceCreation(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodPost {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{http.StatusText(http.StatusMethodNotAllowed)})
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
 		return
 	}
 
 	var signatureDeviceParams SignatureDeviceParams
-	decoder := json.NewDecoder(request.Body)
-	err := decoder.Decode(&signatureDeviceParams)
-	if err != nil {
-		WriteErrorResponse(response, http.StatusUnprocessableEntity, []string{http.StatusText(http.StatusUnprocessableEntity)})
+	if err := decodeRequestBody(response, request, MaxRequestBodySize, &signatureDeviceParams); err != nil {
+		WriteError(response, err)
+		return
+	}
+	if err := signatureDeviceParams.Validate(); err != nil {
+		WriteError(response, err)
 		return
 	}
 
-	deviceId, err := s.signatureDeviceService.Create(signatureDeviceParams.Label, signatureDeviceParams.KeyType)
+	metadata := domain.DeviceMetadata{Owner: signatureDeviceParams.Owner, Tags: signatureDeviceParams.Tags}
+	deviceId, err := s.signatureDeviceService.Create(signatureDeviceParams.Label, signatureDeviceParams.KeyType, metadata)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusInternalServerError, []string{err.Error()})
+		WriteError(response, err)
+		return
 	}
 
 	WriteAPIResponse(response, http.StatusCreated, SignatureDeviceCreationResponse{Id: deviceId})
@@ -59,29 +138,166 @@ func (s *Server) HandleSignatureDeviceCreation(response http.ResponseWriter, req
 
 func (s *Server) HandleSignatureDeviceRetrieval(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{http.StatusText(http.StatusMethodNotAllowed)})
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
 		return
 	}
 
-	deviceId := strings.TrimPrefix(request.URL.Path, "/api/v0/devices/")
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
 	devicesList := []SignatureDeviceInfoResponse{}
 
 	if deviceId != "" {
 		device, err := s.signatureDeviceService.FindById(deviceId)
 		if err != nil {
-			WriteErrorResponse(response, http.StatusNotFound, []string{err.Error()})
+			WriteError(response, err)
 			return
 		}
-		devicesList = append(devicesList, SignatureDeviceInfoResponse{Id: device.Id, Label: device.Label, Counter: device.GetSignatureCounter()})
-	} else {
-		devices, err := s.signatureDeviceService.FindAll()
-		if err != nil {
-			WriteErrorResponse(response, http.StatusInternalServerError, []string{err.Error()})
-			return
+		devicesList = append(devicesList, newSignatureDeviceInfoResponse(device))
+		WriteAPIResponse(response, http.StatusOK, SignatureDeviceInfoListResponse{Devices: devicesList})
+		return
+	}
+
+	query, err := parseDeviceQuery(request.URL.Query())
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+	page, err := s.signatureDeviceService.Query(query)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+	for _, device := range page.Devices {
+		devicesList = append(devicesList, newSignatureDeviceInfoResponse(device))
+	}
+	WriteAPIResponse(response, http.StatusOK, SignatureDeviceInfoListResponse{Devices: devicesList, NextCursor: page.NextCursor})
+}
+
+// parseDeviceQuery parses the query parameters of device listings: the key_type, state,
+// label_prefix and tags.<key> filters, the sort field, descending when prefixed by "-",
+// the page limit and the cursor of the page.
+func parseDeviceQuery(values url.Values) (domain.DeviceQuery, error) {
+	query := domain.DeviceQuery{
+		KeyType:     domain.KeyGenAlgorithm(values.Get("key_type")),
+		LabelPrefix: values.Get("label_prefix"),
+		State:       domain.DeviceState(values.Get("state")),
+		Cursor:      values.Get("cursor"),
+	}
+	if query.KeyType != "" {
+		if _, err := query.KeyType.Parameters(); err != nil {
+			return query, domain.DeviceQueryNotValidError(fmt.Sprintf("key_type %q is not supported", query.KeyType))
 		}
-		for _, device := range devices {
-			devicesList = append(devicesList, SignatureDeviceInfoResponse{Id: device.Id, Label: device.Label, Counter: device.GetSignatureCounter()})
+	}
+	if query.State != "" && !query.State.Valid() {
+		return query, domain.DeviceQueryNotValidError(fmt.Sprintf("state must be one of %v", domain.DeviceStates()))
+	}
+
+	sortBy := values.Get("sort")
+	query.Descending = strings.HasPrefix(sortBy, "-")
+	query.SortBy = domain.DeviceSortField(strings.TrimPrefix(sortBy, "-"))
+	if _, err := query.Sort(); err != nil {
+		return query, domain.DeviceQueryNotValidError(fmt.Sprintf("sort must be one of %s or %s, prefixed by - for descending order", domain.SortByCreatedAt, domain.SortByCounter))
+	}
+
+	limit, err := parseQueryInt(values.Get("limit"), DefaultDevicesPageSize)
+	if err != nil || limit < 1 || limit > MaxDevicesPageSize {
+		return query, domain.DeviceQueryNotValidError(fmt.Sprintf("limit must be an integer between 1 and %d", MaxDevicesPageSize))
+	}
+	query.Limit = limit
+
+	for name, tagValues := range values {
+		if key, found := strings.CutPrefix(name, "tags."); found {
+			if query.Tags == nil {
+				query.Tags = map[string]string{}
+			}
+			query.Tags[key] = tagValues[0]
 		}
 	}
-	WriteAPIResponse(response, http.StatusOK, SignatureDeviceInfoListResponse{Devices: devicesList})
+	return query, nil
+}
+
+// HandleSignatureDeviceUpdate applies the SignatureDeviceUpdateParams to a device as a
+// single change, returning the updated device.
+func (s *Server) HandleSignatureDeviceUpdate(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPatch {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	var updateParams SignatureDeviceUpdateParams
+	if err := decodeRequestBody(response, request, MaxRequestBodySize, &updateParams); err != nil {
+		WriteError(response, err)
+		return
+	}
+	if err := updateParams.Validate(); err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	update := domain.DeviceUpdate{Label: updateParams.Label, Tags: updateParams.Tags, Reason: updateParams.Reason}
+	if updateParams.State != "" {
+		update.State = &updateParams.State
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+	device, err := s.signatureDeviceService.UpdateDevice(deviceId, update)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, newSignatureDeviceInfoResponse(device))
+}
+
+// HandleSignatureDeviceDeletion soft deletes a device: its private key is destroyed, while
+// its public keys and signatures are kept for verification and audit.
+func (s *Server) HandleSignatureDeviceDeletion(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+	if err := s.signatureDeviceService.Delete(deviceId); err != nil {
+		WriteError(response, err)
+		return
+	}
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSignatureDeviceResources dispatches requests on /api/v0/devices/ to the device
+// retrieval, update and deletion handlers or, when a sub-resource is addressed, to the matching handler.
+func (s *Server) HandleSignatureDeviceResources(response http.ResponseWriter, request *http.Request) {
+	deviceId, resource := parseSignatureDevicePath(request.URL.Path)
+
+	switch resource {
+	case "":
+		switch {
+		case deviceId != "" && request.Method == http.MethodPatch:
+			s.HandleSignatureDeviceUpdate(response, request)
+		case deviceId != "" && request.Method == http.MethodDelete:
+			s.HandleSignatureDeviceDeletion(response, request)
+		default:
+			s.HandleSignatureDeviceRetrieval(response, request)
+		}
+	case "sign":
+		s.HandleTransactionSigning(response, request)
+	case "verify":
+		s.HandleSignatureVerification(response, request)
+	case "public-key":
+		s.HandlePublicKeyRetrieval(response, request)
+	case "rotate":
+		s.HandleKeyRotation(response, request)
+	case "signatures":
+		s.HandleSignatureRetrieval(response, request)
+	case "audit":
+		s.HandleSignatureChainAudit(response, request)
+	default:
+		WriteProblem(response, http.StatusNotFound, ProblemNotFound, "")
+	}
+}
+
+// parseSignatureDevicePath splits a /api/v0/devices/{id}/{resource} path
+// into the device ID and the (optional) sub-resource name.
+func parseSignatureDevicePath(path string) (string, string) {
+	deviceId, resource, _ := strings.Cut(strings.TrimPrefix(path, "/api/v0/devices/"), "/")
+	return deviceId, resource
 }
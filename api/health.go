@@ -10,9 +10,7 @@ type HealthResponse struct {
 // Health evaluates the health of the service and writes a standardized response.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
 		return
 	}
 
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+)
+
+const (
+	ContentTypePEM    = "application/x-pem-file"
+	ContentTypeDER    = "application/octet-stream"
+	ContentTypeJWK    = "application/jwk+json"
+	ContentTypeJWKSet = "application/jwk-set+json"
+)
+
+// HandlePublicKeyRetrieval writes the public key of a signature device as PEM, DER or JWK,
+// according to the request Accept header. PEM is returned when no preference is expressed.
+// The current key is returned, unless a previous key is selected with the version parameter.
+func (s *Server) HandlePublicKeyRetrieval(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	contentType := negotiatePublicKeyContentType(request.Header.Get("Accept"))
+	if contentType == "" {
+		WriteProblem(response, http.StatusNotAcceptable, ProblemNotAcceptable, "")
+		return
+	}
+
+	version := 0
+	if encodedVersion := request.URL.Query().Get("version"); encodedVersion != "" {
+		var err error
+		if version, err = strconv.Atoi(encodedVersion); err != nil || version < 1 {
+			WriteProblem(response, http.StatusBadRequest, ProblemInvalidParameter, "version must be a positive integer")
+			return
+		}
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+	device, err := s.signatureDeviceService.FindById(deviceId)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+	if version == 0 {
+		version = device.GetKeyVersion()
+	}
+	keyVersion, err := device.FindKeyVersion(version)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+	publicKey := keyVersion.PublicKey
+
+	switch contentType {
+	case ContentTypeDER:
+		_, der, err := crypto.ParsePublicKey(publicKey)
+		if err != nil {
+			WriteError(response, err)
+			return
+		}
+		WriteContentResponse(response, http.StatusOK, contentType, der)
+	case ContentTypeJWK:
+		jwk, err := crypto.NewJWK(keyId(device.Id, version), publicKey)
+		if err != nil {
+			WriteError(response, err)
+			return
+		}
+		bytes, err := json.Marshal(jwk)
+		if err != nil {
+			WriteInternalError(response)
+			return
+		}
+		WriteContentResponse(response, http.StatusOK, contentType, bytes)
+	default:
+		WriteContentResponse(response, http.StatusOK, contentType, publicKey)
+	}
+}
+
+// HandleKeyRotation rotates the key of a signature device, returning the device with its
+// new key version. The device signature counter and chain continue across the rotation.
+func (s *Server) HandleKeyRotation(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+	device, err := s.signatureDeviceService.RotateKey(deviceId)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+	WriteAPIResponse(response, http.StatusOK, newSignatureDeviceInfoResponse(device))
+}
+
+// HandleJWKSRetrieval writes the JSON Web Key Set of the public keys of the active
+// signature devices, every key version included so that signatures produced before a
+// rotation keep verifying, to be consumed by external verifiers. The keys of suspended,
+// retired and deleted devices stay available through their public-key resource.
+func (s *Server) HandleJWKSRetrieval(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	page, err := s.signatureDeviceService.Query(domain.DeviceQuery{State: domain.DeviceActive})
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	jwkSet := crypto.JWKSet{Keys: []crypto.JWK{}}
+	for _, device := range page.Devices {
+		for _, keyVersion := range device.GetKeyVersions() {
+			jwk, err := crypto.NewJWK(keyId(device.Id, keyVersion.Version), keyVersion.PublicKey)
+			if err != nil {
+				log.Printf("device %s public key version %d skipped from JWKS: %s", device.Id, keyVersion.Version, err.Error())
+				continue
+			}
+			jwkSet.Keys = append(jwkSet.Keys, *jwk)
+		}
+	}
+
+	bytes, err := json.Marshal(jwkSet)
+	if err != nil {
+		WriteInternalError(response)
+		return
+	}
+	WriteContentResponse(response, http.StatusOK, ContentTypeJWKSet, bytes)
+}
+
+// keyId returns the JWK "kid" of a device key version, "<device ID>:<version>", so that
+// every key a device has signed with is told apart.
+func keyId(deviceId string, version int) string {
+	return deviceId + ":" + strconv.Itoa(version)
+}
+
+// negotiatePublicKeyContentType picks the first supported public key representation
+// listed in an Accept header, returning an empty string if none is acceptable.
+func negotiatePublicKeyContentType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return ContentTypePEM
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case ContentTypePEM, "*/*", "application/*":
+			return ContentTypePEM
+		case ContentTypeDER, ContentTypeJWK:
+			return mediaType
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+)
+
+const ContentTypeProblemJSON = "application/problem+json"
+
+// ProblemCode is the stable, machine readable code of a Problem, for clients to switch on.
+type ProblemCode string
+
+const (
+	ProblemNotFound            ProblemCode = "not_found"
+	ProblemMethodNotAllowed    ProblemCode = "method_not_allowed"
+	ProblemNotAcceptable       ProblemCode = "not_acceptable"
+	ProblemInvalidRequestBody  ProblemCode = "invalid_request_body"
+	ProblemInvalidParameter    ProblemCode = "invalid_parameter"
+	ProblemDeviceNotFound      ProblemCode = "device_not_found"
+	ProblemDeviceDeleted       ProblemCode = "device_deleted"
+	ProblemKeyVersionNotFound  ProblemCode = "key_version_not_found"
+	ProblemKeyTypeNotSupported ProblemCode = "key_type_not_supported"
+	ProblemConcurrentUpdate    ProblemCode = "concurrent_update"
+	ProblemDeviceNotActive     ProblemCode = "device_not_active"
+	ProblemInvalidTransition   ProblemCode = "invalid_state_transition"
+	ProblemKeyGenerationFailed ProblemCode = "key_generation_failed"
+	ProblemKeyDecodingFailed   ProblemCode = "key_decoding_failed"
+	ProblemSigningFailed       ProblemCode = "signing_failed"
+	ProblemInternalError       ProblemCode = "internal_error"
+	ProblemValidationFailed    ProblemCode = "validation_failed"
+	ProblemRequestTooLarge     ProblemCode = "request_body_too_large"
+)
+
+// problemTypePrefix prefixes the problem codes into the problem type URIs.
+const problemTypePrefix = "urn:signature-service:problem:"
+
+// Problem is an RFC 7807 problem details object, extended with its ProblemCode and, for
+// validation failures, the errors of the invalid fields.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   ProblemCode  `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+func newProblem(status int, code ProblemCode, detail string) Problem {
+	return Problem{
+		Type:   problemTypePrefix + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WriteProblem writes an application/problem+json response with the given status, code
+// and human readable detail, which is omitted when empty.
+func WriteProblem(w http.ResponseWriter, status int, code ProblemCode, detail string) {
+	writeProblem(w, newProblem(status, code, detail))
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	bytes, err := json.Marshal(problem)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblemJSON)
+	w.WriteHeader(problem.Status)
+	w.Write(bytes)
+}
+
+// WriteError writes the problem an error returned by the services maps to. Client errors
+// carry the error message as detail; server errors are logged and their cause is not
+// disclosed.
+func WriteError(w http.ResponseWriter, err error) {
+	problem := mapError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		log.Printf("request failed with %s: %s", problem.Code, err.Error())
+	}
+	writeProblem(w, problem)
+}
+
+// HandleNotFound writes the problem of requests to unknown routes.
+func (s *Server) HandleNotFound(response http.ResponseWriter, request *http.Request) {
+	WriteProblem(response, http.StatusNotFound, ProblemNotFound, "")
+}
+
+// mapError translates an error into its problem.
+func mapError(err error) Problem {
+	var validationErr ValidationError
+	var malformedBodyErr MalformedRequestBodyError
+	var maxBytesErr *http.MaxBytesError
+	var notFoundErr domain.DeviceNotFoundError
+	var keyVersionErr domain.KeyVersionNotFoundError
+	var deletedErr domain.DeviceDeletedError
+	var queryErr domain.DeviceQueryNotValidError
+	var keyTypeErr domain.KeyTypeNotValidError
+	var staleUpdateErr domain.StaleDeviceUpdateError
+	var recordConflictErr domain.SignatureRecordConflictError
+	var stateErr domain.DeviceStateNotValidError
+	var transitionErr domain.DeviceStateTransitionError
+	var notActiveErr domain.DeviceNotActiveError
+	var keyGenerationErr *domain.KeyGenerationError
+	var notSupportedErr crypto.KeyAlgorithmNotSupportedError
+	var keyDecodingErr *domain.KeyDecodingError
+	var signingErr *domain.SigningError
+
+	switch {
+	case errors.As(err, &validationErr):
+		problem := newProblem(http.StatusBadRequest, ProblemValidationFailed, "request body holds invalid fields")
+		problem.Errors = validationErr
+		return problem
+	case errors.As(err, &malformedBodyErr):
+		return newProblem(http.StatusBadRequest, ProblemInvalidRequestBody, err.Error())
+	case errors.As(err, &maxBytesErr):
+		return newProblem(http.StatusRequestEntityTooLarge, ProblemRequestTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit))
+	case errors.As(err, &notFoundErr):
+		return newProblem(http.StatusNotFound, ProblemDeviceNotFound, err.Error())
+	case errors.As(err, &queryErr):
+		return newProblem(http.StatusBadRequest, ProblemInvalidParameter, err.Error())
+	case errors.As(err, &deletedErr):
+		return newProblem(http.StatusGone, ProblemDeviceDeleted, err.Error())
+	case errors.As(err, &keyVersionErr):
+		return newProblem(http.StatusNotFound, ProblemKeyVersionNotFound, err.Error())
+	case errors.As(err, &keyTypeErr):
+		return newProblem(http.StatusBadRequest, ProblemKeyTypeNotSupported, err.Error()+", supported key types are listed at /api/v0/algorithms")
+	case errors.As(err, &keyGenerationErr) && errors.As(err, &notSupportedErr):
+		return newProblem(http.StatusBadRequest, ProblemKeyTypeNotSupported, notSupportedErr.Error()+" by the key store")
+	case errors.As(err, &stateErr):
+		return newProblem(http.StatusBadRequest, ProblemInvalidParameter, err.Error())
+	case errors.As(err, &transitionErr):
+		return newProblem(http.StatusConflict, ProblemInvalidTransition, err.Error())
+	case errors.As(err, &notActiveErr):
+		return newProblem(http.StatusConflict, ProblemDeviceNotActive, err.Error())
+	case errors.As(err, &staleUpdateErr), errors.As(err, &recordConflictErr):
+		return newProblem(http.StatusConflict, ProblemConcurrentUpdate, "the signature device has been concurrently updated, retry the request")
+	case errors.As(err, &keyGenerationErr):
+		return newProblem(http.StatusInternalServerError, ProblemKeyGenerationFailed, "the signature device key cannot be generated")
+	case errors.As(err, &keyDecodingErr):
+		return newProblem(http.StatusInternalServerError, ProblemKeyDecodingFailed, "the signature device public key cannot be decoded")
+	case errors.As(err, &signingErr):
+		return newProblem(http.StatusInternalServerError, ProblemSigningFailed, "the signature device key cannot sign")
+	default:
+		return newProblem(http.StatusInternalServerError, ProblemInternalError, "")
+	}
+}
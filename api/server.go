@@ -13,11 +13,6 @@ type Response struct {
 	Data interface{} `json:"data"`
 }
 
-// ErrorResponse is the generic error API response container.
-type ErrorResponse struct {
-	Errors []string `json:"errors"`
-}
-
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
 	http.Handler
@@ -39,7 +34,10 @@ func (s *Server) InitializeRouter() error {
 
 	mux.Handle("/api/v0/health", http.HandlerFunc(s.Health))
 	mux.Handle("/api/v0/devices", http.HandlerFunc(s.HandleSignatureDeviceCreation))
-	mux.Handle("/api/v0/devices/", http.HandlerFunc(s.HandleSignatureDeviceRetrieval))
+	mux.Handle("/api/v0/devices/", http.HandlerFunc(s.HandleSignatureDeviceResources))
+	mux.Handle("/api/v0/jwks", http.HandlerFunc(s.HandleJWKSRetrieval))
+	mux.Handle("/api/v0/algorithms", http.HandlerFunc(s.HandleKeyGenAlgorithmsRetrieval))
+	mux.Handle("/", http.HandlerFunc(s.HandleNotFound))
 
 	s.Handler = mux
 
@@ -58,23 +56,6 @@ func WriteInternalError(w http.ResponseWriter) {
 	w.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 }
 
-// WriteErrorResponse takes an HTTP status code and a slice of errors
-// and writes those as an HTTP error response in a structured format.
-func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
-	w.WriteHeader(code)
-
-	errorResponse := ErrorResponse{
-		Errors: errors,
-	}
-
-	bytes, err := json.Marshal(errorResponse)
-	if err != nil {
-		WriteInternalError(w)
-	}
-
-	w.Write(bytes)
-}
-
 // WriteAPIResponse takes an HTTP status code and a generic data struct
 // and writes those as an HTTP response in a structured format.
 func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
@@ -91,3 +72,11 @@ func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
 
 	w.Write(bytes)
 }
+
+// WriteContentResponse takes an HTTP status code, a content type and a body
+// and writes those as a raw HTTP response.
+func WriteContentResponse(w http.ResponseWriter, code int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(body)
+}
@@ -2,14 +2,20 @@ package api_test
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/PaoloModica/signing-service-challenge-go/api"
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
 	"github.com/PaoloModica/signing-service-challenge-go/domain"
 	test_utils "github.com/PaoloModica/signing-service-challenge-go/internal"
 )
@@ -17,12 +23,12 @@ import (
 func TestServer(t *testing.T) {
 	baseUrl := "http://localhost:8080"
 
-	device, _ := domain.NewSignatureDevice("testDevice1", []byte("privateKey"), "RSA")
+	device, _ := domain.NewSignatureDevice("testDevice1", []byte("publicKey"), "keyHandle", "RSA")
 	store := test_utils.StubSignatureDeviceStore{
 		Store: map[string]*domain.SignatureDevice{device.Id: device},
 	}
 	repository, _ := domain.NewSignatureDeviceRepository(&store)
-	service, _ := domain.NewSignatureDeviceService(repository)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
 
 	server := api.NewServer(baseUrl, service)
 	server.InitializeRouter()
@@ -114,6 +120,9 @@ func TestServer(t *testing.T) {
 		if gotDevice.Id != device.Id {
 			t.Errorf("expected signature device retrieve to be %s, got %s", device.Id, gotDevice.Id)
 		}
+		if gotDevice.State != domain.DeviceActive || gotDevice.Retirement != nil {
+			t.Errorf("expected signature device to be active, got %s", gotDevice.State)
+		}
 	})
 	t.Run("GET /api/v0/devices/:id returns 404", func(t *testing.T) {
 		request, _ := http.NewRequest(http.MethodGet, "/api/v0/devices/unknown", nil)
@@ -123,6 +132,953 @@ func TestServer(t *testing.T) {
 		responseResult := response.Result()
 		assertResponseStatusCode(t, http.StatusNotFound, responseResult.StatusCode)
 	})
+	t.Run("POST /api/v0/devices/:id/sign returns 200 and chained signatures", func(t *testing.T) {
+		deviceId, _ := service.Create("signingDevice", domain.ECC, domain.DeviceMetadata{})
+		dataToBeSigned := "test data"
+
+		firstSignature := signTransaction(t, server, deviceId, dataToBeSigned)
+		expectedSignedData := fmt.Sprintf("0_%s_%s", dataToBeSigned, base64.StdEncoding.EncodeToString([]byte(deviceId)))
+		if firstSignature.Data.SignedData != expectedSignedData {
+			t.Errorf("expected signed data to be %s, got %s", expectedSignedData, firstSignature.Data.SignedData)
+		}
+
+		secondSignature := signTransaction(t, server, deviceId, dataToBeSigned)
+		expectedSignedData = fmt.Sprintf("1_%s_%s", dataToBeSigned, firstSignature.Data.Signature)
+		if secondSignature.Data.SignedData != expectedSignedData {
+			t.Errorf("expected signed data to be %s, got %s", expectedSignedData, secondSignature.Data.SignedData)
+		}
+	})
+	t.Run("POST /api/v0/devices/:id/sign returns 404 for unknown device", func(t *testing.T) {
+		signingParams, _ := json.Marshal(api.TransactionSigningParams{DataToBeSigned: "test data"})
+		request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices/unknown/sign", bytes.NewReader(signingParams))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusNotFound, response.Result().StatusCode)
+	})
+	t.Run("POST /api/v0/devices/:id/verify returns 200 and verification outcome", func(t *testing.T) {
+		deviceId, _ := service.Create("verifyingDevice", domain.RSA, domain.DeviceMetadata{})
+		dataToBeSigned := "test data"
+		signature := signTransaction(t, server, deviceId, dataToBeSigned)
+
+		verificationTestCases := []struct {
+			description    string
+			dataToBeSigned string
+			expected       bool
+		}{
+			{"valid signature", dataToBeSigned, true},
+			{"tampered data", "tampered data", false},
+		}
+		for _, tc := range verificationTestCases {
+			t.Run(tc.description, func(t *testing.T) {
+				verificationParams, _ := json.Marshal(api.SignatureVerificationParams{
+					DataToBeSigned:   tc.dataToBeSigned,
+					SignatureCounter: 0,
+					LastSignature:    base64.StdEncoding.EncodeToString([]byte(deviceId)),
+					Signature:        signature.Data.Signature,
+				})
+				request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/verify", deviceId), bytes.NewReader(verificationParams))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				responseResult := response.Result()
+				assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+
+				defer responseResult.Body.Close()
+				var verificationResponse api.SignatureVerificationResponse
+				json.NewDecoder(responseResult.Body).Decode(&verificationResponse)
+
+				if verificationResponse.Data.Valid != tc.expected {
+					t.Errorf("expected signature verification to be %t, got %t", tc.expected, verificationResponse.Data.Valid)
+				}
+			})
+		}
+	})
+	t.Run("POST /api/v0/devices/:id/sign and verify accept data larger than device management bodies", func(t *testing.T) {
+		deviceId, _ := service.Create("largeDataDevice", domain.ECC, domain.DeviceMetadata{})
+		dataToBeSigned := strings.Repeat("receipt line\n", 2*api.MaxRequestBodySize/len("receipt line\n"))
+		signature := signTransaction(t, server, deviceId, dataToBeSigned)
+
+		verificationParams, _ := json.Marshal(api.SignatureVerificationParams{
+			DataToBeSigned:   dataToBeSigned,
+			SignatureCounter: 0,
+			LastSignature:    base64.StdEncoding.EncodeToString([]byte(deviceId)),
+			Signature:        signature.Data.Signature,
+		})
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/verify", deviceId), bytes.NewReader(verificationParams))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		responseResult := response.Result()
+		assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+
+		defer responseResult.Body.Close()
+		var verificationResponse api.SignatureVerificationResponse
+		json.NewDecoder(responseResult.Body).Decode(&verificationResponse)
+		if !verificationResponse.Data.Valid {
+			t.Errorf("expected signature of %d bytes of data to verify", len(dataToBeSigned))
+		}
+	})
+	t.Run("POST /api/v0/devices/:id/verify returns 400 for signature not base64 encoded", func(t *testing.T) {
+		verificationParams, _ := json.Marshal(api.SignatureVerificationParams{DataToBeSigned: "test data", Signature: "not base64!"})
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/verify", device.Id), bytes.NewReader(verificationParams))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		problem := assertProblem(t, response.Result(), http.StatusBadRequest, api.ProblemValidationFailed)
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "signature" || problem.Errors[0].Code != api.FieldInvalidValue {
+			t.Errorf("expected invalid signature field error, got %v", problem.Errors)
+		}
+	})
+	t.Run("POST /api/v0/devices/:id/sign and verify refuse unknown fields and malformed bodies", func(t *testing.T) {
+		for _, tc := range []struct {
+			description    string
+			resource       string
+			body           string
+			expectedStatus int
+			expectedCode   api.ProblemCode
+		}{
+			{"sign unknown field", "sign", `{"data_to_be_signed": "test data", "counter": 1}`, http.StatusBadRequest, api.ProblemValidationFailed},
+			{"sign malformed body", "sign", `{"data_to_be_signed": `, http.StatusBadRequest, api.ProblemInvalidRequestBody},
+			{"sign body too large", "sign", fmt.Sprintf(`{"data_to_be_signed": "%s"}`, strings.Repeat("a", api.MaxTransactionRequestBodySize)), http.StatusRequestEntityTooLarge, api.ProblemRequestTooLarge},
+			{"verify body too large", "verify", fmt.Sprintf(`{"data_to_be_signed": "%s"}`, strings.Repeat("a", api.MaxTransactionRequestBodySize)), http.StatusRequestEntityTooLarge, api.ProblemRequestTooLarge},
+			{"verify unknown field", "verify", `{"data_to_be_signed": "test data", "signature_counter": 0, "key_version": 1}`, http.StatusBadRequest, api.ProblemValidationFailed},
+			{"verify trailing data", "verify", `{} {}`, http.StatusBadRequest, api.ProblemInvalidRequestBody},
+		} {
+			t.Run(tc.description, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/%s", device.Id, tc.resource), strings.NewReader(tc.body))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				assertProblem(t, response.Result(), tc.expectedStatus, tc.expectedCode)
+			})
+		}
+	})
+	t.Run("GET /api/v0/devices/:id/public-key returns the public key in the accepted format", func(t *testing.T) {
+		deviceId, _ := service.Create("publicKeyDevice", domain.ECC, domain.DeviceMetadata{})
+		signingDevice, _ := service.FindById(deviceId)
+		publicKeyBlock, _ := pem.Decode(signingDevice.PublicKey)
+
+		publicKeyTestCases := []struct {
+			accept              string
+			expectedContentType string
+		}{
+			{"", api.ContentTypePEM},
+			{"*/*", api.ContentTypePEM},
+			{api.ContentTypePEM, api.ContentTypePEM},
+			{api.ContentTypeDER, api.ContentTypeDER},
+			{"text/html, application/jwk+json;q=0.9", api.ContentTypeJWK},
+		}
+		for _, tc := range publicKeyTestCases {
+			t.Run(tc.expectedContentType, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/public-key", deviceId), nil)
+				request.Header.Set("Accept", tc.accept)
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				responseResult := response.Result()
+				assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+				if contentType := responseResult.Header.Get("Content-Type"); contentType != tc.expectedContentType {
+					t.Errorf("expected content type %s, got %s", tc.expectedContentType, contentType)
+				}
+
+				defer responseResult.Body.Close()
+				body, _ := io.ReadAll(responseResult.Body)
+				switch tc.expectedContentType {
+				case api.ContentTypePEM:
+					if !bytes.Equal(body, signingDevice.PublicKey) {
+						t.Errorf("expected PEM encoded public key")
+					}
+				case api.ContentTypeDER:
+					if !bytes.Equal(body, publicKeyBlock.Bytes) {
+						t.Errorf("expected DER encoded public key")
+					}
+				case api.ContentTypeJWK:
+					var jwk crypto.JWK
+					json.Unmarshal(body, &jwk)
+					if jwk.Kid != deviceId+":1" || jwk.Kty != "EC" {
+						t.Errorf("expected EC JWK with kid %s:1, got kty %s and kid %s", deviceId, jwk.Kty, jwk.Kid)
+					}
+				}
+			})
+		}
+	})
+	t.Run("GET /api/v0/devices/:id/public-key returns 406 Not Acceptable", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/public-key", device.Id), nil)
+		request.Header.Set("Accept", "text/html")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusNotAcceptable, response.Result().StatusCode)
+	})
+	t.Run("GET /api/v0/devices/:id/public-key returns 404 for unknown device", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v0/devices/unknown/public-key", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusNotFound, response.Result().StatusCode)
+	})
+	t.Run("GET /api/v0/jwks returns 200 and the JWK set of the active devices", func(t *testing.T) {
+		suspendedDeviceId, _ := service.Create("suspendedJWKSDevice", domain.ECC, domain.DeviceMetadata{})
+		service.SetState(suspendedDeviceId, domain.DeviceSuspended, "")
+		deletedDeviceId, _ := service.Create("deletedJWKSDevice", domain.ECC, domain.DeviceMetadata{})
+		service.Delete(deletedDeviceId)
+
+		request, _ := http.NewRequest(http.MethodGet, "/api/v0/jwks", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		responseResult := response.Result()
+		assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+
+		defer responseResult.Body.Close()
+		var jwkSet crypto.JWKSet
+		json.NewDecoder(responseResult.Body).Decode(&jwkSet)
+
+		published := map[string]bool{}
+		for _, jwk := range jwkSet.Keys {
+			if published[jwk.Kid] {
+				t.Errorf("expected kid %s to be unique in JWK set", jwk.Kid)
+			}
+			published[jwk.Kid] = true
+		}
+		devices, _ := service.FindAll()
+		for _, d := range devices {
+			// the fixture device holds a placeholder public key, which is not published
+			expected := d.GetState() == domain.DeviceActive && !d.IsDeleted() && d.Id != device.Id
+			for _, keyVersion := range d.GetKeyVersions() {
+				if published[fmt.Sprintf("%s:%d", d.Id, keyVersion.Version)] != expected {
+					t.Errorf("expected key version %d of device %s (%s) to be published: %t", keyVersion.Version, d.Label, d.GetState(), expected)
+				}
+			}
+		}
+		if published[suspendedDeviceId+":1"] || published[deletedDeviceId+":1"] {
+			t.Errorf("expected keys of suspended and deleted devices not to be published")
+		}
+	})
+	t.Run("GET /api/v0/devices/:id/signatures returns 200 and pages of the signature ledger", func(t *testing.T) {
+		deviceId, _ := service.Create("ledgerDevice", domain.ECC, domain.DeviceMetadata{})
+		for i := 0; i < 5; i++ {
+			signTransaction(t, server, deviceId, fmt.Sprintf("transaction %d", i))
+		}
+
+		pageTestCases := []struct {
+			query            string
+			expectedCounters []int
+			expectedNextFrom *int
+		}{
+			{"", []int{0, 1, 2, 3, 4}, nil},
+			{"?limit=2", []int{0, 1}, intPointer(2)},
+			{"?from=2&limit=2", []int{2, 3}, intPointer(4)},
+			{"?from=4&limit=2", []int{4}, nil},
+			{"?from=1&to=3", []int{1, 2}, nil},
+		}
+		for _, tc := range pageTestCases {
+			t.Run(tc.query, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/signatures%s", deviceId, tc.query), nil)
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				responseResult := response.Result()
+				assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+
+				defer responseResult.Body.Close()
+				var signaturesResponse api.SignatureRecordsResponse
+				json.NewDecoder(responseResult.Body).Decode(&signaturesResponse)
+
+				signatures := signaturesResponse.Data.Signatures
+				if len(signatures) != len(tc.expectedCounters) {
+					t.Fatalf("expected %d signatures, got %d", len(tc.expectedCounters), len(signatures))
+				}
+				for i, signature := range signatures {
+					if signature.Counter != tc.expectedCounters[i] {
+						t.Errorf("expected signature counter %d, got %d", tc.expectedCounters[i], signature.Counter)
+					}
+				}
+				nextFrom := signaturesResponse.Data.NextFrom
+				if (nextFrom == nil) != (tc.expectedNextFrom == nil) || (nextFrom != nil && *nextFrom != *tc.expectedNextFrom) {
+					t.Errorf("expected next page to start from %v, got %v", tc.expectedNextFrom, nextFrom)
+				}
+			})
+		}
+	})
+	t.Run("GET /api/v0/devices/:id/signatures returns 400 for invalid range", func(t *testing.T) {
+		for _, query := range []string{"?from=-1", "?from=3&to=1", "?limit=0", "?limit=abc"} {
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/signatures%s", device.Id, query), nil)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			assertResponseStatusCode(t, http.StatusBadRequest, response.Result().StatusCode)
+		}
+	})
+	t.Run("GET /api/v0/devices/:id/signatures returns 404 for unknown device", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v0/devices/unknown/signatures", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusNotFound, response.Result().StatusCode)
+	})
+	t.Run("GET /api/v0/devices/:id/audit returns 200 and the audit report", func(t *testing.T) {
+		deviceId, _ := service.Create("auditedDevice", domain.RSA, domain.DeviceMetadata{})
+		for i := 0; i < 3; i++ {
+			signTransaction(t, server, deviceId, fmt.Sprintf("transaction %d", i))
+		}
+
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/audit", deviceId), nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		responseResult := response.Result()
+		assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+
+		defer responseResult.Body.Close()
+		var auditResponse api.SignatureChainAuditResponse
+		json.NewDecoder(responseResult.Body).Decode(&auditResponse)
+
+		report := auditResponse.Data
+		if !report.Valid || report.VerifiedSignatures != 3 || report.BrokenLink != nil {
+			t.Errorf("expected 3 valid signatures, got %d and broken link %v", report.VerifiedSignatures, report.BrokenLink)
+		}
+	})
+	t.Run("GET /api/v0/devices/:id/audit returns 404 for unknown device", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v0/devices/unknown/audit", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusNotFound, response.Result().StatusCode)
+	})
+	t.Run("GET /api/v0/devices/:id/sign returns 405 Method Not Allowed", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/sign", device.Id), nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusMethodNotAllowed, response.Result().StatusCode)
+	})
+	t.Run("GET /api/v0/algorithms returns 200 and the supported key types", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v0/algorithms", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		responseResult := response.Result()
+		assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+
+		defer responseResult.Body.Close()
+		var algorithmsResponse api.KeyGenAlgorithmsResponse
+		json.NewDecoder(responseResult.Body).Decode(&algorithmsResponse)
+
+		expectedAlgorithms := map[domain.KeyGenAlgorithm]api.KeyGenAlgorithmResponse{
+			domain.RSA3072:   {Name: domain.RSA3072, Family: "RSA", KeySize: 3072},
+			domain.ECDSAP256: {Name: domain.ECDSAP256, Family: "ECDSA", KeySize: 256, Curve: "P-256"},
+			domain.RSA:       {Name: domain.RSA, Family: "RSA", KeySize: 2048, Deprecated: true},
+		}
+		for _, algorithm := range algorithmsResponse.Data.Algorithms {
+			if expected, found := expectedAlgorithms[algorithm.Name]; found {
+				if algorithm != expected {
+					t.Errorf("expected algorithm %v, got %v", expected, algorithm)
+				}
+				delete(expectedAlgorithms, algorithm.Name)
+			}
+		}
+		if len(expectedAlgorithms) != 0 {
+			t.Errorf("expected algorithms %v to be listed", expectedAlgorithms)
+		}
+	})
+	t.Run("POST /api/v0/algorithms returns 405 Method Not Allowed", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v0/algorithms", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusMethodNotAllowed, response.Result().StatusCode)
+	})
+	t.Run("POST /api/v0/devices validates the device params", func(t *testing.T) {
+		for _, tc := range []struct {
+			description    string
+			body           string
+			expectedStatus int
+			expectedCode   api.ProblemCode
+			expectedErrors []api.FieldError
+		}{
+			{
+				description:    "missing key type and label",
+				body:           `{}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "key_type", Code: api.FieldRequired}, {Field: "label", Code: api.FieldRequired}},
+			},
+			{
+				description:    "unknown key type",
+				body:           `{"label": "testDevice", "key_type": "DSA"}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "key_type", Code: api.FieldInvalidValue}},
+			},
+			{
+				description:    "blank label",
+				body:           `{"label": "   ", "key_type": "Ed25519"}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "label", Code: api.FieldRequired}},
+			},
+			{
+				description:    "label too long",
+				body:           fmt.Sprintf(`{"label": "%s", "key_type": "Ed25519"}`, strings.Repeat("a", api.MaxDeviceLabelLength+1)),
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "label", Code: api.FieldTooLong}},
+			},
+			{
+				description:    "label with invalid characters",
+				body:           `{"label": "test<script>", "key_type": "Ed25519"}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "label", Code: api.FieldInvalidCharacters}},
+			},
+			{
+				description:    "owner with invalid characters and invalid tag",
+				body:           `{"label": "testDevice", "key_type": "Ed25519", "owner": "acme corp", "tags": {"": "empty"}}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "owner", Code: api.FieldInvalidCharacters}, {Field: "tags.", Code: api.FieldRequired}},
+			},
+			{
+				description:    "owner too long",
+				body:           fmt.Sprintf(`{"label": "testDevice", "key_type": "Ed25519", "owner": "%s"}`, strings.Repeat("a", api.MaxDeviceOwnerLength+1)),
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "owner", Code: api.FieldTooLong}},
+			},
+			{
+				description:    "unknown field",
+				body:           `{"label": "testDevice", "key_type": "Ed25519", "location": "somewhere"}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "location", Code: api.FieldUnknown}},
+			},
+			{
+				description:    "field of the wrong type",
+				body:           `{"label": 42, "key_type": "Ed25519"}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemValidationFailed,
+				expectedErrors: []api.FieldError{{Field: "label", Code: api.FieldInvalidType}},
+			},
+			{
+				description:    "trailing data",
+				body:           `{"label": "testDevice", "key_type": "Ed25519"} {}`,
+				expectedStatus: http.StatusBadRequest,
+				expectedCode:   api.ProblemInvalidRequestBody,
+			},
+			{
+				description:    "body too large",
+				body:           fmt.Sprintf(`{"label": "testDevice", "key_type": "Ed25519", "padding": "%s"}`, strings.Repeat("a", api.MaxRequestBodySize)),
+				expectedStatus: http.StatusRequestEntityTooLarge,
+				expectedCode:   api.ProblemRequestTooLarge,
+			},
+		} {
+			t.Run(tc.description, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices", strings.NewReader(tc.body))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				problem := assertProblem(t, response.Result(), tc.expectedStatus, tc.expectedCode)
+				if len(problem.Errors) != len(tc.expectedErrors) {
+					t.Fatalf("expected field errors %v, got %v", tc.expectedErrors, problem.Errors)
+				}
+				for i, expected := range tc.expectedErrors {
+					if problem.Errors[i].Field != expected.Field || problem.Errors[i].Code != expected.Code || problem.Errors[i].Message == "" {
+						t.Errorf("expected field error %v, got %v", expected, problem.Errors[i])
+					}
+				}
+			})
+		}
+	})
+	t.Run("POST /api/v0/devices accepts labels at the length and charset limits", func(t *testing.T) {
+		for _, label := range []string{strings.Repeat("é", api.MaxDeviceLabelLength), "Till 3 - Store #12 (Berlin/Mitte): v1.0_a"} {
+			marshalledDeviceParam, _ := json.Marshal(api.SignatureDeviceParams{Label: label, KeyType: domain.Ed25519})
+			request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices", bytes.NewReader(marshalledDeviceParam))
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			assertResponseStatusCode(t, http.StatusCreated, response.Result().StatusCode)
+		}
+	})
+	t.Run("GET /api/v0/devices/:id returns the device metadata", func(t *testing.T) {
+		marshalledDeviceParam, _ := json.Marshal(api.SignatureDeviceParams{
+			Label:   "testDevice",
+			KeyType: domain.ECDSAP256,
+			Owner:   "tenant-42",
+			Tags:    map[string]string{"site": "berlin"},
+		})
+		request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices", bytes.NewReader(marshalledDeviceParam))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatusCode(t, http.StatusCreated, response.Result().StatusCode)
+		var creationResponse api.SignatureDeviceResponse
+		json.NewDecoder(response.Body).Decode(&creationResponse)
+		deviceId := creationResponse.Data.Id
+
+		getDevice := func() api.SignatureDeviceInfoResponse {
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s", deviceId), nil)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			var devicesResponse api.SignatureDevicesResponse
+			json.NewDecoder(response.Body).Decode(&devicesResponse)
+			if len(devicesResponse.Data.Devices) != 1 {
+				t.Fatalf("expected device %s to be returned, got %+v", deviceId, devicesResponse.Data.Devices)
+			}
+			return devicesResponse.Data.Devices[0]
+		}
+
+		created := getDevice()
+		if created.KeyType != domain.ECDSAP256 || created.Owner != "tenant-42" || created.Tags["site"] != "berlin" {
+			t.Errorf("expected device metadata to be returned, got %+v", created)
+		}
+		if created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) || created.LastSignedAt != nil {
+			t.Errorf("expected new device to be created and never signed, got created at %v, updated at %v, last signed at %v", created.CreatedAt, created.UpdatedAt, created.LastSignedAt)
+		}
+
+		signTransaction(t, server, deviceId, "data")
+		signed := getDevice()
+		if signed.LastSignedAt == nil || signed.LastSignedAt.Before(created.CreatedAt) || signed.UpdatedAt.Before(*signed.LastSignedAt) {
+			t.Errorf("expected signing to record the last signing time, got updated at %v, last signed at %v", signed.UpdatedAt, signed.LastSignedAt)
+		}
+		if !signed.CreatedAt.Equal(created.CreatedAt) {
+			t.Errorf("expected creation time to be kept, got %v", signed.CreatedAt)
+		}
+	})
+	t.Run("POST /api/v0/devices creates devices with configurable key strengths", func(t *testing.T) {
+		for _, keyType := range []domain.KeyGenAlgorithm{domain.RSA3072, domain.ECDSAP256, domain.ECDSAP521, domain.Ed25519} {
+			marshalledDeviceParam, _ := json.Marshal(api.SignatureDeviceParams{Label: "testDevice", KeyType: keyType})
+			request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices", bytes.NewReader(marshalledDeviceParam))
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			responseResult := response.Result()
+			assertResponseStatusCode(t, http.StatusCreated, responseResult.StatusCode)
+
+			var deviceCreationResponse api.SignatureDeviceResponse
+			json.NewDecoder(responseResult.Body).Decode(&deviceCreationResponse)
+			responseResult.Body.Close()
+
+			signTransaction(t, server, deviceCreationResponse.Data.Id, "data")
+		}
+	})
+	t.Run("key failures return 500 Internal Server Error without stopping the server", func(t *testing.T) {
+		// the seeded device key handle is unknown to the key store and its public key is not PEM encoded
+		signingParams, _ := json.Marshal(api.TransactionSigningParams{DataToBeSigned: "test data"})
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/sign", device.Id), bytes.NewReader(signingParams))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertProblem(t, response.Result(), http.StatusInternalServerError, api.ProblemSigningFailed)
+		if bytes.Contains(response.Body.Bytes(), []byte("keyHandle")) {
+			t.Errorf("expected server error detail not to disclose its cause, got %s", response.Body.String())
+		}
+
+		verificationParams, _ := json.Marshal(api.SignatureVerificationParams{
+			DataToBeSigned:   "test data",
+			SignatureCounter: 0,
+			LastSignature:    base64.StdEncoding.EncodeToString([]byte(device.Id)),
+			Signature:        base64.StdEncoding.EncodeToString([]byte("signature")),
+		})
+		request, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/verify", device.Id), bytes.NewReader(verificationParams))
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertProblem(t, response.Result(), http.StatusInternalServerError, api.ProblemKeyDecodingFailed)
+
+		request, _ = http.NewRequest(http.MethodGet, "/api/v0/health", nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatusCode(t, http.StatusOK, response.Result().StatusCode)
+	})
+	t.Run("PATCH /api/v0/devices/:id transitions the device lifecycle state", func(t *testing.T) {
+		deviceId := createDevice(t, server, domain.Ed25519)
+		signTransaction(t, server, deviceId, "data")
+
+		for _, tc := range []struct {
+			description    string
+			body           string
+			expectedStatus int
+			expectedState  domain.DeviceState
+			expectedCode   api.ProblemCode
+		}{
+			{"suspend", `{"state": "SUSPENDED"}`, http.StatusOK, domain.DeviceSuspended, ""},
+			{"reactivate", `{"state": "ACTIVE"}`, http.StatusOK, domain.DeviceActive, ""},
+			{"missing state", `{"reason": "no state"}`, http.StatusBadRequest, "", api.ProblemValidationFailed},
+			{"unknown state", `{"state": "DESTROYED"}`, http.StatusBadRequest, "", api.ProblemValidationFailed},
+			{"retire without reason", `{"state": "RETIRED"}`, http.StatusBadRequest, "", api.ProblemValidationFailed},
+			{"retire", `{"state": "RETIRED", "reason": "register decommissioned"}`, http.StatusOK, domain.DeviceRetired, ""},
+			{"reactivate retired device", `{"state": "ACTIVE"}`, http.StatusConflict, "", api.ProblemInvalidTransition},
+		} {
+			t.Run(tc.description, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v0/devices/%s", deviceId), strings.NewReader(tc.body))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				if tc.expectedCode != "" {
+					assertProblem(t, response.Result(), tc.expectedStatus, tc.expectedCode)
+					return
+				}
+				assertResponseStatusCode(t, tc.expectedStatus, response.Result().StatusCode)
+				var deviceResponse api.SignatureDeviceInfoDataResponse
+				json.NewDecoder(response.Body).Decode(&deviceResponse)
+				if deviceResponse.Data.Id != deviceId || deviceResponse.Data.State != tc.expectedState {
+					t.Errorf("expected device %s to be %s, got %+v", deviceId, tc.expectedState, deviceResponse.Data)
+				}
+			})
+		}
+
+		request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s", deviceId), nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var devicesResponse api.SignatureDevicesResponse
+		json.NewDecoder(response.Body).Decode(&devicesResponse)
+		retirement := devicesResponse.Data.Devices[0].Retirement
+		if retirement == nil || retirement.Reason != "register decommissioned" || retirement.RetiredAt.IsZero() {
+			t.Errorf("expected device retirement to be returned, got %+v", retirement)
+		}
+	})
+	t.Run("POST /api/v0/devices/:id/sign returns 409 Conflict for devices which are not active", func(t *testing.T) {
+		deviceId := createDevice(t, server, domain.ECDSAP256)
+		request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v0/devices/%s", deviceId), strings.NewReader(`{"state": "SUSPENDED"}`))
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		signingParams, _ := json.Marshal(api.TransactionSigningParams{DataToBeSigned: "data"})
+		request, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/sign", deviceId), bytes.NewReader(signingParams))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertProblem(t, response.Result(), http.StatusConflict, api.ProblemDeviceNotActive)
+	})
+	t.Run("PATCH /api/v0/devices/:id returns 404 for unknown device", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPatch, "/api/v0/devices/unknown", strings.NewReader(`{"state": "SUSPENDED"}`))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertProblem(t, response.Result(), http.StatusNotFound, api.ProblemDeviceNotFound)
+	})
+	t.Run("POST /api/v0/devices/:id/rotate rotates the device key", func(t *testing.T) {
+		deviceId := createDevice(t, server, domain.ECDSAP256)
+		signTransaction(t, server, deviceId, "before rotation")
+
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/rotate", deviceId), nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertResponseStatusCode(t, http.StatusOK, response.Result().StatusCode)
+		var deviceResponse api.SignatureDeviceInfoDataResponse
+		json.NewDecoder(response.Body).Decode(&deviceResponse)
+		keyVersions := deviceResponse.Data.KeyVersions
+		if deviceResponse.Data.KeyVersion != 2 || deviceResponse.Data.Counter != 1 || len(keyVersions) != 2 || keyVersions[1].ActiveFromCounter != 1 {
+			t.Errorf("expected key version 2 active from counter 1, got %+v", deviceResponse.Data)
+		}
+
+		signingResponse := signTransaction(t, server, deviceId, "after rotation")
+		if signingResponse.Data.KeyVersion != 2 || !strings.HasPrefix(signingResponse.Data.SignedData, "1_after rotation_") {
+			t.Errorf("expected signature 1 with key version 2, got %+v", signingResponse.Data)
+		}
+
+		publicKeys := map[string]string{}
+		for _, version := range []string{"", "?version=1", "?version=2"} {
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/public-key%s", deviceId, version), nil)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			assertResponseStatusCode(t, http.StatusOK, response.Result().StatusCode)
+			publicKeys[version] = response.Body.String()
+		}
+		if publicKeys[""] != publicKeys["?version=2"] || publicKeys["?version=1"] == publicKeys["?version=2"] {
+			t.Errorf("expected the current key to be version 2 and version 1 to be kept")
+		}
+
+		for _, tc := range []struct {
+			version     string
+			expectedKid string
+		}{
+			{"", deviceId + ":2"},
+			{"?version=1", deviceId + ":1"},
+		} {
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/public-key%s", deviceId, tc.version), nil)
+			request.Header.Set("Accept", api.ContentTypeJWK)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			var jwk crypto.JWK
+			json.NewDecoder(response.Body).Decode(&jwk)
+			if jwk.Kid != tc.expectedKid {
+				t.Errorf("expected JWK with kid %s, got %s", tc.expectedKid, jwk.Kid)
+			}
+		}
+
+		request, _ = http.NewRequest(http.MethodGet, "/api/v0/jwks", nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var jwkSet crypto.JWKSet
+		json.NewDecoder(response.Body).Decode(&jwkSet)
+		published := map[string]bool{}
+		for _, jwk := range jwkSet.Keys {
+			published[jwk.Kid] = true
+		}
+		if !published[deviceId+":1"] || !published[deviceId+":2"] {
+			t.Errorf("expected both key versions of the rotated device in the JWK set")
+		}
+
+		request, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/audit", deviceId), nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var auditResponse api.SignatureChainAuditResponse
+		json.NewDecoder(response.Body).Decode(&auditResponse)
+		if auditResponse.Data.BrokenLink != nil || auditResponse.Data.VerifiedSignatures != 2 {
+			t.Errorf("expected signature chain to be intact across the rotation, got %+v", auditResponse.Data)
+		}
+	})
+	t.Run("GET /api/v0/devices/:id/public-key returns problems for invalid key versions", func(t *testing.T) {
+		for _, tc := range []struct {
+			version        string
+			expectedStatus int
+			expectedCode   api.ProblemCode
+		}{
+			{"0", http.StatusBadRequest, api.ProblemInvalidParameter},
+			{"first", http.StatusBadRequest, api.ProblemInvalidParameter},
+			{"2", http.StatusNotFound, api.ProblemKeyVersionNotFound},
+		} {
+			t.Run(tc.version, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/public-key?version=%s", device.Id, tc.version), nil)
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				assertProblem(t, response.Result(), tc.expectedStatus, tc.expectedCode)
+			})
+		}
+	})
+	t.Run("POST /api/v0/devices/:id/rotate returns 404 for unknown device", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices/unknown/rotate", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertProblem(t, response.Result(), http.StatusNotFound, api.ProblemDeviceNotFound)
+	})
+	t.Run("PATCH /api/v0/devices/:id updates the device label and tags", func(t *testing.T) {
+		deviceId := createDevice(t, server, domain.Ed25519)
+
+		for _, tc := range []struct {
+			description   string
+			body          string
+			expectedLabel string
+			expectedTags  map[string]string
+			expectedCode  api.ProblemCode
+		}{
+			{"rename", `{"label": "front desk"}`, "front desk", map[string]string{}, ""},
+			{"tag", `{"tags": {"site": "berlin", "till": "3"}}`, "front desk", map[string]string{"site": "berlin", "till": "3"}, ""},
+			{"replace tags and suspend", `{"tags": {"site": "munich"}, "state": "SUSPENDED"}`, "front desk", map[string]string{"site": "munich"}, ""},
+			{"clear tags", `{"tags": {}}`, "front desk", map[string]string{}, ""},
+			{"blank label", `{"label": " "}`, "", nil, api.ProblemValidationFailed},
+			{"invalid tag key", `{"tags": {"site id": "1"}}`, "", nil, api.ProblemValidationFailed},
+			{"reason without state", `{"label": "till", "reason": "renamed"}`, "", nil, api.ProblemValidationFailed},
+		} {
+			t.Run(tc.description, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v0/devices/%s", deviceId), strings.NewReader(tc.body))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				if tc.expectedCode != "" {
+					assertProblem(t, response.Result(), http.StatusBadRequest, tc.expectedCode)
+					return
+				}
+				assertResponseStatusCode(t, http.StatusOK, response.Result().StatusCode)
+				var deviceResponse api.SignatureDeviceInfoDataResponse
+				json.NewDecoder(response.Body).Decode(&deviceResponse)
+				if deviceResponse.Data.Label != tc.expectedLabel || !reflect.DeepEqual(deviceResponse.Data.Tags, tc.expectedTags) {
+					t.Errorf("expected device %q tagged %v, got %q tagged %v", tc.expectedLabel, tc.expectedTags, deviceResponse.Data.Label, deviceResponse.Data.Tags)
+				}
+			})
+		}
+	})
+	t.Run("DELETE /api/v0/devices/:id soft deletes the device", func(t *testing.T) {
+		deviceId := createDevice(t, server, domain.ECDSAP256)
+		signingResponse := signTransaction(t, server, deviceId, "data")
+
+		request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v0/devices/%s", deviceId), nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertResponseStatusCode(t, http.StatusNoContent, response.Result().StatusCode)
+
+		signingParams, _ := json.Marshal(api.TransactionSigningParams{DataToBeSigned: "data"})
+		request, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/sign", deviceId), bytes.NewReader(signingParams))
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertProblem(t, response.Result(), http.StatusGone, api.ProblemDeviceDeleted)
+
+		request, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/api/v0/devices/%s", deviceId), strings.NewReader(`{"label": "deleted"}`))
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertProblem(t, response.Result(), http.StatusGone, api.ProblemDeviceDeleted)
+
+		verificationParams, _ := json.Marshal(api.SignatureVerificationParams{
+			DataToBeSigned:   "data",
+			SignatureCounter: 0,
+			LastSignature:    base64.StdEncoding.EncodeToString([]byte(deviceId)),
+			Signature:        signingResponse.Data.Signature,
+		})
+		request, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/verify", deviceId), bytes.NewReader(verificationParams))
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var verificationResponse api.SignatureVerificationResponse
+		json.NewDecoder(response.Body).Decode(&verificationResponse)
+		if !verificationResponse.Data.Valid {
+			t.Errorf("expected signature of deleted device to verify")
+		}
+
+		request, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/devices/%s", deviceId), nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var devicesResponse api.SignatureDevicesResponse
+		json.NewDecoder(response.Body).Decode(&devicesResponse)
+		if len(devicesResponse.Data.Devices) != 1 || devicesResponse.Data.Devices[0].DeletedAt == nil {
+			t.Errorf("expected deleted device to be returned with its deletion time, got %+v", devicesResponse.Data.Devices)
+		}
+
+		request, _ = http.NewRequest(http.MethodGet, "/api/v0/devices/", nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		json.NewDecoder(response.Body).Decode(&devicesResponse)
+		for _, listedDevice := range devicesResponse.Data.Devices {
+			if listedDevice.Id == deviceId {
+				t.Errorf("expected deleted device not to be listed")
+			}
+		}
+	})
+	t.Run("DELETE /api/v0/devices/:id returns 404 for unknown device", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/api/v0/devices/unknown", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertProblem(t, response.Result(), http.StatusNotFound, api.ProblemDeviceNotFound)
+	})
+	t.Run("GET /api/v0/devices/ filters, sorts and pages devices", func(t *testing.T) {
+		for i, signatures := range []int{2, 0, 1} {
+			marshalledDeviceParam, _ := json.Marshal(api.SignatureDeviceParams{
+				Label:   fmt.Sprintf("listed-%d", i),
+				KeyType: domain.Ed25519,
+				Tags:    map[string]string{"batch": "listing"},
+			})
+			request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices", bytes.NewReader(marshalledDeviceParam))
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			var creationResponse api.SignatureDeviceResponse
+			json.NewDecoder(response.Body).Decode(&creationResponse)
+			for j := 0; j < signatures; j++ {
+				signTransaction(t, server, creationResponse.Data.Id, "data")
+			}
+		}
+		listDevices := func(query string) api.SignatureDeviceInfoListResponse {
+			request, _ := http.NewRequest(http.MethodGet, "/api/v0/devices/?"+query, nil)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			assertResponseStatusCode(t, http.StatusOK, response.Result().StatusCode)
+			var devicesResponse api.SignatureDevicesResponse
+			json.NewDecoder(response.Body).Decode(&devicesResponse)
+			return devicesResponse.Data
+		}
+		labels := func(devices []api.SignatureDeviceInfoResponse) []string {
+			labels := []string{}
+			for _, device := range devices {
+				labels = append(labels, device.Label)
+			}
+			return labels
+		}
+
+		devices := listDevices("tags.batch=listing&sort=-counter")
+		if got := labels(devices.Devices); !reflect.DeepEqual(got, []string{"listed-0", "listed-2", "listed-1"}) || devices.NextCursor != "" {
+			t.Errorf("expected devices by descending counter, got %v", got)
+		}
+		devices = listDevices("tags.batch=listing&label_prefix=listed-1&key_type=Ed25519&state=ACTIVE")
+		if got := labels(devices.Devices); !reflect.DeepEqual(got, []string{"listed-1"}) {
+			t.Errorf("expected filtered devices, got %v", got)
+		}
+
+		firstPage := listDevices("tags.batch=listing&sort=counter&limit=2")
+		if got := labels(firstPage.Devices); !reflect.DeepEqual(got, []string{"listed-1", "listed-2"}) || firstPage.NextCursor == "" {
+			t.Errorf("expected first page of devices by counter with a next cursor, got %v", got)
+		}
+		secondPage := listDevices("tags.batch=listing&sort=counter&limit=2&cursor=" + url.QueryEscape(firstPage.NextCursor))
+		if got := labels(secondPage.Devices); !reflect.DeepEqual(got, []string{"listed-0"}) || secondPage.NextCursor != "" {
+			t.Errorf("expected last page of devices by counter, got %v", got)
+		}
+	})
+	t.Run("GET /api/v0/devices/ returns 400 for invalid query parameters", func(t *testing.T) {
+		for _, query := range []string{"sort=label", "limit=0", fmt.Sprintf("limit=%d", api.MaxDevicesPageSize+1), "state=GONE", "key_type=DSA", "cursor=unknown"} {
+			t.Run(query, func(t *testing.T) {
+				request, _ := http.NewRequest(http.MethodGet, "/api/v0/devices/?"+query, nil)
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				assertProblem(t, response.Result(), http.StatusBadRequest, api.ProblemInvalidParameter)
+			})
+		}
+	})
+	t.Run("errors are written as problem details with stable codes", func(t *testing.T) {
+		for _, tc := range []struct {
+			method         string
+			path           string
+			body           string
+			expectedStatus int
+			expectedCode   api.ProblemCode
+		}{
+			{http.MethodGet, "/api/v0/unknown", "", http.StatusNotFound, api.ProblemNotFound},
+			{http.MethodGet, "/api/v0/devices/unknown", "", http.StatusNotFound, api.ProblemDeviceNotFound},
+			{http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/unknown", device.Id), "", http.StatusNotFound, api.ProblemNotFound},
+			{http.MethodPut, "/api/v0/devices", "", http.StatusMethodNotAllowed, api.ProblemMethodNotAllowed},
+			{http.MethodPost, "/api/v0/devices", "{", http.StatusBadRequest, api.ProblemInvalidRequestBody},
+			{http.MethodGet, fmt.Sprintf("/api/v0/devices/%s/signatures?from=-1", device.Id), "", http.StatusBadRequest, api.ProblemInvalidParameter},
+		} {
+			t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+				request, _ := http.NewRequest(tc.method, tc.path, bytes.NewReader([]byte(tc.body)))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				assertProblem(t, response.Result(), tc.expectedStatus, tc.expectedCode)
+			})
+		}
+	})
+}
+
+func createDevice(t *testing.T, server *api.Server, keyType domain.KeyGenAlgorithm) string {
+	t.Helper()
+
+	marshalledDeviceParam, _ := json.Marshal(api.SignatureDeviceParams{Label: "testDevice", KeyType: keyType})
+	request, _ := http.NewRequest(http.MethodPost, "/api/v0/devices", bytes.NewReader(marshalledDeviceParam))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	responseResult := response.Result()
+	assertResponseStatusCode(t, http.StatusCreated, responseResult.StatusCode)
+
+	defer responseResult.Body.Close()
+	var deviceCreationResponse api.SignatureDeviceResponse
+	json.NewDecoder(responseResult.Body).Decode(&deviceCreationResponse)
+	return deviceCreationResponse.Data.Id
+}
+
+func signTransaction(t *testing.T, server *api.Server, deviceId string, dataToBeSigned string) api.TransactionSigningResponse {
+	t.Helper()
+
+	signingParams, _ := json.Marshal(api.TransactionSigningParams{DataToBeSigned: dataToBeSigned})
+	request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v0/devices/%s/sign", deviceId), bytes.NewReader(signingParams))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	responseResult := response.Result()
+	assertResponseStatusCode(t, http.StatusOK, responseResult.StatusCode)
+
+	defer responseResult.Body.Close()
+	var signingResponse api.TransactionSigningResponse
+	json.NewDecoder(responseResult.Body).Decode(&signingResponse)
+
+	if signingResponse.Data.Signature == "" {
+		t.Errorf("expected transaction signing response to return a signature")
+	}
+	return signingResponse
+}
+
+func intPointer(i int) *int {
+	return &i
 }
 
 func assertResponseStatusCode(t *testing.T, expected int, got int) {
@@ -132,3 +1088,22 @@ func assertResponseStatusCode(t *testing.T, expected int, got int) {
 		t.Errorf("expected %d HTTP status code, got %d", expected, got)
 	}
 }
+
+func assertProblem(t *testing.T, response *http.Response, expectedStatus int, expectedCode api.ProblemCode) api.Problem {
+	t.Helper()
+
+	assertResponseStatusCode(t, expectedStatus, response.StatusCode)
+	if contentType := response.Header.Get("Content-Type"); contentType != api.ContentTypeProblemJSON {
+		t.Errorf("expected %s content type, got %s", api.ContentTypeProblemJSON, contentType)
+	}
+
+	defer response.Body.Close()
+	var problem api.Problem
+	if err := json.NewDecoder(response.Body).Decode(&problem); err != nil {
+		t.Fatalf("an error occurred decoding the problem, error: %s", err.Error())
+	}
+	if problem.Status != expectedStatus || problem.Code != expectedCode || problem.Title != http.StatusText(expectedStatus) {
+		t.Errorf("expected %d %s problem, got %+v", expectedStatus, expectedCode, problem)
+	}
+	return problem
+}
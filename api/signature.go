@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultSignaturesPageSize = 100
+	MaxSignaturesPageSize     = 1000
+)
+
+type SignatureRecordResponse struct {
+	Counter    int       `json:"counter"`
+	DataHash   string    `json:"data_hash"`
+	SignedData string    `json:"signed_data"`
+	Signature  string    `json:"signature"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type SignatureRecordListResponse struct {
+	Signatures []SignatureRecordResponse `json:"signatures"`
+	NextFrom   *int                      `json:"next_from,omitempty"`
+}
+
+type SignatureRecordsResponse struct {
+	Data SignatureRecordListResponse `json:"data"`
+}
+
+type ChainBreakResponse struct {
+	Counter int    `json:"counter"`
+	Reason  string `json:"reason"`
+}
+
+type AuditReportResponse struct {
+	DeviceId           string              `json:"device_id"`
+	Valid              bool                `json:"valid"`
+	VerifiedSignatures int                 `json:"verified_signatures"`
+	BrokenLink         *ChainBreakResponse `json:"broken_link"`
+}
+
+type SignatureChainAuditResponse struct {
+	Data AuditReportResponse `json:"data"`
+}
+
+// HandleSignatureRetrieval lists the signature ledger of a device, ordered by counter.
+// The counter range is selected with the "from" (inclusive) and "to" (exclusive) query
+// parameters, and pages hold at most "limit" records; when more records are available
+// in the range, "next_from" holds the counter the following page starts from.
+func (s *Server) HandleSignatureRetrieval(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+	query := request.URL.Query()
+
+	fromCounter, err := parseQueryInt(query.Get("from"), 0)
+	if err != nil || fromCounter < 0 {
+		WriteProblem(response, http.StatusBadRequest, ProblemInvalidParameter, "from must be a non negative integer")
+		return
+	}
+	toCounter, err := parseQueryInt(query.Get("to"), -1)
+	if err != nil || (query.Has("to") && toCounter < fromCounter) {
+		WriteProblem(response, http.StatusBadRequest, ProblemInvalidParameter, "to must be an integer not lower than from")
+		return
+	}
+	limit, err := parseQueryInt(query.Get("limit"), DefaultSignaturesPageSize)
+	if err != nil || limit < 1 || limit > MaxSignaturesPageSize {
+		WriteProblem(response, http.StatusBadRequest, ProblemInvalidParameter, fmt.Sprintf("limit must be an integer between 1 and %d", MaxSignaturesPageSize))
+		return
+	}
+
+	pageTo := fromCounter + limit
+	if toCounter >= 0 && toCounter < pageTo {
+		pageTo = toCounter
+	}
+	records, err := s.signatureDeviceService.FindSignatures(deviceId, fromCounter, pageTo)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	signatures := SignatureRecordListResponse{Signatures: []SignatureRecordResponse{}}
+	for _, record := range records {
+		signatures.Signatures = append(signatures.Signatures, SignatureRecordResponse{
+			Counter:    record.Counter,
+			DataHash:   record.DataHash,
+			SignedData: record.SignedData,
+			Signature:  base64.StdEncoding.EncodeToString(record.Signature),
+			Timestamp:  record.Timestamp,
+		})
+	}
+	if len(records) == pageTo-fromCounter && pageTo != toCounter {
+		signatures.NextFrom = &pageTo
+	}
+
+	WriteAPIResponse(response, http.StatusOK, signatures)
+}
+
+// parseQueryInt parses an integer query parameter, falling back to defaultValue when missing.
+func parseQueryInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// HandleSignatureChainAudit audits the signature chain of a device, reporting its first broken link if any.
+func (s *Server) HandleSignatureChainAudit(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+	report, err := s.signatureDeviceService.AuditSignatureChain(deviceId)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	auditReport := AuditReportResponse{
+		DeviceId:           report.DeviceId,
+		Valid:              report.Valid(),
+		VerifiedSignatures: report.VerifiedSignatures,
+	}
+	if report.BrokenLink != nil {
+		auditReport.BrokenLink = &ChainBreakResponse{Counter: report.BrokenLink.Counter, Reason: report.BrokenLink.Reason}
+	}
+	WriteAPIResponse(response, http.StatusOK, auditReport)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+type TransactionSigningParams struct {
+	DataToBeSigned string `json:"data_to_be_signed"`
+}
+
+type SignatureVerificationParams struct {
+	DataToBeSigned   string `json:"data_to_be_signed"`
+	SignatureCounter int    `json:"signature_counter"`
+	LastSignature    string `json:"last_signature"`
+	Signature        string `json:"signature"`
+}
+
+type TransactionSignatureResponse struct {
+	Signature  string `json:"signature"`
+	SignedData string `json:"signed_data"`
+	KeyVersion int    `json:"key_version"`
+}
+
+type TransactionSigningResponse struct {
+	Data TransactionSignatureResponse `json:"data"`
+}
+
+type SignatureVerificationResult struct {
+	Valid      bool   `json:"valid"`
+	SignedData string `json:"signed_data"`
+}
+
+type SignatureVerificationResponse struct {
+	Data SignatureVerificationResult `json:"data"`
+}
+
+func (s *Server) HandleTransactionSigning(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+
+	var transactionSigningParams TransactionSigningParams
+	if err := decodeRequestBody(response, request, MaxTransactionRequestBodySize, &transactionSigningParams); err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	transaction, err := s.signatureDeviceService.SignTransaction(deviceId, []byte(transactionSigningParams.DataToBeSigned))
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, TransactionSignatureResponse{
+		Signature:  base64.StdEncoding.EncodeToString(transaction.Signature),
+		SignedData: transaction.SignedData,
+		KeyVersion: transaction.KeyVersion,
+	})
+}
+
+func (s *Server) HandleSignatureVerification(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		WriteProblem(response, http.StatusMethodNotAllowed, ProblemMethodNotAllowed, "")
+		return
+	}
+
+	deviceId, _ := parseSignatureDevicePath(request.URL.Path)
+
+	var verificationParams SignatureVerificationParams
+	if err := decodeRequestBody(response, request, MaxTransactionRequestBodySize, &verificationParams); err != nil {
+		WriteError(response, err)
+		return
+	}
+	lastSignature, signature, err := verificationParams.decodeSignatures()
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	dataToBeSigned := []byte(verificationParams.DataToBeSigned)
+	valid, err := s.signatureDeviceService.VerifySignature(deviceId, verificationParams.SignatureCounter, dataToBeSigned, lastSignature, signature)
+	if err != nil {
+		WriteError(response, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, SignatureVerificationResult{
+		Valid:      valid,
+		SignedData: crypto.SignatureInput(verificationParams.SignatureCounter, dataToBeSigned, string(lastSignature)),
+	})
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+)
+
+const (
+	// MaxRequestBodySize is the maximum size, in bytes, of the device management request bodies.
+	MaxRequestBodySize = 4 << 10
+	// MaxTransactionRequestBodySize is the maximum size, in bytes, of the signing and verification
+	// request bodies, which carry the data to be signed, e.g. a whole receipt, along with signatures.
+	MaxTransactionRequestBodySize = 1 << 20
+	// MaxDeviceLabelLength is the maximum length, in characters, of signature device labels.
+	MaxDeviceLabelLength = 64
+	// MaxRetirementReasonLength is the maximum length, in characters, of device retirement reasons.
+	MaxRetirementReasonLength = 256
+	// MaxDeviceTags is the maximum number of tags of a signature device.
+	MaxDeviceTags = 32
+	// MaxDeviceOwnerLength is the maximum length, in characters, of signature device owners.
+	MaxDeviceOwnerLength = 64
+	// MaxTagKeyLength and MaxTagValueLength are the maximum lengths, in characters, of device tag keys and values.
+	MaxTagKeyLength   = 64
+	MaxTagValueLength = 256
+)
+
+// deviceLabelPunctuation are the characters allowed in device labels besides letters,
+// digits and spaces, tagKeyPunctuation the ones allowed in tag keys and owners besides
+// letters and digits.
+const (
+	deviceLabelPunctuation = "-_.:#/()"
+	tagKeyPunctuation      = "-_.:/"
+)
+
+// Codes of the FieldError of invalid fields.
+const (
+	FieldRequired          ProblemCode = "required"
+	FieldTooLong           ProblemCode = "too_long"
+	FieldInvalidCharacters ProblemCode = "invalid_characters"
+	FieldInvalidType       ProblemCode = "invalid_type"
+	FieldInvalidValue      ProblemCode = "invalid_value"
+	FieldUnknown           ProblemCode = "unknown_field"
+)
+
+// FieldError describes why a field of a request body is not valid.
+type FieldError struct {
+	Field   string      `json:"field"`
+	Code    ProblemCode `json:"code"`
+	Message string      `json:"message"`
+}
+
+// ValidationError lists the invalid fields of a request body.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// MalformedRequestBodyError is returned for request bodies which are not a JSON object.
+type MalformedRequestBodyError string
+
+func (e MalformedRequestBodyError) Error() string {
+	return string(e)
+}
+
+// decodeRequestBody decodes the JSON object of the request body into v, refusing bodies
+// larger than limit bytes and holding unknown fields. Fields of the wrong type and unknown
+// fields are returned as a ValidationError.
+func decodeRequestBody(response http.ResponseWriter, request *http.Request, limit int64, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(response, request.Body, limit))
+	decoder.DisallowUnknownFields()
+
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	err := decoder.Decode(v)
+	switch {
+	case err == nil:
+	case errors.As(err, &maxBytesErr):
+		return err
+	case errors.As(err, &typeErr):
+		return ValidationError{{Field: typeErr.Field, Code: FieldInvalidType, Message: fmt.Sprintf("%s cannot be a JSON %s", typeErr.Field, typeErr.Value)}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return ValidationError{{Field: field, Code: FieldUnknown, Message: fmt.Sprintf("%s is not a known field", field)}}
+	default:
+		return MalformedRequestBodyError("request body cannot be decoded: " + err.Error())
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		if errors.As(err, &maxBytesErr) {
+			return err
+		}
+		return MalformedRequestBodyError("request body must hold a single JSON object")
+	}
+	return nil
+}
+
+// Validate returns a ValidationError listing the invalid fields of the params, if any: the
+// key type is required and must be supported, the label is required, at most
+// MaxDeviceLabelLength characters long and made of letters, digits, spaces and -_.:#/().
+// The owner and tags are optional, the owner made of at most MaxDeviceOwnerLength letters,
+// digits and -_.:/ and the tags following the rules of device updates.
+func (p SignatureDeviceParams) Validate() error {
+	var fieldErrors ValidationError
+
+	if p.KeyType == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "key_type", Code: FieldRequired, Message: "key_type is required"})
+	} else if _, err := p.KeyType.Parameters(); err != nil {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "key_type",
+			Code:    FieldInvalidValue,
+			Message: fmt.Sprintf("key_type %q is not supported, supported key types are listed at /api/v0/algorithms", p.KeyType),
+		})
+	}
+
+	if fieldError := validateDeviceLabel(p.Label); fieldError != nil {
+		fieldErrors = append(fieldErrors, *fieldError)
+	}
+	switch {
+	case utf8.RuneCountInString(p.Owner) > MaxDeviceOwnerLength:
+		fieldErrors = append(fieldErrors, FieldError{Field: "owner", Code: FieldTooLong, Message: fmt.Sprintf("owner must be at most %d characters long", MaxDeviceOwnerLength)})
+	case strings.IndexFunc(p.Owner, func(r rune) bool { return !validTagKeyRune(r) }) >= 0:
+		fieldErrors = append(fieldErrors, FieldError{Field: "owner", Code: FieldInvalidCharacters, Message: "owner must only hold letters, digits and " + tagKeyPunctuation})
+	}
+	fieldErrors = append(fieldErrors, validateDeviceTags(p.Tags)...)
+
+	if len(fieldErrors) > 0 {
+		return fieldErrors
+	}
+	return nil
+}
+
+// Validate returns a ValidationError listing the invalid fields of the params, if any. The
+// label follows the rules of device creation and the tags are at most MaxDeviceTags, with
+// keys of at most MaxTagKeyLength letters, digits and -_.:/ and values of at most
+// MaxTagValueLength characters. The state must be one of the domain.DeviceStates and the
+// reason, only accepted along with a state, is required to retire a device and at most
+// MaxRetirementReasonLength characters long.
+func (p SignatureDeviceUpdateParams) Validate() error {
+	var fieldErrors ValidationError
+
+	if p.Label != nil {
+		if fieldError := validateDeviceLabel(*p.Label); fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+		}
+	}
+	fieldErrors = append(fieldErrors, validateDeviceTags(p.Tags)...)
+
+	if p.State != "" && !p.State.Valid() {
+		fieldErrors = append(fieldErrors, FieldError{Field: "state", Code: FieldInvalidValue, Message: fmt.Sprintf("state must be one of %v", domain.DeviceStates())})
+	}
+
+	switch {
+	case p.State == "" && p.Reason != "":
+		fieldErrors = append(fieldErrors, FieldError{Field: "reason", Code: FieldInvalidValue, Message: "reason is only accepted along with a state"})
+	case p.State == domain.DeviceRetired && strings.TrimSpace(p.Reason) == "":
+		fieldErrors = append(fieldErrors, FieldError{Field: "reason", Code: FieldRequired, Message: "reason is required to retire a device"})
+	case utf8.RuneCountInString(p.Reason) > MaxRetirementReasonLength:
+		fieldErrors = append(fieldErrors, FieldError{Field: "reason", Code: FieldTooLong, Message: fmt.Sprintf("reason must be at most %d characters long", MaxRetirementReasonLength)})
+	}
+
+	if len(fieldErrors) > 0 {
+		return fieldErrors
+	}
+	return nil
+}
+
+// validateDeviceLabel checks that label is not blank, at most MaxDeviceLabelLength
+// characters long and made of letters, digits, spaces and -_.:#/().
+func validateDeviceLabel(label string) *FieldError {
+	switch {
+	case strings.TrimSpace(label) == "":
+		return &FieldError{Field: "label", Code: FieldRequired, Message: "label is required"}
+	case utf8.RuneCountInString(label) > MaxDeviceLabelLength:
+		return &FieldError{Field: "label", Code: FieldTooLong, Message: fmt.Sprintf("label must be at most %d characters long", MaxDeviceLabelLength)}
+	case strings.IndexFunc(label, func(r rune) bool { return !validDeviceLabelRune(r) }) >= 0:
+		return &FieldError{Field: "label", Code: FieldInvalidCharacters, Message: "label must only hold letters, digits, spaces and " + deviceLabelPunctuation}
+	}
+	return nil
+}
+
+func validDeviceLabelRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || strings.ContainsRune(deviceLabelPunctuation, r)
+}
+
+// validateDeviceTags checks the number of tags and their keys and values, reporting the
+// invalid tags as tags.<key> fields, in key order.
+func validateDeviceTags(tags map[string]string) []FieldError {
+	if len(tags) > MaxDeviceTags {
+		return []FieldError{{Field: "tags", Code: FieldTooLong, Message: fmt.Sprintf("tags must be at most %d", MaxDeviceTags)}}
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var fieldErrors []FieldError
+	for _, key := range keys {
+		field := "tags." + key
+		switch {
+		case key == "":
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Code: FieldRequired, Message: "tag keys must not be empty"})
+		case utf8.RuneCountInString(key) > MaxTagKeyLength:
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Code: FieldTooLong, Message: fmt.Sprintf("tag keys must be at most %d characters long", MaxTagKeyLength)})
+		case strings.IndexFunc(key, func(r rune) bool { return !validTagKeyRune(r) }) >= 0:
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Code: FieldInvalidCharacters, Message: "tag keys must only hold letters, digits and " + tagKeyPunctuation})
+		case utf8.RuneCountInString(tags[key]) > MaxTagValueLength:
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Code: FieldTooLong, Message: fmt.Sprintf("tag values must be at most %d characters long", MaxTagValueLength)})
+		}
+	}
+	return fieldErrors
+}
+
+func validTagKeyRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(tagKeyPunctuation, r)
+}
+
+// decodeSignatures decodes the base64 encoded signatures of the params, returning a
+// ValidationError listing the ones which are not.
+func (p SignatureVerificationParams) decodeSignatures() ([]byte, []byte, error) {
+	var fieldErrors ValidationError
+
+	lastSignature, err := base64.StdEncoding.DecodeString(p.LastSignature)
+	if err != nil {
+		fieldErrors = append(fieldErrors, FieldError{Field: "last_signature", Code: FieldInvalidValue, Message: "last_signature is not base64 encoded"})
+	}
+	signature, err := base64.StdEncoding.DecodeString(p.Signature)
+	if err != nil {
+		fieldErrors = append(fieldErrors, FieldError{Field: "signature", Code: FieldInvalidValue, Message: "signature is not base64 encoded"})
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, nil, fieldErrors
+	}
+	return lastSignature, signature, nil
+}
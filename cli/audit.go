@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PaoloModica/signing-service-challenge-go/api"
+)
+
+// ChainBrokenError is returned by RunAudit when the audited signature chain is broken.
+type ChainBrokenError string
+
+func (e ChainBrokenError) Error() string {
+	return string(e)
+}
+
+// RunAudit implements the "audit" subcommand: it requests the signature chain audit
+// of a device to a running signature service and prints its outcome.
+//
+//	signature-service audit [-server http://localhost:8080] <device-id>
+func RunAudit(args []string, output io.Writer) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	flags.SetOutput(output)
+	server := flags.String("server", "http://localhost:8080", "signature service base URL")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: audit [-server URL] <device-id>")
+	}
+	deviceId := flags.Arg(0)
+
+	response, err := http.Get(fmt.Sprintf("%s/api/v0/devices/%s/audit", strings.TrimSuffix(*server, "/"), url.PathEscape(deviceId)))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var problem api.Problem
+		json.NewDecoder(response.Body).Decode(&problem)
+		return fmt.Errorf("audit of device %s failed with status %d: %s %s", deviceId, response.StatusCode, problem.Code, problem.Detail)
+	}
+
+	var auditResponse api.SignatureChainAuditResponse
+	if err := json.NewDecoder(response.Body).Decode(&auditResponse); err != nil {
+		return err
+	}
+	report := auditResponse.Data
+
+	fmt.Fprintf(output, "device %s: %d signatures verified\n", report.DeviceId, report.VerifiedSignatures)
+	if report.BrokenLink != nil {
+		return ChainBrokenError(fmt.Sprintf("signature chain broken at counter %d: %s", report.BrokenLink.Counter, report.BrokenLink.Reason))
+	}
+	fmt.Fprintln(output, "signature chain is intact")
+	return nil
+}
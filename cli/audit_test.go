@@ -0,0 +1,68 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/api"
+	"github.com/PaoloModica/signing-service-challenge-go/cli"
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+	test_utils "github.com/PaoloModica/signing-service-challenge-go/internal"
+)
+
+func TestRunAudit(t *testing.T) {
+	store := test_utils.StubSignatureDeviceStore{
+		Store: map[string]*domain.SignatureDevice{},
+	}
+	signatures := test_utils.StubSignatureRecordStore{
+		Records: map[string][]*domain.SignatureRecord{},
+	}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &signatures, test_utils.NewStubKeyStore(t))
+
+	server := api.NewServer("", service)
+	server.InitializeRouter()
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	deviceId, _ := service.Create("auditedDevice", domain.ECC, domain.DeviceMetadata{})
+	for i := 0; i < 3; i++ {
+		service.SignTransaction(deviceId, []byte("test data"))
+	}
+
+	t.Run("audit intact signature chain", func(t *testing.T) {
+		var output bytes.Buffer
+		err := cli.RunAudit([]string{"-server", httpServer.URL, deviceId}, &output)
+		test_utils.AssertErrorNotNil(t, "signature chain audit", err)
+
+		if !strings.Contains(output.String(), "3 signatures verified") {
+			t.Errorf("expected audit output to report 3 verified signatures, got %s", output.String())
+		}
+	})
+	t.Run("audit broken signature chain", func(t *testing.T) {
+		signatures.Records[deviceId][1].Signature = []byte("tampered")
+
+		var output bytes.Buffer
+		err := cli.RunAudit([]string{"-server", httpServer.URL, deviceId}, &output)
+
+		var chainBrokenErr cli.ChainBrokenError
+		if !errors.As(err, &chainBrokenErr) || !strings.Contains(err.Error(), "counter 1") {
+			t.Errorf("expected signature chain to be broken at counter 1, got %v", err)
+		}
+	})
+	t.Run("audit unknown device", func(t *testing.T) {
+		var output bytes.Buffer
+		if err := cli.RunAudit([]string{"-server", httpServer.URL, "unknown"}, &output); err == nil {
+			t.Errorf("expected audit of unknown device to fail")
+		}
+	})
+	t.Run("audit without device ID", func(t *testing.T) {
+		var output bytes.Buffer
+		if err := cli.RunAudit([]string{"-server", httpServer.URL}, &output); err == nil {
+			t.Errorf("expected usage error")
+		}
+	})
+}
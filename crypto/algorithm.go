@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/elliptic"
+)
+
+// KeyAlgorithm identifies the algorithm, and strength, of a key held by a KeyStore.
+type KeyAlgorithm string
+
+// KeyFamily is the signature scheme shared by the key algorithms of a family.
+type KeyFamily string
+
+const (
+	RSAFamily   KeyFamily = "RSA"
+	ECDSAFamily KeyFamily = "ECDSA"
+	EdDSAFamily KeyFamily = "EdDSA"
+)
+
+const (
+	RSA2048KeyAlgorithm   KeyAlgorithm = "RSA-2048"
+	RSA3072KeyAlgorithm   KeyAlgorithm = "RSA-3072"
+	RSA4096KeyAlgorithm   KeyAlgorithm = "RSA-4096"
+	ECDSAP256KeyAlgorithm KeyAlgorithm = "ECDSA-P256"
+	ECDSAP384KeyAlgorithm KeyAlgorithm = "ECDSA-P384"
+	ECDSAP521KeyAlgorithm KeyAlgorithm = "ECDSA-P521"
+	Ed25519KeyAlgorithm   KeyAlgorithm = "Ed25519"
+
+	// Deprecated: use an algorithm with an explicit strength, e.g. RSA2048KeyAlgorithm.
+	RSAKeyAlgorithm KeyAlgorithm = "RSA"
+	// Deprecated: use an algorithm with an explicit curve, e.g. ECDSAP384KeyAlgorithm.
+	ECCKeyAlgorithm KeyAlgorithm = "ECC"
+)
+
+// KeyAlgorithmParameters describes the keys of a KeyAlgorithm: the modulus size of RSA
+// keys, the curve of ECDSA keys, the key size of EdDSA keys. Deprecated algorithms are
+// only kept for compatibility.
+type KeyAlgorithmParameters struct {
+	Family     KeyFamily
+	KeySize    int
+	Curve      elliptic.Curve
+	Deprecated bool
+}
+
+// newDefaultAlgorithmRegistry registers the built-in algorithms, in the order they are
+// advertised.
+func newDefaultAlgorithmRegistry() *AlgorithmRegistry {
+	registry := NewAlgorithmRegistry()
+	for _, algorithm := range []struct {
+		name      KeyAlgorithm
+		algorithm Algorithm
+	}{
+		{RSA2048KeyAlgorithm, rsaAlgorithm(2048, false)},
+		{RSA3072KeyAlgorithm, rsaAlgorithm(3072, false)},
+		{RSA4096KeyAlgorithm, rsaAlgorithm(4096, false)},
+		{ECDSAP256KeyAlgorithm, ecdsaAlgorithm(elliptic.P256(), false)},
+		{ECDSAP384KeyAlgorithm, ecdsaAlgorithm(elliptic.P384(), false)},
+		{ECDSAP521KeyAlgorithm, ecdsaAlgorithm(elliptic.P521(), false)},
+		{Ed25519KeyAlgorithm, ed25519Algorithm()},
+		// the algorithms of the keys generated before key strengths were configurable
+		{RSAKeyAlgorithm, rsaAlgorithm(2048, true)},
+		{ECCKeyAlgorithm, ecdsaAlgorithm(elliptic.P384(), true)},
+	} {
+		if err := registry.Register(algorithm.name, algorithm.algorithm); err != nil {
+			panic(err)
+		}
+	}
+	return registry
+}
+
+func rsaAlgorithm(bits int, deprecated bool) Algorithm {
+	return Algorithm{
+		Parameters: KeyAlgorithmParameters{Family: RSAFamily, KeySize: bits, Deprecated: deprecated},
+		Generate: func() (crypto.Signer, error) {
+			keyPair, err := (&RSAGenerator{Bits: bits}).Generate()
+			if err != nil {
+				return nil, err
+			}
+			return keyPair.Private, nil
+		},
+		Marshaler: RSAMarshaler{},
+		Sign:      signRSA,
+		NewVerifier: func(devicePublicKey []byte, lastSignature string, signatureCount int) (Verifier, error) {
+			return NewRSAVerifier(devicePublicKey, lastSignature, signatureCount)
+		},
+	}
+}
+
+func ecdsaAlgorithm(curve elliptic.Curve, deprecated bool) Algorithm {
+	return Algorithm{
+		Parameters: KeyAlgorithmParameters{Family: ECDSAFamily, KeySize: curve.Params().BitSize, Curve: curve, Deprecated: deprecated},
+		Generate: func() (crypto.Signer, error) {
+			keyPair, err := (&ECCGenerator{Curve: curve}).Generate()
+			if err != nil {
+				return nil, err
+			}
+			return keyPair.Private, nil
+		},
+		Marshaler: ECCMarshaler{},
+		Sign:      signECDSA,
+		NewVerifier: func(devicePublicKey []byte, lastSignature string, signatureCount int) (Verifier, error) {
+			return NewECDSAVerifier(devicePublicKey, lastSignature, signatureCount)
+		},
+	}
+}
+
+func ed25519Algorithm() Algorithm {
+	return Algorithm{
+		Parameters: KeyAlgorithmParameters{Family: EdDSAFamily, KeySize: 256},
+		Generate: func() (crypto.Signer, error) {
+			keyPair, err := (&Ed25519Generator{}).Generate()
+			if err != nil {
+				return nil, err
+			}
+			return keyPair.Private, nil
+		},
+		Marshaler: Ed25519Marshaler{},
+		Sign:      signEd25519,
+		NewVerifier: func(devicePublicKey []byte, lastSignature string, signatureCount int) (Verifier, error) {
+			return NewEd25519Verifier(devicePublicKey, lastSignature, signatureCount)
+		},
+	}
+}
+
+// KeyAlgorithms returns the key algorithms of the DefaultAlgorithmRegistry.
+func KeyAlgorithms() []KeyAlgorithm {
+	return DefaultAlgorithmRegistry.Algorithms()
+}
+
+// Parameters returns the parameters of the algorithm, and false if it is not registered
+// in the DefaultAlgorithmRegistry.
+func (a KeyAlgorithm) Parameters() (KeyAlgorithmParameters, bool) {
+	algorithm, err := DefaultAlgorithmRegistry.Lookup(a)
+	if err != nil {
+		return KeyAlgorithmParameters{}, false
+	}
+	return algorithm.Parameters, true
+}
@@ -1,9 +1,16 @@
 package crypto
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/x509"
-	"encoding/pem"
+	"errors"
+)
+
+// Legacy PEM block types of SEC 1 encoded ECC private keys and PKIX encoded public keys.
+const (
+	legacyECCPrivateKeyBlockType = "PRIVATE_KEY"
+	legacyECCPublicKeyBlockType  = "PUBLIC_KEY"
 )
 
 // ECCKeyPair is a DTO that holds ECC private and public keys.
@@ -12,7 +19,8 @@ type ECCKeyPair struct {
 	Private *ecdsa.PrivateKey
 }
 
-// ECCMarshaler can encode and decode an ECC key pair.
+// ECCMarshaler is the KeyMarshaler of ECC keys. It also reads the SEC 1 "PRIVATE_KEY" and
+// PKIX "PUBLIC_KEY" blocks ECC keys used to be encoded with.
 type ECCMarshaler struct{}
 
 // NewECCMarshaler creates a new ECCMarshaler.
@@ -20,42 +28,61 @@ func NewECCMarshaler() ECCMarshaler {
 	return ECCMarshaler{}
 }
 
-// Encode takes an ECCKeyPair and encodes it to be written on disk.
-// It returns the public and the private key as a byte slice.
-func (m ECCMarshaler) Encode(keyPair ECCKeyPair) ([]byte, []byte, error) {
-	privateKeyBytes, err := x509.MarshalECPrivateKey(keyPair.Private)
-	if err != nil {
-		return nil, nil, err
+func (m ECCMarshaler) Marshal(privateKey crypto.Signer) ([]byte, []byte, error) {
+	if _, ok := privateKey.(*ecdsa.PrivateKey); !ok {
+		return nil, nil, errors.New("private key is not an ECC private key")
 	}
+	return marshalKeyPair(privateKey)
+}
 
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(keyPair.Public)
-	if err != nil {
-		return nil, nil, err
+func (m ECCMarshaler) MarshalPublic(publicKey crypto.PublicKey) ([]byte, error) {
+	if _, ok := publicKey.(*ecdsa.PublicKey); !ok {
+		return nil, errors.New("public key is not an ECC public key")
 	}
+	return marshalPublicKey(publicKey)
+}
 
-	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "PRIVATE_KEY",
-		Bytes: privateKeyBytes,
-	})
-
-	encodedPublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
+func (m ECCMarshaler) Unmarshal(privateKeyBytes []byte) (crypto.Signer, error) {
+	block, err := decodeKeyBlock(privateKeyBytes, "ECC private key")
+	if err != nil {
+		return nil, err
+	}
 
-	return encodedPublic, encodedPrivate, nil
+	var privateKey any
+	switch block.Type {
+	case privateKeyBlockType:
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case legacyECCPrivateKeyBlockType:
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, unexpectedBlockType(block, "ECC private key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	eccPrivateKey, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an ECC private key")
+	}
+	return eccPrivateKey, nil
 }
 
-// Decode assembles an ECCKeyPair from an encoded private key.
-func (m ECCMarshaler) Decode(privateKeyBytes []byte) (*ECCKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+func (m ECCMarshaler) UnmarshalPublic(publicKeyBytes []byte) (crypto.PublicKey, error) {
+	block, err := decodeKeyBlock(publicKeyBytes, "ECC public key")
 	if err != nil {
 		return nil, err
 	}
+	if block.Type != publicKeyBlockType && block.Type != legacyECCPublicKeyBlockType {
+		return nil, unexpectedBlockType(block, "ECC public key")
+	}
 
-	return &ECCKeyPair{
-		Private: privateKey,
-		Public:  &privateKey.PublicKey,
-	}, nil
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	eccPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an ECC public key")
+	}
+	return eccPublicKey, nil
 }
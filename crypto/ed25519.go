@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+)
+
+// Ed25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type Ed25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// Ed25519Generator generates an Ed25519 key pair.
+type Ed25519Generator struct{}
+
+// Generate generates a new Ed25519KeyPair.
+func (g *Ed25519Generator) Generate() (*Ed25519KeyPair, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519KeyPair{
+		Public:  publicKey,
+		Private: privateKey,
+	}, nil
+}
+
+// Ed25519Marshaler is the KeyMarshaler of Ed25519 keys.
+type Ed25519Marshaler struct{}
+
+// NewEd25519Marshaler creates a new Ed25519Marshaler.
+func NewEd25519Marshaler() Ed25519Marshaler {
+	return Ed25519Marshaler{}
+}
+
+func (m Ed25519Marshaler) Marshal(privateKey crypto.Signer) ([]byte, []byte, error) {
+	if _, ok := privateKey.(ed25519.PrivateKey); !ok {
+		return nil, nil, errors.New("private key is not an Ed25519 private key")
+	}
+	return marshalKeyPair(privateKey)
+}
+
+func (m Ed25519Marshaler) MarshalPublic(publicKey crypto.PublicKey) ([]byte, error) {
+	if _, ok := publicKey.(ed25519.PublicKey); !ok {
+		return nil, errors.New("public key is not an Ed25519 public key")
+	}
+	return marshalPublicKey(publicKey)
+}
+
+func (m Ed25519Marshaler) Unmarshal(privateKeyBytes []byte) (crypto.Signer, error) {
+	block, err := decodeKeyBlock(privateKeyBytes, "Ed25519 private key")
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != privateKeyBlockType {
+		return nil, unexpectedBlockType(block, "Ed25519 private key")
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ed25519PrivateKey, ok := privateKey.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an Ed25519 private key")
+	}
+	return ed25519PrivateKey, nil
+}
+
+func (m Ed25519Marshaler) UnmarshalPublic(publicKeyBytes []byte) (crypto.PublicKey, error) {
+	block, err := decodeKeyBlock(publicKeyBytes, "Ed25519 public key")
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != publicKeyBlockType {
+		return nil, unexpectedBlockType(block, "Ed25519 public key")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ed25519PublicKey, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 public key")
+	}
+	return ed25519PublicKey, nil
+}
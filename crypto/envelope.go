@@ -0,0 +1,218 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MasterKeySize is the size in bytes of master keys and data encryption keys (AES-256).
+const MasterKeySize = 32
+
+// MasterKey is a key encryption key, identified by Id so that sealed keys record
+// which master key wrapped them.
+type MasterKey struct {
+	Id  string
+	Key []byte
+}
+
+// SealedKey is a private key encrypted at rest with envelope encryption: the key is
+// sealed with AES-GCM under a random data encryption key, which is itself sealed with
+// AES-GCM under the master key identified by MasterKeyId. Both ciphertexts are prefixed
+// by their nonce. The private key is bound to the context it is sealed for, passed as
+// AES-GCM additional data, so that it cannot be opened for another context; keys sealed
+// before contexts were bound, without ContextBound, are opened without it.
+type SealedKey struct {
+	MasterKeyId  string `json:"master_key_id"`
+	WrappedKey   []byte `json:"wrapped_key"`
+	Ciphertext   []byte `json:"ciphertext"`
+	ContextBound bool   `json:"context_bound,omitempty"`
+}
+
+type MasterKeyNotFoundError string
+
+func (e MasterKeyNotFoundError) Error() string {
+	return string(e)
+}
+
+// Keyring holds the current master key, used to seal new keys, and the previous master
+// keys, only used to open keys sealed before a master key rotation.
+type Keyring struct {
+	current MasterKey
+	keys    map[string]MasterKey
+}
+
+// NewKeyring creates a Keyring sealing keys with current and still opening the keys
+// sealed with any of the previous master keys.
+func NewKeyring(current MasterKey, previous ...MasterKey) (*Keyring, error) {
+	keyring := &Keyring{current: current, keys: map[string]MasterKey{}}
+	for _, masterKey := range append([]MasterKey{current}, previous...) {
+		if masterKey.Id == "" {
+			return nil, errors.New("master key ID must not be empty")
+		}
+		if len(masterKey.Key) != MasterKeySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes long, got %d", masterKey.Id, MasterKeySize, len(masterKey.Key))
+		}
+		if _, found := keyring.keys[masterKey.Id]; found {
+			return nil, fmt.Errorf("master key %s is defined twice", masterKey.Id)
+		}
+		keyring.keys[masterKey.Id] = masterKey
+	}
+	return keyring, nil
+}
+
+// ParseKeyring reads a Keyring from one master key per line, formatted as
+// "<id>:<base64 encoded key>". The first key is the current one, the following ones are
+// previous keys. Empty lines and lines starting with # are ignored.
+func ParseKeyring(data []byte) (*Keyring, error) {
+	masterKeys := []MasterKey{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encodedKey, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("master key line %d is not formatted as <id>:<base64 key>", len(masterKeys)+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not base64 encoded: %w", id, err)
+		}
+		masterKeys = append(masterKeys, MasterKey{Id: id, Key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(masterKeys) == 0 {
+		return nil, errors.New("no master key found")
+	}
+	return NewKeyring(masterKeys[0], masterKeys[1:]...)
+}
+
+// GenerateMasterKey creates a random master key with the given ID.
+func GenerateMasterKey(id string) (MasterKey, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return MasterKey{}, err
+	}
+	return MasterKey{Id: id, Key: key}, nil
+}
+
+// CurrentMasterKeyId returns the ID of the master key new keys are sealed with.
+func (k *Keyring) CurrentMasterKeyId() string {
+	return k.current.Id
+}
+
+// Seal encrypts privateKey for context under a new data encryption key, wrapped by the
+// current master key. The key is only opened again for the same context.
+func (k *Keyring) Seal(privateKey []byte, context []byte) (*SealedKey, error) {
+	dataKey := make([]byte, MasterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	ciphertext, err := sealAESGCM(dataKey, privateKey, context)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := sealAESGCM(k.current.Key, dataKey, []byte(k.current.Id))
+	if err != nil {
+		return nil, err
+	}
+	return &SealedKey{MasterKeyId: k.current.Id, WrappedKey: wrappedKey, Ciphertext: ciphertext, ContextBound: true}, nil
+}
+
+// Open decrypts a private key sealed for context. Callers should clear the returned slice
+// once done.
+func (k *Keyring) Open(sealedKey *SealedKey, context []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(sealedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	if !sealedKey.ContextBound {
+		context = nil
+	}
+	privateKey, err := openAESGCM(dataKey, sealedKey.Ciphertext, context)
+	if err != nil {
+		return nil, fmt.Errorf("private key cannot be decrypted: %w", err)
+	}
+	return privateKey, nil
+}
+
+// Rewrap wraps the data encryption key of a sealed private key with the current master
+// key. The private key ciphertext is left untouched and never decrypted.
+func (k *Keyring) Rewrap(sealedKey *SealedKey) (*SealedKey, error) {
+	if sealedKey.MasterKeyId == k.current.Id {
+		return sealedKey, nil
+	}
+	dataKey, err := k.unwrap(sealedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	wrappedKey, err := sealAESGCM(k.current.Key, dataKey, []byte(k.current.Id))
+	if err != nil {
+		return nil, err
+	}
+	return &SealedKey{MasterKeyId: k.current.Id, WrappedKey: wrappedKey, Ciphertext: sealedKey.Ciphertext, ContextBound: sealedKey.ContextBound}, nil
+}
+
+func (k *Keyring) unwrap(sealedKey *SealedKey) ([]byte, error) {
+	if sealedKey == nil {
+		return nil, errors.New("private key is missing")
+	}
+	masterKey, found := k.keys[sealedKey.MasterKeyId]
+	if !found {
+		return nil, MasterKeyNotFoundError(fmt.Sprintf("master key %s not found in keyring", sealedKey.MasterKeyId))
+	}
+	dataKey, err := openAESGCM(masterKey.Key, sealedKey.WrappedKey, []byte(masterKey.Id))
+	if err != nil {
+		return nil, fmt.Errorf("data encryption key cannot be unwrapped with master key %s: %w", masterKey.Id, err)
+	}
+	return dataKey, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealAESGCM encrypts plaintext with a random nonce, returned as the ciphertext prefix.
+func sealAESGCM(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, additionalData)
+}
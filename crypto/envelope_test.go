@@ -0,0 +1,118 @@
+package crypto_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+func TestKeyring(t *testing.T) {
+	previousMasterKey, _ := crypto.GenerateMasterKey("previous")
+	currentMasterKey, _ := crypto.GenerateMasterKey("current")
+	previousKeyring, _ := crypto.NewKeyring(previousMasterKey)
+	rotatedKeyring, _ := crypto.NewKeyring(currentMasterKey, previousMasterKey)
+	privateKey := []byte("-----BEGIN PRIVATE_KEY-----")
+	context := []byte("Ed25519:keyHandle")
+
+	t.Run("seal and open private key", func(t *testing.T) {
+		sealedKey, err := previousKeyring.Seal(privateKey, context)
+		if err != nil {
+			t.Fatalf("an error occurred during private key sealing, error: %s", err.Error())
+		}
+		if sealedKey.MasterKeyId != "previous" || bytes.Contains(sealedKey.Ciphertext, privateKey) {
+			t.Errorf("expected private key to be encrypted under master key previous")
+		}
+
+		openedKey, err := previousKeyring.Open(sealedKey, context)
+		if err != nil || !bytes.Equal(openedKey, privateKey) {
+			t.Errorf("expected sealed private key to be opened, error: %v", err)
+		}
+	})
+	t.Run("open tampered private key", func(t *testing.T) {
+		sealedKey, _ := previousKeyring.Seal(privateKey, context)
+		sealedKey.Ciphertext[len(sealedKey.Ciphertext)-1] ^= 1
+
+		if _, err := previousKeyring.Open(sealedKey, context); err == nil {
+			t.Errorf("expected tampered private key not to be opened")
+		}
+	})
+	t.Run("open private key for another context", func(t *testing.T) {
+		sealedKey, _ := previousKeyring.Seal(privateKey, context)
+
+		for _, otherContext := range [][]byte{[]byte("Ed25519:otherKeyHandle"), []byte("RSA:keyHandle"), nil} {
+			if _, err := previousKeyring.Open(sealedKey, otherContext); err == nil {
+				t.Errorf("expected private key not to be opened for context %q", otherContext)
+			}
+		}
+	})
+	t.Run("open private key sealed before contexts were bound", func(t *testing.T) {
+		// keys used to be sealed without additional data, as with an empty context
+		sealedKey, _ := previousKeyring.Seal(privateKey, nil)
+		sealedKey.ContextBound = false
+
+		openedKey, err := previousKeyring.Open(sealedKey, context)
+		if err != nil || !bytes.Equal(openedKey, privateKey) {
+			t.Errorf("expected private key sealed without context to be opened, error: %v", err)
+		}
+	})
+	t.Run("open private key sealed with unknown master key", func(t *testing.T) {
+		sealedKey, _ := rotatedKeyring.Seal(privateKey, context)
+
+		_, err := previousKeyring.Open(sealedKey, context)
+		var notFound crypto.MasterKeyNotFoundError
+		if !errors.As(err, &notFound) {
+			t.Errorf("expected master key not found error, got %v", err)
+		}
+	})
+	t.Run("rewrap private key with the current master key", func(t *testing.T) {
+		sealedKey, _ := previousKeyring.Seal(privateKey, context)
+
+		rewrappedKey, err := rotatedKeyring.Rewrap(sealedKey)
+		if err != nil {
+			t.Fatalf("an error occurred during private key rewrapping, error: %s", err.Error())
+		}
+		if rewrappedKey.MasterKeyId != "current" || !bytes.Equal(rewrappedKey.Ciphertext, sealedKey.Ciphertext) {
+			t.Errorf("expected only the data encryption key to be wrapped with master key current")
+		}
+
+		currentKeyring, _ := crypto.NewKeyring(currentMasterKey)
+		openedKey, err := currentKeyring.Open(rewrappedKey, context)
+		if err != nil || !bytes.Equal(openedKey, privateKey) {
+			t.Errorf("expected rewrapped private key to be opened without the previous master key, error: %v", err)
+		}
+	})
+	t.Run("create keyring with invalid master keys", func(t *testing.T) {
+		if _, err := crypto.NewKeyring(crypto.MasterKey{Id: "short", Key: []byte("key")}); err == nil {
+			t.Errorf("expected master key size error")
+		}
+		if _, err := crypto.NewKeyring(currentMasterKey, currentMasterKey); err == nil {
+			t.Errorf("expected duplicated master key error")
+		}
+	})
+	t.Run("parse keyring", func(t *testing.T) {
+		masterKeys := fmt.Sprintf("# rotated on 2024-01-01\ncurrent:%s\n\nprevious:%s\n",
+			base64.StdEncoding.EncodeToString(currentMasterKey.Key), base64.StdEncoding.EncodeToString(previousMasterKey.Key))
+
+		keyring, err := crypto.ParseKeyring([]byte(masterKeys))
+		if err != nil {
+			t.Fatalf("an error occurred during keyring parsing, error: %s", err.Error())
+		}
+		if keyring.CurrentMasterKeyId() != "current" {
+			t.Errorf("expected current master key to be the first one, got %s", keyring.CurrentMasterKeyId())
+		}
+		sealedKey, _ := previousKeyring.Seal(privateKey, context)
+		if _, err := keyring.Open(sealedKey, context); err != nil {
+			t.Errorf("expected previous master key to be parsed, error: %s", err.Error())
+		}
+
+		for _, invalidMasterKeys := range []string{"", "current", "current:not base64"} {
+			if _, err := crypto.ParseKeyring([]byte(invalidMasterKeys)); err == nil {
+				t.Errorf("expected %q keyring parsing error", invalidMasterKeys)
+			}
+		}
+	})
+}
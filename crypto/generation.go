@@ -5,15 +5,29 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"fmt"
 )
 
-// RSAGenerator generates a RSA key pair.
-type RSAGenerator struct{}
+const (
+	defaultRSAKeyBits = 2048
+	minRSAKeyBits     = 2048
+)
+
+// RSAGenerator generates a RSA key pair with a modulus of Bits bits, 2048 by default.
+type RSAGenerator struct {
+	Bits int
+}
 
 // Generate generates a new RSAKeyPair.
 func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := rsa.GenerateKey(rand.Reader, 512)
+	bits := g.Bits
+	if bits == 0 {
+		bits = defaultRSAKeyBits
+	}
+	if bits < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA keys must be at least %d bits long, got %d", minRSAKeyBits, bits)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
 	}
@@ -24,13 +38,18 @@ func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 	}, nil
 }
 
-// ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{}
+// ECCGenerator generates an ECC key pair on Curve, P-384 by default.
+type ECCGenerator struct {
+	Curve elliptic.Curve
+}
 
 // Generate generates a new ECCKeyPair.
 func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	curve := g.Curve
+	if curve == nil {
+		curve = elliptic.P384()
+	}
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the JSON Web Key (RFC 7517) representation of a public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set (RFC 7517, section 5).
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParsePublicKey decodes a PEM encoded public key with the KeyMarshaler of its key
+// family, so that the legacy block types the marshalers read are accepted as well.
+// It returns the parsed key together with its PKIX DER encoding.
+func ParsePublicKey(publicKeyBytes []byte) (crypto.PublicKey, []byte, error) {
+	families := map[KeyFamily]bool{}
+	for _, name := range KeyAlgorithms() {
+		algorithm, err := DefaultAlgorithmRegistry.Lookup(name)
+		if err != nil || families[algorithm.Parameters.Family] {
+			continue
+		}
+		families[algorithm.Parameters.Family] = true
+
+		publicKey, err := algorithm.Marshaler.UnmarshalPublic(publicKeyBytes)
+		if err != nil {
+			continue
+		}
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publicKey, der, nil
+	}
+	return nil, nil, errors.New("public key is not a PEM encoded key of a registered algorithm")
+}
+
+// NewJWK builds the JWK of a PEM encoded public key, identified by kid.
+// The "alg" member is only set when the signing scheme has a registered
+// JWA identifier: RSA and ECDSA signatures are computed on a SHA-256 digest.
+func NewJWK(kid string, publicKeyBytes []byte) (*JWK, error) {
+	publicKey, _, err := ParsePublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "PS256",
+			N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		params := publicKey.Curve.Params()
+		size := (params.BitSize + 7) / 8
+		jwk := &JWK{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Crv: params.Name,
+			X:   base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, size))),
+		}
+		if params.Name == "P-256" {
+			jwk.Alg = "ES256"
+		}
+		return jwk, nil
+	case ed25519.PublicKey:
+		// Ed25519 keys are octet key pairs (RFC 8037)
+		return &JWK{
+			Kty: "OKP",
+			Kid: kid,
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(publicKey),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
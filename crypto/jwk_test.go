@@ -0,0 +1,100 @@
+package crypto_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+func TestJWK(t *testing.T) {
+	RSAMarshaler := crypto.NewRSAMarshaler()
+	RSAKeyGen := &crypto.RSAGenerator{}
+	RSAKeyPair, _ := RSAKeyGen.Generate()
+	marshalledRSAPublicKey, _, _ := RSAMarshaler.Marshal(RSAKeyPair.Private)
+
+	ECCMarshaler := crypto.NewECCMarshaler()
+	ECCKeyGen := &crypto.ECCGenerator{}
+	ECCKeyPair, _ := ECCKeyGen.Generate()
+	marshalledECCPublicKey, _, _ := ECCMarshaler.Marshal(ECCKeyPair.Private)
+
+	Ed25519KeyPair, _ := (&crypto.Ed25519Generator{}).Generate()
+	marshalledEd25519PublicKey, _, _ := crypto.NewEd25519Marshaler().Marshal(Ed25519KeyPair.Private)
+
+	t.Run("parse PEM encoded public keys", func(t *testing.T) {
+		rsaPublicKey, _, err := crypto.ParsePublicKey(marshalledRSAPublicKey)
+		if err != nil || !RSAKeyPair.Public.Equal(rsaPublicKey) {
+			t.Errorf("expected RSA public key to be parsed")
+		}
+		eccPublicKey, _, err := crypto.ParsePublicKey(marshalledECCPublicKey)
+		if err != nil || !ECCKeyPair.Public.Equal(eccPublicKey) {
+			t.Errorf("expected ECC public key to be parsed")
+		}
+		if _, _, err := crypto.ParsePublicKey([]byte("publicKey")); err == nil {
+			t.Errorf("expected public key decoding error")
+		}
+	})
+	t.Run("parse legacy RSA public keys to their PKIX encoding", func(t *testing.T) {
+		legacyPublicKey := pem.EncodeToMemory(&pem.Block{Type: "RSA_PUBLIC_KEY", Bytes: x509.MarshalPKCS1PublicKey(RSAKeyPair.Public)})
+		publicKey, der, err := crypto.ParsePublicKey(legacyPublicKey)
+		if err != nil || !RSAKeyPair.Public.Equal(publicKey) {
+			t.Fatalf("expected legacy RSA public key to be parsed, error: %v", err)
+		}
+		if expected, _ := x509.MarshalPKIXPublicKey(RSAKeyPair.Public); !bytes.Equal(der, expected) {
+			t.Errorf("expected PKIX DER encoding of the legacy RSA public key")
+		}
+	})
+	t.Run("RSA public key JWK", func(t *testing.T) {
+		jwk, err := crypto.NewJWK("kid", marshalledRSAPublicKey)
+		if err != nil {
+			t.Fatalf("an error occurred during JWK creation, error: %s", err.Error())
+		}
+		if jwk.Kty != "RSA" || jwk.Kid != "kid" || jwk.Alg != "PS256" {
+			t.Errorf("expected RSA JWK with PS256 algorithm, got kty %s alg %s", jwk.Kty, jwk.Alg)
+		}
+		n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+		publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if !RSAKeyPair.Public.Equal(publicKey) {
+			t.Errorf("expected JWK modulus and exponent to match RSA public key")
+		}
+	})
+	t.Run("ECC public key JWK", func(t *testing.T) {
+		jwk, err := crypto.NewJWK("kid", marshalledECCPublicKey)
+		if err != nil {
+			t.Fatalf("an error occurred during JWK creation, error: %s", err.Error())
+		}
+		if jwk.Kty != "EC" || jwk.Crv != "P-384" {
+			t.Errorf("expected EC JWK on P-384 curve, got kty %s crv %s", jwk.Kty, jwk.Crv)
+		}
+		x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, _ := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if len(x) != 48 || len(y) != 48 {
+			t.Errorf("expected EC JWK coordinates to be 48 bytes long, got %d and %d", len(x), len(y))
+		}
+		publicKey := &ecdsa.PublicKey{Curve: ECCKeyPair.Public.Curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !ECCKeyPair.Public.Equal(publicKey) {
+			t.Errorf("expected JWK coordinates to match ECC public key")
+		}
+	})
+	t.Run("Ed25519 public key JWK", func(t *testing.T) {
+		jwk, err := crypto.NewJWK("kid", marshalledEd25519PublicKey)
+		if err != nil {
+			t.Fatalf("an error occurred during JWK creation, error: %s", err.Error())
+		}
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" {
+			t.Errorf("expected OKP JWK on Ed25519 curve with EdDSA algorithm, got kty %s crv %s alg %s", jwk.Kty, jwk.Crv, jwk.Alg)
+		}
+		x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+		if !Ed25519KeyPair.Public.Equal(ed25519.PublicKey(x)) {
+			t.Errorf("expected JWK x member to match Ed25519 public key")
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"fmt"
+)
+
+// KeyHandle references a key held by a KeyStore.
+type KeyHandle string
+
+// KeyStore generates and holds private keys, which never leave the key store boundary:
+// callers only get a handle to sign with and the public key, encoded by the KeyMarshaler
+// of its family. Sign signs the SHA-256 digest of message, with RSA-PSS for RSA keys and
+// ASN.1 encoded ECDSA for ECDSA keys, and message itself with Ed25519 for EdDSA keys, so
+// that signatures verify with the Verifier implementations.
+// Implementations must be safe for concurrent use.
+type KeyStore interface {
+	GenerateKey(algorithm KeyAlgorithm) (KeyHandle, error)
+	PublicKey(handle KeyHandle) ([]byte, error)
+	Sign(handle KeyHandle, message []byte) ([]byte, error)
+	Destroy(handle KeyHandle) error
+}
+
+type KeyNotFoundError string
+
+func (e KeyNotFoundError) Error() string {
+	return string(e)
+}
+
+type KeyAlgorithmNotSupportedError string
+
+func (e KeyAlgorithmNotSupportedError) Error() string {
+	return string(e)
+}
+
+func keyNotFound(handle KeyHandle) KeyNotFoundError {
+	return KeyNotFoundError(fmt.Sprintf("key %s not found", handle))
+}
+
+func keyAlgorithmNotSupported(algorithm KeyAlgorithm) KeyAlgorithmNotSupportedError {
+	return KeyAlgorithmNotSupportedError(fmt.Sprintf("key algorithm %s not supported", algorithm))
+}
@@ -0,0 +1,474 @@
+package crypto_test
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+func TestSoftwareKeyStore(t *testing.T) {
+	previousMasterKey, _ := crypto.GenerateMasterKey("previous")
+	currentMasterKey, _ := crypto.GenerateMasterKey("current")
+	previousKeyring, _ := crypto.NewKeyring(previousMasterKey)
+
+	t.Run("in-memory key store", func(t *testing.T) {
+		keyStore, err := crypto.NewSoftwareKeyStore(previousKeyring, "")
+		if err != nil {
+			t.Fatalf("an error occurred during key store creation, error: %s", err.Error())
+		}
+		testKeyStore(t, keyStore)
+	})
+	t.Run("persistent key store", func(t *testing.T) {
+		keyStore, err := crypto.NewSoftwareKeyStore(previousKeyring, t.TempDir())
+		if err != nil {
+			t.Fatalf("an error occurred during key store creation, error: %s", err.Error())
+		}
+		testKeyStore(t, keyStore)
+	})
+	t.Run("reload sealed keys and rewrap them with a new master key", func(t *testing.T) {
+		directory := t.TempDir()
+		keyStore, _ := crypto.NewSoftwareKeyStore(previousKeyring, directory)
+		rsaHandle, _ := keyStore.GenerateKey(crypto.RSAKeyAlgorithm)
+		eccHandle, _ := keyStore.GenerateKey(crypto.ECCKeyAlgorithm)
+		destroyedHandle, _ := keyStore.GenerateKey(crypto.ECCKeyAlgorithm)
+		keyStore.Destroy(destroyedHandle)
+
+		keyFiles, _ := filepath.Glob(filepath.Join(directory, "*"))
+		if len(keyFiles) != 2 {
+			t.Fatalf("expected 2 key files, found %d", len(keyFiles))
+		}
+		for _, keyFile := range keyFiles {
+			keyBytes, _ := os.ReadFile(keyFile)
+			if bytes.Contains(keyBytes, []byte("PRIVATE")) {
+				t.Errorf("expected key file %s not to hold a plaintext private key", keyFile)
+			}
+		}
+
+		rotatedKeyring, _ := crypto.NewKeyring(currentMasterKey, previousMasterKey)
+		rotatedKeyStore, err := crypto.NewSoftwareKeyStore(rotatedKeyring, directory)
+		if err != nil {
+			t.Fatalf("an error occurred during key store reloading, error: %s", err.Error())
+		}
+		rewrapped, err := rotatedKeyStore.RewrapKeys()
+		if err != nil || rewrapped != 2 {
+			t.Fatalf("expected 2 keys to be rewrapped, got %d, error: %v", rewrapped, err)
+		}
+
+		currentKeyring, _ := crypto.NewKeyring(currentMasterKey)
+		currentKeyStore, _ := crypto.NewSoftwareKeyStore(currentKeyring, directory)
+		for _, handle := range []crypto.KeyHandle{rsaHandle, eccHandle} {
+			if _, err := currentKeyStore.Sign(handle, []byte("message")); err != nil {
+				t.Errorf("expected key %s to sign after master key rotation, error: %s", handle, err.Error())
+			}
+		}
+		if _, err := currentKeyStore.PublicKey(destroyedHandle); err == nil {
+			t.Errorf("expected destroyed key not to be reloaded")
+		}
+	})
+	t.Run("refuse sealed keys swapped between handles", func(t *testing.T) {
+		directory := t.TempDir()
+		keyStore, _ := crypto.NewSoftwareKeyStore(previousKeyring, directory)
+		firstHandle, _ := keyStore.GenerateKey(crypto.Ed25519KeyAlgorithm)
+		secondHandle, _ := keyStore.GenerateKey(crypto.Ed25519KeyAlgorithm)
+
+		firstPath := filepath.Join(directory, string(firstHandle)+".key.json")
+		secondPath := filepath.Join(directory, string(secondHandle)+".key.json")
+		firstKey, _ := os.ReadFile(firstPath)
+		secondKey, _ := os.ReadFile(secondPath)
+		os.WriteFile(firstPath, secondKey, 0o600)
+		os.WriteFile(secondPath, firstKey, 0o600)
+
+		reloadedKeyStore, _ := crypto.NewSoftwareKeyStore(previousKeyring, directory)
+		for _, handle := range []crypto.KeyHandle{firstHandle, secondHandle} {
+			if _, err := reloadedKeyStore.Sign(handle, []byte("message")); err == nil {
+				t.Errorf("expected key sealed for another handle not to sign for %s", handle)
+			}
+		}
+	})
+	t.Run("bind keys sealed without context when rewrapping them", func(t *testing.T) {
+		directory := t.TempDir()
+		keyPair, _ := (&crypto.Ed25519Generator{}).Generate()
+		publicKey, privateKey, _ := crypto.NewEd25519Marshaler().Marshal(keyPair.Private)
+		// keys used to be sealed without additional data, as with an empty context
+		sealedKey, _ := previousKeyring.Seal(privateKey, nil)
+		sealedKey.ContextBound = false
+		keyBytes, _ := json.Marshal(map[string]interface{}{"algorithm": crypto.Ed25519KeyAlgorithm, "public_key": publicKey, "sealed_private_key": sealedKey})
+		os.WriteFile(filepath.Join(directory, "legacyKey.key.json"), keyBytes, 0o600)
+
+		keyStore, _ := crypto.NewSoftwareKeyStore(previousKeyring, directory)
+		if _, err := keyStore.Sign("legacyKey", []byte("message")); err != nil {
+			t.Fatalf("expected key sealed without context to sign, error: %s", err.Error())
+		}
+		rewrapped, err := keyStore.RewrapKeys()
+		if err != nil || rewrapped != 1 {
+			t.Fatalf("expected key sealed without context to be sealed again, got %d, error: %v", rewrapped, err)
+		}
+
+		keyBytes, _ = os.ReadFile(filepath.Join(directory, "legacyKey.key.json"))
+		var storedKey struct {
+			PrivateKey crypto.SealedKey `json:"sealed_private_key"`
+		}
+		json.Unmarshal(keyBytes, &storedKey)
+		reloadedKeyStore, _ := crypto.NewSoftwareKeyStore(previousKeyring, directory)
+		if _, err := reloadedKeyStore.Sign("legacyKey", []byte("message")); err != nil || !storedKey.PrivateKey.ContextBound {
+			t.Errorf("expected key to be bound to its handle and algorithm and to sign, error: %v", err)
+		}
+	})
+}
+
+func TestPKCS11KeyStore(t *testing.T) {
+	t.Run("sign on tokens providing the public key info", func(t *testing.T) {
+		keyStore, err := crypto.NewPKCS11KeyStore(newFakePKCS11Session(crypto.PKCS11UlongSize, true))
+		if err != nil {
+			t.Fatalf("an error occurred during key store creation, error: %s", err.Error())
+		}
+		testKeyStore(t, keyStore)
+	})
+	t.Run("sign on tokens without the public key info", func(t *testing.T) {
+		keyStore, err := crypto.NewPKCS11KeyStore(newFakePKCS11Session(crypto.PKCS11UlongSize, false))
+		if err != nil {
+			t.Fatalf("an error occurred during key store creation, error: %s", err.Error())
+		}
+		testKeyStore(t, keyStore)
+	})
+	t.Run("sign on modules with a 4 byte CK_ULONG", func(t *testing.T) {
+		keyStore, err := crypto.NewPKCS11KeyStoreWithUlongSize(newFakePKCS11Session(4, false), 4)
+		if err != nil {
+			t.Fatalf("an error occurred during key store creation, error: %s", err.Error())
+		}
+		testKeyStore(t, keyStore)
+	})
+	t.Run("refuse unsupported CK_ULONG sizes", func(t *testing.T) {
+		if _, err := crypto.NewPKCS11KeyStoreWithUlongSize(newFakePKCS11Session(2, false), 2); err == nil {
+			t.Error("expected key store creation to fail for a 2 byte CK_ULONG")
+		}
+	})
+}
+
+// testKeyStore checks the KeyStore contract: signatures produced by the key store verify
+// with the verifiers against the public key it returns.
+func testKeyStore(t *testing.T, keyStore crypto.KeyStore) {
+	t.Helper()
+
+	lastSignature := "lastSignature"
+	signatureCount := 3
+	dataToBeSigned := []byte("data")
+	message := []byte(crypto.SignatureInput(signatureCount, dataToBeSigned, lastSignature))
+	verifierTestCases := []struct {
+		algorithm   crypto.KeyAlgorithm
+		newVerifier func(publicKey []byte) (crypto.Verifier, error)
+	}{
+		{crypto.RSAKeyAlgorithm, func(publicKey []byte) (crypto.Verifier, error) {
+			return crypto.NewRSAVerifier(publicKey, lastSignature, signatureCount)
+		}},
+		{crypto.RSA3072KeyAlgorithm, func(publicKey []byte) (crypto.Verifier, error) {
+			return crypto.NewRSAVerifier(publicKey, lastSignature, signatureCount)
+		}},
+		{crypto.ECCKeyAlgorithm, func(publicKey []byte) (crypto.Verifier, error) {
+			return crypto.NewECDSAVerifier(publicKey, lastSignature, signatureCount)
+		}},
+		{crypto.ECDSAP256KeyAlgorithm, func(publicKey []byte) (crypto.Verifier, error) {
+			return crypto.NewECDSAVerifier(publicKey, lastSignature, signatureCount)
+		}},
+		{crypto.ECDSAP521KeyAlgorithm, func(publicKey []byte) (crypto.Verifier, error) {
+			return crypto.NewECDSAVerifier(publicKey, lastSignature, signatureCount)
+		}},
+		{crypto.Ed25519KeyAlgorithm, func(publicKey []byte) (crypto.Verifier, error) {
+			return crypto.NewEd25519Verifier(publicKey, lastSignature, signatureCount)
+		}},
+	}
+	for _, tc := range verifierTestCases {
+		t.Run(fmt.Sprintf("generate %s key and sign", tc.algorithm), func(t *testing.T) {
+			handle, err := keyStore.GenerateKey(tc.algorithm)
+			if err != nil {
+				t.Fatalf("an error occurred during key generation, error: %s", err.Error())
+			}
+			publicKey, err := keyStore.PublicKey(handle)
+			if err != nil {
+				t.Fatalf("an error occurred during public key retrieval, error: %s", err.Error())
+			}
+			signature, err := keyStore.Sign(handle, message)
+			if err != nil {
+				t.Fatalf("an error occurred during signing, error: %s", err.Error())
+			}
+
+			verifier, _ := tc.newVerifier(publicKey)
+			if valid, err := verifier.Verify(dataToBeSigned, signature); !valid || err != nil {
+				t.Errorf("expected %s signature to verify against the key store public key, error: %v", tc.algorithm, err)
+			}
+
+			err = keyStore.Destroy(handle)
+			if err != nil {
+				t.Fatalf("an error occurred during key destruction, error: %s", err.Error())
+			}
+			_, err = keyStore.Sign(handle, message)
+			var keyNotFound crypto.KeyNotFoundError
+			if !errors.As(err, &keyNotFound) {
+				t.Errorf("expected destroyed key not to be found, got %v", err)
+			}
+		})
+	}
+	t.Run("unknown key", func(t *testing.T) {
+		var keyNotFound crypto.KeyNotFoundError
+		if _, err := keyStore.PublicKey("unknownKey"); !errors.As(err, &keyNotFound) {
+			t.Errorf("expected key not found error, got %v", err)
+		}
+		if err := keyStore.Destroy("unknownKey"); !errors.As(err, &keyNotFound) {
+			t.Errorf("expected key not found error, got %v", err)
+		}
+	})
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		_, err := keyStore.GenerateKey("DSA")
+		var notSupported crypto.KeyAlgorithmNotSupportedError
+		if !errors.As(err, &notSupported) {
+			t.Errorf("expected key algorithm not supported error, got %v", err)
+		}
+	})
+}
+
+// fakePKCS11Session is an in-memory PKCS#11 token, implementing the mechanisms used by
+// PKCS11KeyStore in software, with a CK_ULONG of ulongSize bytes. Like many tokens,
+// it only sets CKA_PUBLIC_KEY_INFO on public keys when publicKeyInfo is true.
+type fakePKCS11Session struct {
+	objects       map[crypto.PKCS11ObjectHandle]*fakePKCS11Object
+	nextObject    crypto.PKCS11ObjectHandle
+	signKey       *fakePKCS11Object
+	signMech      uint
+	ulongSize     int
+	publicKeyInfo bool
+}
+
+type fakePKCS11Object struct {
+	attributes map[uint][]byte
+	privateKey gocrypto.Signer
+}
+
+func newFakePKCS11Session(ulongSize int, publicKeyInfo bool) *fakePKCS11Session {
+	return &fakePKCS11Session{objects: map[crypto.PKCS11ObjectHandle]*fakePKCS11Object{}, ulongSize: ulongSize, publicKeyInfo: publicKeyInfo}
+}
+
+func (s *fakePKCS11Session) ulong(value []byte) (uint, error) {
+	switch {
+	case len(value) != s.ulongSize:
+		return 0, errors.New("CKR_ATTRIBUTE_VALUE_INVALID")
+	case s.ulongSize == 4:
+		return uint(binary.NativeEndian.Uint32(value)), nil
+	default:
+		return uint(binary.NativeEndian.Uint64(value)), nil
+	}
+}
+
+func (s *fakePKCS11Session) newObject(template []*crypto.PKCS11Attribute, privateKey gocrypto.Signer) *fakePKCS11Object {
+	object := &fakePKCS11Object{attributes: map[uint][]byte{}, privateKey: privateKey}
+	for _, attribute := range template {
+		object.attributes[attribute.Type] = attribute.Value
+	}
+	s.nextObject++
+	s.objects[s.nextObject] = object
+	return object
+}
+
+func (s *fakePKCS11Session) GenerateKeyPair(mechanisms []*crypto.PKCS11Mechanism, publicKeyTemplate []*crypto.PKCS11Attribute, privateKeyTemplate []*crypto.PKCS11Attribute) (crypto.PKCS11ObjectHandle, crypto.PKCS11ObjectHandle, error) {
+	publicAttributes := map[uint][]byte{}
+	for _, attribute := range publicKeyTemplate {
+		publicAttributes[attribute.Type] = attribute.Value
+	}
+
+	var privateKey gocrypto.Signer
+	var err error
+	switch mechanisms[0].Mechanism {
+	case crypto.CKM_RSA_PKCS_KEY_PAIR_GEN:
+		bits, err := s.ulong(publicAttributes[crypto.CKA_MODULUS_BITS])
+		if err != nil {
+			return 0, 0, err
+		}
+		privateKey, err = rsa.GenerateKey(rand.Reader, int(bits))
+		if err != nil {
+			return 0, 0, err
+		}
+	case crypto.CKM_EC_KEY_PAIR_GEN:
+		var curveOID asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(publicAttributes[crypto.CKA_EC_PARAMS], &curveOID); err != nil {
+			return 0, 0, errors.New("CKR_DOMAIN_PARAMS_INVALID")
+		}
+		var curve elliptic.Curve
+		switch curveOID.String() {
+		case "1.2.840.10045.3.1.7":
+			curve = elliptic.P256()
+		case "1.3.132.0.34":
+			curve = elliptic.P384()
+		case "1.3.132.0.35":
+			curve = elliptic.P521()
+		default:
+			return 0, 0, errors.New("CKR_DOMAIN_PARAMS_INVALID")
+		}
+		privateKey, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case crypto.CKM_EC_EDWARDS_KEY_PAIR_GEN:
+		var curveOID asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(publicAttributes[crypto.CKA_EC_PARAMS], &curveOID); err != nil || curveOID.String() != "1.3.101.112" {
+			return 0, 0, errors.New("CKR_DOMAIN_PARAMS_INVALID")
+		}
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return 0, 0, errors.New("CKR_MECHANISM_INVALID")
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	publicKeyAttributes := []*crypto.PKCS11Attribute{}
+	switch publicKey := privateKey.Public().(type) {
+	case *rsa.PublicKey:
+		publicKeyAttributes = append(publicKeyAttributes,
+			&crypto.PKCS11Attribute{Type: crypto.CKA_MODULUS, Value: publicKey.N.Bytes()},
+			&crypto.PKCS11Attribute{Type: crypto.CKA_PUBLIC_EXPONENT, Value: big.NewInt(int64(publicKey.E)).Bytes()})
+	case *ecdsa.PublicKey:
+		point, _ := asn1.Marshal(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+		publicKeyAttributes = append(publicKeyAttributes, &crypto.PKCS11Attribute{Type: crypto.CKA_EC_POINT, Value: point})
+	case ed25519.PublicKey:
+		point, _ := asn1.Marshal([]byte(publicKey))
+		publicKeyAttributes = append(publicKeyAttributes, &crypto.PKCS11Attribute{Type: crypto.CKA_EC_POINT, Value: point})
+	}
+	if s.publicKeyInfo {
+		publicKeyInfo, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+		if err != nil {
+			return 0, 0, err
+		}
+		publicKeyAttributes = append(publicKeyAttributes, &crypto.PKCS11Attribute{Type: crypto.CKA_PUBLIC_KEY_INFO, Value: publicKeyInfo})
+	}
+
+	s.newObject(append(publicKeyTemplate, publicKeyAttributes...), nil)
+	publicObject := s.nextObject
+	s.newObject(privateKeyTemplate, privateKey)
+	return publicObject, s.nextObject, nil
+}
+
+func (s *fakePKCS11Session) FindObjects(template []*crypto.PKCS11Attribute) ([]crypto.PKCS11ObjectHandle, error) {
+	handles := []crypto.PKCS11ObjectHandle{}
+	for handle, object := range s.objects {
+		matches := true
+		for _, attribute := range template {
+			matches = matches && bytes.Equal(object.attributes[attribute.Type], attribute.Value)
+		}
+		if matches {
+			handles = append(handles, handle)
+		}
+	}
+	return handles, nil
+}
+
+func (s *fakePKCS11Session) GetAttributeValue(handle crypto.PKCS11ObjectHandle, template []*crypto.PKCS11Attribute) ([]*crypto.PKCS11Attribute, error) {
+	object, found := s.objects[handle]
+	if !found {
+		return nil, errors.New("CKR_OBJECT_HANDLE_INVALID")
+	}
+	attributes := []*crypto.PKCS11Attribute{}
+	for _, attribute := range template {
+		value, found := object.attributes[attribute.Type]
+		if !found {
+			return nil, errors.New("CKR_ATTRIBUTE_TYPE_INVALID")
+		}
+		attributes = append(attributes, &crypto.PKCS11Attribute{Type: attribute.Type, Value: value})
+	}
+	return attributes, nil
+}
+
+func (s *fakePKCS11Session) SignInit(mechanisms []*crypto.PKCS11Mechanism, handle crypto.PKCS11ObjectHandle) error {
+	object, found := s.objects[handle]
+	if !found || object.privateKey == nil {
+		return errors.New("CKR_KEY_HANDLE_INVALID")
+	}
+	// CK_RSA_PKCS_PSS_PARAMS holds three CK_ULONG
+	if mechanisms[0].Mechanism == crypto.CKM_SHA256_RSA_PKCS_PSS && len(mechanisms[0].Parameter) != 3*s.ulongSize {
+		return errors.New("CKR_MECHANISM_PARAM_INVALID")
+	}
+	s.signKey, s.signMech = object, mechanisms[0].Mechanism
+	return nil
+}
+
+func (s *fakePKCS11Session) Sign(message []byte) ([]byte, error) {
+	if s.signKey == nil {
+		return nil, errors.New("CKR_OPERATION_NOT_INITIALIZED")
+	}
+	defer func() { s.signKey = nil }()
+
+	digest := sha256.Sum256(message)
+	switch s.signMech {
+	case crypto.CKM_SHA256_RSA_PKCS_PSS:
+		return rsa.SignPSS(rand.Reader, s.signKey.privateKey.(*rsa.PrivateKey), gocrypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: sha256.Size})
+	case crypto.CKM_ECDSA_SHA256:
+		privateKey := s.signKey.privateKey.(*ecdsa.PrivateKey)
+		r, sig, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		size := (privateKey.Curve.Params().BitSize + 7) / 8
+		return append(r.FillBytes(make([]byte, size)), sig.FillBytes(make([]byte, size))...), nil
+	case crypto.CKM_EDDSA:
+		return ed25519.Sign(s.signKey.privateKey.(ed25519.PrivateKey), message), nil
+	default:
+		return nil, errors.New("CKR_MECHANISM_INVALID")
+	}
+}
+
+func (s *fakePKCS11Session) DestroyObject(handle crypto.PKCS11ObjectHandle) error {
+	if _, found := s.objects[handle]; !found {
+		return errors.New("CKR_OBJECT_HANDLE_INVALID")
+	}
+	delete(s.objects, handle)
+	return nil
+}
+
+func TestKeyGeneration(t *testing.T) {
+	t.Run("generate RSA keys of the configured size", func(t *testing.T) {
+		keyPair, err := (&crypto.RSAGenerator{Bits: 3072}).Generate()
+		if err != nil {
+			t.Fatalf("an error occurred during key generation, error: %s", err.Error())
+		}
+		if keyPair.Public.N.BitLen() != 3072 {
+			t.Errorf("expected 3072 bits RSA key, got %d", keyPair.Public.N.BitLen())
+		}
+	})
+	t.Run("refuse RSA keys shorter than 2048 bits", func(t *testing.T) {
+		if _, err := (&crypto.RSAGenerator{Bits: 1024}).Generate(); err == nil {
+			t.Errorf("expected 1024 bits RSA key generation to fail")
+		}
+	})
+	t.Run("generate ECDSA keys on the configured curve", func(t *testing.T) {
+		for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+			keyPair, err := (&crypto.ECCGenerator{Curve: curve}).Generate()
+			if err != nil {
+				t.Fatalf("an error occurred during key generation, error: %s", err.Error())
+			}
+			if keyPair.Public.Curve != curve {
+				t.Errorf("expected ECDSA key on curve %s, got %s", curve.Params().Name, keyPair.Public.Curve.Params().Name)
+			}
+		}
+	})
+	t.Run("list supported key algorithms", func(t *testing.T) {
+		for _, algorithm := range crypto.KeyAlgorithms() {
+			if _, found := algorithm.Parameters(); !found {
+				t.Errorf("expected listed algorithm %s to have parameters", algorithm)
+			}
+		}
+		if _, found := crypto.KeyAlgorithm("DSA").Parameters(); found {
+			t.Errorf("expected DSA algorithm not to be supported")
+		}
+	})
+}
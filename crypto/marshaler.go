@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// PEM block types of the keys encoded by the KeyMarshaler implementations.
+const (
+	privateKeyBlockType = "PRIVATE KEY"
+	publicKeyBlockType  = "PUBLIC KEY"
+)
+
+// KeyMarshaler encodes and decodes the keys of a key family, as PKCS#8 "PRIVATE KEY" and
+// PKIX "PUBLIC KEY" PEM blocks. Decoding also accepts the legacy block types keys were
+// encoded with before, so that keys already stored keep working.
+type KeyMarshaler interface {
+	// Marshal encodes the key pair of privateKey, returning its public and private keys.
+	Marshal(privateKey crypto.Signer) ([]byte, []byte, error)
+	MarshalPublic(publicKey crypto.PublicKey) ([]byte, error)
+	Unmarshal(privateKeyBytes []byte) (crypto.Signer, error)
+	UnmarshalPublic(publicKeyBytes []byte) (crypto.PublicKey, error)
+}
+
+// Marshaler returns the KeyMarshaler of the keys of the algorithm, as registered in the
+// DefaultAlgorithmRegistry.
+func (a KeyAlgorithm) Marshaler() (KeyMarshaler, error) {
+	algorithm, err := DefaultAlgorithmRegistry.Lookup(a)
+	if err != nil {
+		return nil, err
+	}
+	return algorithm.Marshaler, nil
+}
+
+// marshalKeyPair encodes the key pair of privateKey as PKIX and PKCS#8 PEM blocks.
+func marshalKeyPair(privateKey crypto.Signer) ([]byte, []byte, error) {
+	publicKey, err := marshalPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publicKey, pem.EncodeToMemory(&pem.Block{Type: privateKeyBlockType, Bytes: privateKeyBytes}), nil
+}
+
+// marshalPublicKey encodes publicKey as a PKIX PEM block.
+func marshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: publicKeyBlockType, Bytes: publicKeyBytes}), nil
+}
+
+// decodeKeyBlock decodes the PEM block of a key, described by description in errors.
+func decodeKeyBlock(keyBytes []byte, description string) (*pem.Block, error) {
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", description)
+	}
+	return block, nil
+}
+
+func unexpectedBlockType(block *pem.Block, description string) error {
+	return fmt.Errorf("unexpected PEM block type %q for %s", block.Type, description)
+}
@@ -0,0 +1,126 @@
+package crypto_test
+
+import (
+	gocrypto "crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+func TestKeyMarshaler(t *testing.T) {
+	rsaKeyPair, _ := (&crypto.RSAGenerator{}).Generate()
+	eccKeyPair, _ := (&crypto.ECCGenerator{}).Generate()
+	ed25519KeyPair, _ := (&crypto.Ed25519Generator{}).Generate()
+
+	marshalerTestCases := []struct {
+		algorithm  crypto.KeyAlgorithm
+		privateKey gocrypto.Signer
+	}{
+		{crypto.RSA2048KeyAlgorithm, rsaKeyPair.Private},
+		{crypto.ECDSAP384KeyAlgorithm, eccKeyPair.Private},
+		{crypto.Ed25519KeyAlgorithm, ed25519KeyPair.Private},
+	}
+	for _, tc := range marshalerTestCases {
+		t.Run(string(tc.algorithm), func(t *testing.T) {
+			marshaler, err := tc.algorithm.Marshaler()
+			if err != nil {
+				t.Fatalf("an error occurred during marshaler lookup, error: %s", err.Error())
+			}
+
+			t.Run("encode keys as PKCS#8 and PKIX PEM blocks", func(t *testing.T) {
+				publicKeyBytes, privateKeyBytes, err := marshaler.Marshal(tc.privateKey)
+				if err != nil {
+					t.Fatalf("an error occurred during key marshaling, error: %s", err.Error())
+				}
+				assertPEMBlockType(t, "PUBLIC KEY", publicKeyBytes)
+				assertPEMBlockType(t, "PRIVATE KEY", privateKeyBytes)
+
+				privateKey, err := marshaler.Unmarshal(privateKeyBytes)
+				if err != nil || !privateKey.Public().(interface{ Equal(gocrypto.PublicKey) bool }).Equal(tc.privateKey.Public()) {
+					t.Errorf("expected private key to be decoded, error: %v", err)
+				}
+				publicKey, err := marshaler.UnmarshalPublic(publicKeyBytes)
+				if err != nil || !publicKey.(interface{ Equal(gocrypto.PublicKey) bool }).Equal(tc.privateKey.Public()) {
+					t.Errorf("expected public key to be decoded, error: %v", err)
+				}
+				marshalledPublicKey, err := marshaler.MarshalPublic(tc.privateKey.Public())
+				if err != nil || string(marshalledPublicKey) != string(publicKeyBytes) {
+					t.Errorf("expected public key to be encoded as with its private key, error: %v", err)
+				}
+			})
+			t.Run("refuse keys of other families", func(t *testing.T) {
+				for _, other := range marshalerTestCases {
+					if other.algorithm == tc.algorithm {
+						continue
+					}
+					if _, _, err := marshaler.Marshal(other.privateKey); err == nil {
+						t.Errorf("expected %s key marshaling to fail", other.algorithm)
+					}
+					otherMarshaler, _ := other.algorithm.Marshaler()
+					otherPublicKey, otherPrivateKey, _ := otherMarshaler.Marshal(other.privateKey)
+					if _, err := marshaler.Unmarshal(otherPrivateKey); err == nil {
+						t.Errorf("expected %s private key decoding to fail", other.algorithm)
+					}
+					if _, err := marshaler.UnmarshalPublic(otherPublicKey); err == nil {
+						t.Errorf("expected %s public key decoding to fail", other.algorithm)
+					}
+				}
+			})
+			t.Run("refuse keys that are not PEM encoded", func(t *testing.T) {
+				if _, err := marshaler.Unmarshal([]byte("privateKey")); err == nil {
+					t.Errorf("expected private key decoding error")
+				}
+				if _, err := marshaler.UnmarshalPublic([]byte("publicKey")); err == nil {
+					t.Errorf("expected public key decoding error")
+				}
+			})
+		})
+	}
+	t.Run("decode legacy RSA keys", func(t *testing.T) {
+		privateKeyBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA_PRIVATE_KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKeyPair.Private)})
+		publicKeyBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA_PUBLIC_KEY", Bytes: x509.MarshalPKCS1PublicKey(rsaKeyPair.Public)})
+
+		privateKey, err := crypto.NewRSAMarshaler().Unmarshal(privateKeyBytes)
+		if err != nil || !rsaKeyPair.Private.Equal(privateKey) {
+			t.Errorf("expected legacy RSA private key to be decoded, error: %v", err)
+		}
+		publicKey, err := crypto.NewRSAMarshaler().UnmarshalPublic(publicKeyBytes)
+		if err != nil || !rsaKeyPair.Public.Equal(publicKey) {
+			t.Errorf("expected legacy RSA public key to be decoded, error: %v", err)
+		}
+	})
+	t.Run("decode legacy ECC keys", func(t *testing.T) {
+		ecPrivateKey, _ := x509.MarshalECPrivateKey(eccKeyPair.Private)
+		pkixPublicKey, _ := x509.MarshalPKIXPublicKey(eccKeyPair.Public)
+		privateKeyBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE_KEY", Bytes: ecPrivateKey})
+		publicKeyBytes := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC_KEY", Bytes: pkixPublicKey})
+
+		privateKey, err := crypto.NewECCMarshaler().Unmarshal(privateKeyBytes)
+		if err != nil || !eccKeyPair.Private.Equal(privateKey) {
+			t.Errorf("expected legacy ECC private key to be decoded, error: %v", err)
+		}
+		publicKey, err := crypto.NewECCMarshaler().UnmarshalPublic(publicKeyBytes)
+		if err != nil || !eccKeyPair.Public.Equal(publicKey) {
+			t.Errorf("expected legacy ECC public key to be decoded, error: %v", err)
+		}
+	})
+	t.Run("marshaler of unsupported algorithm", func(t *testing.T) {
+		_, err := crypto.KeyAlgorithm("DSA").Marshaler()
+		var notSupported crypto.KeyAlgorithmNotSupportedError
+		if !errors.As(err, &notSupported) {
+			t.Errorf("expected DSA marshaler lookup to fail with KeyAlgorithmNotSupportedError, got %v", err)
+		}
+	})
+}
+
+func assertPEMBlockType(t *testing.T, expected string, keyBytes []byte) {
+	t.Helper()
+
+	block, _ := pem.Decode(keyBytes)
+	if block == nil || block.Type != expected {
+		t.Errorf("expected %q PEM block, got %v", expected, block)
+	}
+}
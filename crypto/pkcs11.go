@@ -0,0 +1,406 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"github.com/google/uuid"
+)
+
+// PKCS#11 constants used by PKCS11KeyStore, as defined by the PKCS#11 v2.40 specification
+// and, for EdDSA keys, by the PKCS#11 v3.0 one.
+const (
+	CKO_PUBLIC_KEY  uint = 0x02
+	CKO_PRIVATE_KEY uint = 0x03
+
+	CKK_RSA uint = 0x00
+	CKK_EC  uint = 0x03
+
+	CKK_EC_EDWARDS uint = 0x40
+
+	CKA_CLASS           uint = 0x000
+	CKA_TOKEN           uint = 0x001
+	CKA_PRIVATE         uint = 0x002
+	CKA_KEY_TYPE        uint = 0x100
+	CKA_ID              uint = 0x102
+	CKA_SENSITIVE       uint = 0x103
+	CKA_SIGN            uint = 0x108
+	CKA_VERIFY          uint = 0x10A
+	CKA_MODULUS         uint = 0x120
+	CKA_MODULUS_BITS    uint = 0x121
+	CKA_PUBLIC_EXPONENT uint = 0x122
+	CKA_PUBLIC_KEY_INFO uint = 0x129
+	CKA_EXTRACTABLE     uint = 0x162
+	CKA_EC_PARAMS       uint = 0x180
+	CKA_EC_POINT        uint = 0x181
+
+	CKM_RSA_PKCS_KEY_PAIR_GEN uint = 0x0000
+	CKM_SHA256_RSA_PKCS_PSS   uint = 0x0043
+	CKM_SHA256                uint = 0x0250
+	CKM_EC_KEY_PAIR_GEN       uint = 0x1040
+	CKM_ECDSA_SHA256          uint = 0x1044
+
+	CKM_EC_EDWARDS_KEY_PAIR_GEN uint = 0x1055
+	CKM_EDDSA                   uint = 0x1057
+
+	CKG_MGF1_SHA256 uint = 0x0002
+)
+
+// PKCS11ObjectHandle identifies an object of a PKCS#11 token.
+type PKCS11ObjectHandle uint
+
+// PKCS11Attribute is a PKCS#11 object attribute. Values are encoded as by the C API:
+// CK_ULONG as a C unsigned long in native byte order, CK_BBOOL as a single byte.
+type PKCS11Attribute struct {
+	Type  uint
+	Value []byte
+}
+
+// PKCS11Mechanism is a PKCS#11 mechanism, with its encoded parameter if any.
+type PKCS11Mechanism struct {
+	Mechanism uint
+	Parameter []byte
+}
+
+// PKCS11Session is the subset of the PKCS#11 API used by PKCS11KeyStore, bound to an open
+// and logged in session: it maps one to one on C_GenerateKeyPair, C_FindObjects (run
+// between C_FindObjectsInit and C_FindObjectsFinal), C_GetAttributeValue, C_SignInit,
+// C_Sign and C_DestroyObject, so that it can be backed by any PKCS#11 module, e.g. SoftHSM.
+type PKCS11Session interface {
+	GenerateKeyPair(mechanisms []*PKCS11Mechanism, publicKeyTemplate []*PKCS11Attribute, privateKeyTemplate []*PKCS11Attribute) (PKCS11ObjectHandle, PKCS11ObjectHandle, error)
+	FindObjects(template []*PKCS11Attribute) ([]PKCS11ObjectHandle, error)
+	GetAttributeValue(object PKCS11ObjectHandle, template []*PKCS11Attribute) ([]*PKCS11Attribute, error)
+	SignInit(mechanisms []*PKCS11Mechanism, key PKCS11ObjectHandle) error
+	Sign(message []byte) ([]byte, error)
+	DestroyObject(object PKCS11ObjectHandle) error
+}
+
+// eccCurveOIDs are the object identifiers of the curves of the generated ECDSA keys.
+var eccCurveOIDs = map[string]asn1.ObjectIdentifier{
+	"P-256": {1, 2, 840, 10045, 3, 1, 7},
+	"P-384": {1, 3, 132, 0, 34},
+	"P-521": {1, 3, 132, 0, 35},
+}
+
+// pkcs11Marshalers are the marshalers of the public keys of the key families of the
+// CKA_KEY_TYPE values supported by PKCS11KeyStore.
+var pkcs11Marshalers = map[KeyFamily]KeyMarshaler{
+	RSAFamily:   RSAMarshaler{},
+	ECDSAFamily: ECCMarshaler{},
+	EdDSAFamily: Ed25519Marshaler{},
+}
+
+// ed25519OID is the object identifier of Ed25519, the curve of the generated EdDSA keys,
+// and ecPublicKeyOID the algorithm identifier of ECDSA public keys.
+var (
+	ed25519OID     = asn1.ObjectIdentifier{1, 3, 101, 112}
+	ecPublicKeyOID = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+)
+
+// PKCS11UlongSize is the size in bytes of CK_ULONG, a C unsigned long, on the platform the
+// service runs on: 4 bytes on Windows and 32-bit platforms, 8 bytes on 64-bit Unix ones.
+var PKCS11UlongSize = nativeUlongSize()
+
+func nativeUlongSize() int {
+	if runtime.GOOS == "windows" {
+		return 4
+	}
+	return int(unsafe.Sizeof(uintptr(0)))
+}
+
+// PKCS11KeyStore is a KeyStore backed by a PKCS#11 token: keys are generated on the token
+// as sensitive, non extractable objects, identified by their key handle as CKA_ID, and
+// private keys never leave it. Signing operations are serialized on the session.
+type PKCS11KeyStore struct {
+	lock      sync.Mutex
+	session   PKCS11Session
+	ulongSize int
+}
+
+// NewPKCS11KeyStore creates a PKCS11KeyStore on session, encoding CK_ULONG values with the
+// PKCS11UlongSize of the platform.
+func NewPKCS11KeyStore(session PKCS11Session) (*PKCS11KeyStore, error) {
+	return NewPKCS11KeyStoreWithUlongSize(session, PKCS11UlongSize)
+}
+
+// NewPKCS11KeyStoreWithUlongSize creates a PKCS11KeyStore on session, encoding CK_ULONG
+// values on ulongSize bytes, 4 or 8, for modules whose unsigned long differs from the
+// one of the platform.
+func NewPKCS11KeyStoreWithUlongSize(session PKCS11Session, ulongSize int) (*PKCS11KeyStore, error) {
+	if ulongSize != 4 && ulongSize != 8 {
+		return nil, fmt.Errorf("CK_ULONG size must be 4 or 8 bytes, got %d", ulongSize)
+	}
+	return &PKCS11KeyStore{session: session, ulongSize: ulongSize}, nil
+}
+
+func (s *PKCS11KeyStore) GenerateKey(algorithm KeyAlgorithm) (KeyHandle, error) {
+	handle := KeyHandle(uuid.NewString())
+	publicKeyTemplate := []*PKCS11Attribute{
+		{CKA_CLASS, s.ulong(CKO_PUBLIC_KEY)},
+		{CKA_TOKEN, pkcs11Bool(true)},
+		{CKA_VERIFY, pkcs11Bool(true)},
+		{CKA_ID, []byte(handle)},
+	}
+	privateKeyTemplate := []*PKCS11Attribute{
+		{CKA_CLASS, s.ulong(CKO_PRIVATE_KEY)},
+		{CKA_TOKEN, pkcs11Bool(true)},
+		{CKA_PRIVATE, pkcs11Bool(true)},
+		{CKA_SIGN, pkcs11Bool(true)},
+		{CKA_SENSITIVE, pkcs11Bool(true)},
+		{CKA_EXTRACTABLE, pkcs11Bool(false)},
+		{CKA_ID, []byte(handle)},
+	}
+
+	var mechanism uint
+	parameters, _ := algorithm.Parameters()
+	switch parameters.Family {
+	case RSAFamily:
+		mechanism = CKM_RSA_PKCS_KEY_PAIR_GEN
+		publicKeyTemplate = append(publicKeyTemplate,
+			&PKCS11Attribute{CKA_KEY_TYPE, s.ulong(CKK_RSA)},
+			&PKCS11Attribute{CKA_MODULUS_BITS, s.ulong(uint(parameters.KeySize))},
+			&PKCS11Attribute{CKA_PUBLIC_EXPONENT, big.NewInt(65537).Bytes()},
+		)
+		privateKeyTemplate = append(privateKeyTemplate, &PKCS11Attribute{CKA_KEY_TYPE, s.ulong(CKK_RSA)})
+	case ECDSAFamily:
+		mechanism = CKM_EC_KEY_PAIR_GEN
+		curveParameters, err := asn1.Marshal(eccCurveOIDs[parameters.Curve.Params().Name])
+		if err != nil {
+			return "", err
+		}
+		publicKeyTemplate = append(publicKeyTemplate,
+			&PKCS11Attribute{CKA_KEY_TYPE, s.ulong(CKK_EC)},
+			&PKCS11Attribute{CKA_EC_PARAMS, curveParameters},
+		)
+		privateKeyTemplate = append(privateKeyTemplate, &PKCS11Attribute{CKA_KEY_TYPE, s.ulong(CKK_EC)})
+	case EdDSAFamily:
+		mechanism = CKM_EC_EDWARDS_KEY_PAIR_GEN
+		curveParameters, err := asn1.Marshal(ed25519OID)
+		if err != nil {
+			return "", err
+		}
+		publicKeyTemplate = append(publicKeyTemplate,
+			&PKCS11Attribute{CKA_KEY_TYPE, s.ulong(CKK_EC_EDWARDS)},
+			&PKCS11Attribute{CKA_EC_PARAMS, curveParameters},
+		)
+		privateKeyTemplate = append(privateKeyTemplate, &PKCS11Attribute{CKA_KEY_TYPE, s.ulong(CKK_EC_EDWARDS)})
+	default:
+		return "", keyAlgorithmNotSupported(algorithm)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, _, err := s.session.GenerateKeyPair([]*PKCS11Mechanism{{Mechanism: mechanism}}, publicKeyTemplate, privateKeyTemplate); err != nil {
+		return "", err
+	}
+	return handle, nil
+}
+
+func (s *PKCS11KeyStore) PublicKey(handle KeyHandle) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	object, err := s.findKey(handle, CKO_PUBLIC_KEY)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := s.session.GetAttributeValue(object, []*PKCS11Attribute{{Type: CKA_KEY_TYPE}})
+	if err != nil {
+		return nil, err
+	}
+	family, err := s.keyFamily(attributes[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	// CKA_PUBLIC_KEY_INFO is a PKCS#11 v2.40 addition many tokens do not provide:
+	// without it the public key is rebuilt from the attributes of its key type
+	var subjectPublicKeyInfo []byte
+	if attributes, err := s.session.GetAttributeValue(object, []*PKCS11Attribute{{Type: CKA_PUBLIC_KEY_INFO}}); err == nil {
+		subjectPublicKeyInfo = attributes[0].Value
+	}
+	if len(subjectPublicKeyInfo) == 0 {
+		if subjectPublicKeyInfo, err = s.subjectPublicKeyInfo(object, family); err != nil {
+			return nil, err
+		}
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(subjectPublicKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return pkcs11Marshalers[family].MarshalPublic(publicKey)
+}
+
+// subjectPublicKeyInfo builds the PKIX encoding of the public key object from
+// CKA_MODULUS and CKA_PUBLIC_EXPONENT for RSA keys, and from CKA_EC_PARAMS and
+// CKA_EC_POINT for ECDSA and EdDSA ones.
+func (s *PKCS11KeyStore) subjectPublicKeyInfo(object PKCS11ObjectHandle, family KeyFamily) ([]byte, error) {
+	if family == RSAFamily {
+		attributes, err := s.session.GetAttributeValue(object, []*PKCS11Attribute{{Type: CKA_MODULUS}, {Type: CKA_PUBLIC_EXPONENT}})
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(attributes[1].Value)
+		if len(attributes[0].Value) == 0 || !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA public key attributes")
+		}
+		return x509.MarshalPKIXPublicKey(&rsa.PublicKey{N: new(big.Int).SetBytes(attributes[0].Value), E: int(exponent.Int64())})
+	}
+
+	attributes, err := s.session.GetAttributeValue(object, []*PKCS11Attribute{{Type: CKA_EC_PARAMS}, {Type: CKA_EC_POINT}})
+	if err != nil {
+		return nil, err
+	}
+	// CKA_EC_POINT is a DER OCTET STRING wrapping the point, though some tokens
+	// return the bare point
+	point := attributes[1].Value
+	var wrapped []byte
+	if rest, err := asn1.Unmarshal(point, &wrapped); err == nil && len(rest) == 0 {
+		point = wrapped
+	}
+	var algorithm pkix.AlgorithmIdentifier
+	if family == EdDSAFamily {
+		algorithm = pkix.AlgorithmIdentifier{Algorithm: ed25519OID}
+	} else {
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attributes[0].Value, &curve); err != nil {
+			return nil, fmt.Errorf("invalid CKA_EC_PARAMS value %x", attributes[0].Value)
+		}
+		algorithm = pkix.AlgorithmIdentifier{Algorithm: ecPublicKeyOID, Parameters: asn1.RawValue{FullBytes: attributes[0].Value}}
+	}
+	return asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{algorithm, asn1.BitString{Bytes: point, BitLength: 8 * len(point)}})
+}
+
+// Sign signs message on the token, with CKM_SHA256_RSA_PKCS_PSS for RSA keys,
+// CKM_ECDSA_SHA256 for ECDSA keys, whose raw signatures are converted to ASN.1, and
+// CKM_EDDSA for EdDSA keys.
+func (s *PKCS11KeyStore) Sign(handle KeyHandle, message []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	object, err := s.findKey(handle, CKO_PRIVATE_KEY)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := s.session.GetAttributeValue(object, []*PKCS11Attribute{{Type: CKA_KEY_TYPE}})
+	if err != nil {
+		return nil, err
+	}
+	family, err := s.keyFamily(attributes[0].Value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch family {
+	case RSAFamily:
+		// CK_RSA_PKCS_PSS_PARAMS: hash algorithm, mask generation function and salt length
+		parameter := append(append(s.ulong(CKM_SHA256), s.ulong(CKG_MGF1_SHA256)...), s.ulong(sha256.Size)...)
+		if err := s.session.SignInit([]*PKCS11Mechanism{{Mechanism: CKM_SHA256_RSA_PKCS_PSS, Parameter: parameter}}, object); err != nil {
+			return nil, err
+		}
+		return s.session.Sign(message)
+	case EdDSAFamily:
+		if err := s.session.SignInit([]*PKCS11Mechanism{{Mechanism: CKM_EDDSA}}, object); err != nil {
+			return nil, err
+		}
+		return s.session.Sign(message)
+	default:
+		if err := s.session.SignInit([]*PKCS11Mechanism{{Mechanism: CKM_ECDSA_SHA256}}, object); err != nil {
+			return nil, err
+		}
+		signature, err := s.session.Sign(message)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaSignatureToASN1(signature)
+	}
+}
+
+// Destroy removes both the private and the public key objects of handle from the token.
+func (s *PKCS11KeyStore) Destroy(handle KeyHandle) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	objects, err := s.session.FindObjects([]*PKCS11Attribute{{CKA_ID, []byte(handle)}})
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return keyNotFound(handle)
+	}
+	for _, object := range objects {
+		if err := s.session.DestroyObject(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PKCS11KeyStore) findKey(handle KeyHandle, class uint) (PKCS11ObjectHandle, error) {
+	objects, err := s.session.FindObjects([]*PKCS11Attribute{{CKA_CLASS, s.ulong(class)}, {CKA_ID, []byte(handle)}})
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, keyNotFound(handle)
+	}
+	return objects[0], nil
+}
+
+func (s *PKCS11KeyStore) keyFamily(keyType []byte) (KeyFamily, error) {
+	if len(keyType) != s.ulongSize {
+		return "", fmt.Errorf("invalid CKA_KEY_TYPE value %x", keyType)
+	}
+	value := uint(binary.NativeEndian.Uint32(keyType))
+	if s.ulongSize == 8 {
+		value = uint(binary.NativeEndian.Uint64(keyType))
+	}
+	switch value {
+	case CKK_RSA:
+		return RSAFamily, nil
+	case CKK_EC:
+		return ECDSAFamily, nil
+	case CKK_EC_EDWARDS:
+		return EdDSAFamily, nil
+	default:
+		return "", fmt.Errorf("unsupported CKA_KEY_TYPE value %x", keyType)
+	}
+}
+
+// ecdsaSignatureToASN1 converts a PKCS#11 ECDSA signature, the concatenation of r and s,
+// into the ASN.1 form produced by the software signers.
+func ecdsaSignatureToASN1(signature []byte) ([]byte, error) {
+	if len(signature) == 0 || len(signature)%2 != 0 || len(signature)/2 > (elliptic.P521().Params().BitSize+7)/8 {
+		return nil, fmt.Errorf("invalid ECDSA signature length %d", len(signature))
+	}
+	half := len(signature) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(signature[:half]), new(big.Int).SetBytes(signature[half:])})
+}
+
+// ulong encodes value as a CK_ULONG of the module.
+func (s *PKCS11KeyStore) ulong(value uint) []byte {
+	if s.ulongSize == 4 {
+		return binary.NativeEndian.AppendUint32(nil, uint32(value))
+	}
+	return binary.NativeEndian.AppendUint64(nil, uint64(value))
+}
+
+func pkcs11Bool(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+	return []byte{0}
+}
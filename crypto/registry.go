@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"crypto"
+	"fmt"
+	"sync"
+)
+
+// KeyGenerator generates the private key of a key algorithm.
+type KeyGenerator func() (crypto.Signer, error)
+
+// SignFunc signs a message, the secured data string assembled by SignatureInput, with a
+// private key of a key algorithm.
+type SignFunc func(privateKey crypto.Signer, message []byte) ([]byte, error)
+
+// VerifierFactory creates the Verifier of a device from its encoded public key and the
+// state of its signature chain.
+type VerifierFactory func(devicePublicKey []byte, lastSignature string, signatureCount int) (Verifier, error)
+
+// Algorithm bundles what a key algorithm needs to generate, store and sign with keys and
+// to verify their signatures.
+type Algorithm struct {
+	Parameters  KeyAlgorithmParameters
+	Generate    KeyGenerator
+	Marshaler   KeyMarshaler
+	Sign        SignFunc
+	NewVerifier VerifierFactory
+}
+
+// AlgorithmRegistry holds the supported key algorithms, in registration order.
+// It is safe for concurrent use.
+type AlgorithmRegistry struct {
+	lock       sync.RWMutex
+	order      []KeyAlgorithm
+	algorithms map[KeyAlgorithm]Algorithm
+}
+
+func NewAlgorithmRegistry() *AlgorithmRegistry {
+	return &AlgorithmRegistry{algorithms: map[KeyAlgorithm]Algorithm{}}
+}
+
+// DefaultAlgorithmRegistry holds the built-in key algorithms. Key stores and signature
+// devices resolve their algorithms from it, so that registering an algorithm here is
+// enough to create devices using it.
+var DefaultAlgorithmRegistry = newDefaultAlgorithmRegistry()
+
+// RegisterAlgorithm registers algorithm in the DefaultAlgorithmRegistry.
+func RegisterAlgorithm(name KeyAlgorithm, algorithm Algorithm) error {
+	return DefaultAlgorithmRegistry.Register(name, algorithm)
+}
+
+// Register adds algorithm under name. Algorithms cannot be registered twice, nor without
+// a generator, a marshaler, a sign function and a verifier factory.
+func (r *AlgorithmRegistry) Register(name KeyAlgorithm, algorithm Algorithm) error {
+	if name == "" {
+		return fmt.Errorf("key algorithm name is empty")
+	}
+	if algorithm.Generate == nil || algorithm.Marshaler == nil || algorithm.Sign == nil || algorithm.NewVerifier == nil {
+		return fmt.Errorf("key algorithm %s is incomplete", name)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.algorithms[name]; found {
+		return fmt.Errorf("key algorithm %s already registered", name)
+	}
+	r.algorithms[name] = algorithm
+	r.order = append(r.order, name)
+	return nil
+}
+
+// Lookup returns the algorithm registered under name, or a KeyAlgorithmNotSupportedError.
+func (r *AlgorithmRegistry) Lookup(name KeyAlgorithm) (Algorithm, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	algorithm, found := r.algorithms[name]
+	if !found {
+		return Algorithm{}, keyAlgorithmNotSupported(name)
+	}
+	return algorithm, nil
+}
+
+// Algorithms returns the names of the registered algorithms, in registration order.
+func (r *AlgorithmRegistry) Algorithms() []KeyAlgorithm {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return append([]KeyAlgorithm{}, r.order...)
+}
@@ -0,0 +1,89 @@
+package crypto_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+func TestAlgorithmRegistry(t *testing.T) {
+	ed25519Algorithm, _ := crypto.DefaultAlgorithmRegistry.Lookup(crypto.Ed25519KeyAlgorithm)
+
+	t.Run("register and look up algorithms", func(t *testing.T) {
+		registry := crypto.NewAlgorithmRegistry()
+		for _, name := range []crypto.KeyAlgorithm{"second", "first"} {
+			if err := registry.Register(name, ed25519Algorithm); err != nil {
+				t.Fatalf("an error occurred during algorithm registration, error: %s", err.Error())
+			}
+		}
+
+		if got := registry.Algorithms(); len(got) != 2 || got[0] != "second" || got[1] != "first" {
+			t.Errorf("expected algorithms in registration order, got %v", got)
+		}
+		algorithm, err := registry.Lookup("first")
+		if err != nil || algorithm.Parameters.Family != crypto.EdDSAFamily {
+			t.Errorf("expected registered algorithm to be found, error: %v", err)
+		}
+	})
+	t.Run("look up unknown algorithm", func(t *testing.T) {
+		_, err := crypto.NewAlgorithmRegistry().Lookup("unknown")
+		var notSupported crypto.KeyAlgorithmNotSupportedError
+		if !errors.As(err, &notSupported) {
+			t.Errorf("expected KeyAlgorithmNotSupportedError, got %v", err)
+		}
+	})
+	t.Run("refuse duplicate and incomplete algorithms", func(t *testing.T) {
+		registry := crypto.NewAlgorithmRegistry()
+		registry.Register("algorithm", ed25519Algorithm)
+		if err := registry.Register("algorithm", ed25519Algorithm); err == nil {
+			t.Errorf("expected duplicate algorithm registration to fail")
+		}
+
+		incomplete := ed25519Algorithm
+		incomplete.NewVerifier = nil
+		if err := registry.Register("incomplete", incomplete); err == nil {
+			t.Errorf("expected incomplete algorithm registration to fail")
+		}
+		if err := registry.Register("", ed25519Algorithm); err == nil {
+			t.Errorf("expected unnamed algorithm registration to fail")
+		}
+	})
+	t.Run("built-in algorithms sign through the key store and verify through their factories", func(t *testing.T) {
+		lastSignature := "lastSignature"
+		signatureCount := 2
+		dataToBeSigned := []byte("test data")
+		masterKey, _ := crypto.GenerateMasterKey("registry")
+		keyring, _ := crypto.NewKeyring(masterKey)
+		keyStore, _ := crypto.NewSoftwareKeyStore(keyring, "")
+		for _, name := range []crypto.KeyAlgorithm{crypto.RSA2048KeyAlgorithm, crypto.ECDSAP256KeyAlgorithm, crypto.Ed25519KeyAlgorithm} {
+			t.Run(string(name), func(t *testing.T) {
+				algorithm, err := crypto.DefaultAlgorithmRegistry.Lookup(name)
+				if err != nil {
+					t.Fatalf("an error occurred during algorithm lookup, error: %s", err.Error())
+				}
+				handle, err := keyStore.GenerateKey(name)
+				if err != nil {
+					t.Fatalf("an error occurred during key generation, error: %s", err.Error())
+				}
+				publicKey, _ := keyStore.PublicKey(handle)
+
+				message := []byte(crypto.SignatureInput(signatureCount, dataToBeSigned, lastSignature))
+				signature, err := keyStore.Sign(handle, message)
+				if err != nil {
+					t.Fatalf("an error occurred during signing, error: %s", err.Error())
+				}
+				verifier, _ := algorithm.NewVerifier(publicKey, lastSignature, signatureCount)
+				if valid, err := verifier.Verify(dataToBeSigned, signature); !valid || err != nil {
+					t.Errorf("expected key store signature to verify, error: %v", err)
+				}
+			})
+		}
+	})
+	t.Run("default registry parameters", func(t *testing.T) {
+		parameters, found := crypto.ECDSAP521KeyAlgorithm.Parameters()
+		if !found || parameters.KeySize != 521 || parameters.Curve == nil {
+			t.Errorf("expected ECDSA P-521 parameters, got %v", parameters)
+		}
+	})
+}
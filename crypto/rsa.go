@@ -1,9 +1,16 @@
 package crypto
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/pem"
+	"errors"
+)
+
+// Legacy PEM block types of PKCS#1 encoded RSA keys.
+const (
+	legacyRSAPrivateKeyBlockType = "RSA_PRIVATE_KEY"
+	legacyRSAPublicKeyBlockType  = "RSA_PUBLIC_KEY"
 )
 
 // RSAKeyPair is a DTO that holds RSA private and public keys.
@@ -12,7 +19,8 @@ type RSAKeyPair struct {
 	Private *rsa.PrivateKey
 }
 
-// RSAMarshaler can encode and decode an RSA key pair.
+// RSAMarshaler is the KeyMarshaler of RSA keys. It also reads the PKCS#1
+// "RSA_PRIVATE_KEY" and "RSA_PUBLIC_KEY" blocks RSA keys used to be encoded with.
 type RSAMarshaler struct{}
 
 // NewRSAMarshaler creates a new RSAMarshaler.
@@ -20,35 +28,66 @@ func NewRSAMarshaler() RSAMarshaler {
 	return RSAMarshaler{}
 }
 
-// Marshal takes an RSAKeyPair and encodes it to be written on disk.
-// It returns the public and the private key as a byte slice.
-func (m *RSAMarshaler) Marshal(keyPair RSAKeyPair) ([]byte, []byte, error) {
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(keyPair.Private)
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(keyPair.Public)
+func (m RSAMarshaler) Marshal(privateKey crypto.Signer) ([]byte, []byte, error) {
+	if _, ok := privateKey.(*rsa.PrivateKey); !ok {
+		return nil, nil, errors.New("private key is not an RSA private key")
+	}
+	return marshalKeyPair(privateKey)
+}
 
-	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PRIVATE_KEY",
-		Bytes: privateKeyBytes,
-	})
+func (m RSAMarshaler) MarshalPublic(publicKey crypto.PublicKey) ([]byte, error) {
+	if _, ok := publicKey.(*rsa.PublicKey); !ok {
+		return nil, errors.New("public key is not an RSA public key")
+	}
+	return marshalPublicKey(publicKey)
+}
 
-	encodePublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PUBLIC_KEY",
-		Bytes: publicKeyBytes,
-	})
+func (m RSAMarshaler) Unmarshal(privateKeyBytes []byte) (crypto.Signer, error) {
+	block, err := decodeKeyBlock(privateKeyBytes, "RSA private key")
+	if err != nil {
+		return nil, err
+	}
 
-	return encodePublic, encodedPrivate, nil
+	var privateKey any
+	switch block.Type {
+	case privateKeyBlockType:
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case legacyRSAPrivateKeyBlockType:
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, unexpectedBlockType(block, "RSA private key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA private key")
+	}
+	return rsaPrivateKey, nil
 }
 
-// Unmarshal takes an encoded RSA private key and transforms it into a rsa.PrivateKey.
-func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+func (m RSAMarshaler) UnmarshalPublic(publicKeyBytes []byte) (crypto.PublicKey, error) {
+	block, err := decodeKeyBlock(publicKeyBytes, "RSA public key")
 	if err != nil {
 		return nil, err
 	}
 
-	return &RSAKeyPair{
-		Private: privateKey,
-		Public:  &privateKey.PublicKey,
-	}, nil
+	var publicKey any
+	switch block.Type {
+	case publicKeyBlockType:
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case legacyRSAPublicKeyBlockType:
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, unexpectedBlockType(block, "RSA public key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA public key")
+	}
+	return rsaPublicKey, nil
 }
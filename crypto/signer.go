@@ -2,13 +2,13 @@ package crypto
 
 import (
 	"crypto"
-	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"log"
+	"strconv"
+	"strings"
 )
 
 // Signer defines a contract for different types of signing implementations.
@@ -16,63 +16,108 @@ type Signer interface {
 	Sign(dataToBeSigned []byte) ([]byte, error)
 }
 
-// TODO: implement RSA and ECDSA signing ...
+// SignatureInput assembles the secured data string signed by a device:
+// <signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>.
+func SignatureInput(signatureCount int, dataToBeSigned []byte, lastSignature string) string {
+	encodedLastSignature := base64.StdEncoding.EncodeToString([]byte(lastSignature))
+	return fmt.Sprintf("%d_%s_%s", signatureCount, string(dataToBeSigned), encodedLastSignature)
+}
+
+// ParseSignatureInput splits a secured data string assembled by SignatureInput into the
+// signature counter, the signed data and the base64 encoded last signature. Signed data
+// may contain underscores, since the base64 alphabet of the last signature does not.
+func ParseSignatureInput(signatureInput string) (int, []byte, string, error) {
+	encodedCounter, rest, found := strings.Cut(signatureInput, "_")
+	separator := strings.LastIndex(rest, "_")
+	if !found || separator < 0 {
+		return 0, nil, "", fmt.Errorf("signed data %q is not in the <counter>_<data>_<last_signature> form", signatureInput)
+	}
+	signatureCount, err := strconv.Atoi(encodedCounter)
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("signed data %q does not start with a signature counter", signatureInput)
+	}
+	return signatureCount, []byte(rest[:separator]), rest[separator+1:], nil
+}
+
+// signatureDigest hashes the secured data string with SHA-256.
+func signatureDigest(signatureInput string) []byte {
+	msgHashSum := sha256.Sum256([]byte(signatureInput))
+	return msgHashSum[:]
+}
+
+// RSASigner signs data with an RSA private key using RSA-PSS.
 type RSASigner struct {
 	devicePrivateKey []byte
 	lastSignature    string
 	signatureCount   int
-	marshaler        *RSAMarshaler
+	marshaler        RSAMarshaler
 }
 
 func NewRSASigner(devicePrivateKey []byte, lastSignature string, signatureCount int) (*RSASigner, error) {
-	return &RSASigner{devicePrivateKey: devicePrivateKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: &RSAMarshaler{}}, nil
+	return &RSASigner{devicePrivateKey: devicePrivateKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: RSAMarshaler{}}, nil
 }
 
 func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	keyPair, err := s.marshaler.Unmarshal(s.devicePrivateKey)
+	privateKey, err := s.marshaler.Unmarshal(s.devicePrivateKey)
 	if err != nil {
-		log.Fatalf("an error occurred while unmarshalling private key: %s", err.Error())
 		return nil, err
 	}
-	encodedLastSignature := base64.StdEncoding.EncodeToString([]byte(s.lastSignature))
-	signatureInput := fmt.Sprintf("%d_%s_%s", s.signatureCount, string(dataToBeSigned), encodedLastSignature)
-
-	msgHash := sha256.New()
-	_, err = msgHash.Write([]byte(signatureInput))
-	if err != nil {
-		log.Fatalf("an error occurred while hashing data to be signed: %s", err.Error())
-	}
-	msgHashSum := msgHash.Sum(nil)
+	return signRSA(privateKey, []byte(SignatureInput(s.signatureCount, dataToBeSigned, s.lastSignature)))
+}
 
-	return rsa.SignPSS(rand.Reader, keyPair.Private, crypto.SHA256, msgHashSum, nil)
+// signRSA signs the SHA-256 digest of message with RSA-PSS.
+func signRSA(privateKey crypto.Signer, message []byte) ([]byte, error) {
+	return privateKey.Sign(rand.Reader, signatureDigest(string(message)), &rsa.PSSOptions{Hash: crypto.SHA256})
 }
 
+// ECDSASigner signs data with an ECC private key using ECDSA (ASN.1 encoded signatures).
 type ECDSASigner struct {
 	devicePrivateKey []byte
 	lastSignature    string
 	signatureCount   int
-	marshaler        *ECCMarshaler
+	marshaler        ECCMarshaler
 }
 
 func NewECDSASigner(devicePrivateKey []byte, lastSignature string, signatureCount int) (*ECDSASigner, error) {
-	return &ECDSASigner{devicePrivateKey: devicePrivateKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: &ECCMarshaler{}}, nil
+	return &ECDSASigner{devicePrivateKey: devicePrivateKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: ECCMarshaler{}}, nil
 }
 
 func (s *ECDSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	keyPair, err := s.marshaler.Decode(s.devicePrivateKey)
+	privateKey, err := s.marshaler.Unmarshal(s.devicePrivateKey)
 	if err != nil {
-		log.Fatalf("an error occurred while unmarshalling private key: %s", err.Error())
 		return nil, err
 	}
-	encodedLastSignature := base64.StdEncoding.EncodeToString([]byte(s.lastSignature))
-	signatureInput := fmt.Sprintf("%d_%s_%s", s.signatureCount, string(dataToBeSigned), encodedLastSignature)
+	return signECDSA(privateKey, []byte(SignatureInput(s.signatureCount, dataToBeSigned, s.lastSignature)))
+}
+
+// signECDSA signs the SHA-256 digest of message with ECDSA, returning an ASN.1 signature.
+func signECDSA(privateKey crypto.Signer, message []byte) ([]byte, error) {
+	return privateKey.Sign(rand.Reader, signatureDigest(string(message)), crypto.SHA256)
+}
+
+// Ed25519Signer signs data with an Ed25519 private key. Unlike the RSA and ECDSA signers it
+// signs the secured data string itself, as Ed25519 hashes the message internally, so that
+// signatures are deterministic and verify with any standard Ed25519 verifier.
+type Ed25519Signer struct {
+	devicePrivateKey []byte
+	lastSignature    string
+	signatureCount   int
+	marshaler        Ed25519Marshaler
+}
+
+func NewEd25519Signer(devicePrivateKey []byte, lastSignature string, signatureCount int) (*Ed25519Signer, error) {
+	return &Ed25519Signer{devicePrivateKey: devicePrivateKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: Ed25519Marshaler{}}, nil
+}
 
-	msgHash := sha256.New()
-	_, err = msgHash.Write([]byte(signatureInput))
+func (s *Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	privateKey, err := s.marshaler.Unmarshal(s.devicePrivateKey)
 	if err != nil {
-		log.Fatalf("an error occurred while hashing data to be signed: %s", err.Error())
+		return nil, err
 	}
-	msgHashSum := msgHash.Sum(nil)
+	return signEd25519(privateKey, []byte(SignatureInput(s.signatureCount, dataToBeSigned, s.lastSignature)))
+}
 
-	return ecdsa.SignASN1(rand.Reader, keyPair.Private, msgHashSum)
+// signEd25519 signs message with Ed25519.
+func signEd25519(privateKey crypto.Signer, message []byte) ([]byte, error) {
+	return privateKey.Sign(nil, message, crypto.Hash(0))
 }
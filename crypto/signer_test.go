@@ -1,6 +1,10 @@
 package crypto_test
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
 	"testing"
 
 	"github.com/PaoloModica/signing-service-challenge-go/crypto"
@@ -11,12 +15,12 @@ func TestSigner(t *testing.T) {
 	RSAMarshaler := crypto.NewRSAMarshaler()
 	RSAKeyGen := &crypto.RSAGenerator{}
 	RSAPrivateKey, _ := RSAKeyGen.Generate()
-	_, marshalledRSAPrivateKey, _ := RSAMarshaler.Marshal(*RSAPrivateKey)
+	_, marshalledRSAPrivateKey, _ := RSAMarshaler.Marshal(RSAPrivateKey.Private)
 
 	ECCMarshaler := crypto.NewECCMarshaler()
 	ECCKeyGen := &crypto.ECCGenerator{}
 	ECCPrivateKey, _ := ECCKeyGen.Generate()
-	_, marshalledECCPrivateKey, _ := ECCMarshaler.Encode(*ECCPrivateKey)
+	_, marshalledECCPrivateKey, _ := ECCMarshaler.Marshal(ECCPrivateKey.Private)
 
 	signerParams := struct {
 		devicePrivateKey []byte
@@ -39,6 +43,29 @@ func TestSigner(t *testing.T) {
 			t.Errorf("expected RSA signer to be created, got error: %s", err.Error())
 		}
 	})
+	t.Run("assemble signature input", func(t *testing.T) {
+		got := crypto.SignatureInput(3, []byte("test data"), "lastSignature")
+		expected := "3_test data_bGFzdFNpZ25hdHVyZQ=="
+		if got != expected {
+			t.Errorf("expected signature input to be %s, got %s", expected, got)
+		}
+	})
+	t.Run("parse signature input", func(t *testing.T) {
+		signatureInput := crypto.SignatureInput(3, []byte("test_data"), "lastSignature")
+		signatureCount, dataToBeSigned, encodedLastSignature, err := crypto.ParseSignatureInput(signatureInput)
+		if err != nil {
+			t.Fatalf("an error occurred during signature input parsing, error: %s", err.Error())
+		}
+		if signatureCount != 3 || string(dataToBeSigned) != "test_data" || encodedLastSignature != "bGFzdFNpZ25hdHVyZQ==" {
+			t.Errorf("expected signature input %s to be split in its parts, got %d, %s, %s", signatureInput, signatureCount, dataToBeSigned, encodedLastSignature)
+		}
+
+		for _, malformed := range []string{"", "3", "3_data", "x_data_signature"} {
+			if _, _, _, err := crypto.ParseSignatureInput(malformed); err == nil {
+				t.Errorf("expected signature input %q parsing to fail", malformed)
+			}
+		}
+	})
 	t.Run("sign data", func(t *testing.T) {
 		rsaSigner, _ := crypto.NewRSASigner(marshalledRSAPrivateKey, signerParams.lastSignature, signerParams.signatureCount)
 		ecdsaSigner, _ := crypto.NewECDSASigner(marshalledECCPrivateKey, signerParams.lastSignature, signerParams.signatureCount)
@@ -59,4 +86,47 @@ func TestSigner(t *testing.T) {
 			}
 		})
 	})
+	t.Run("sign with Ed25519 deterministically", func(t *testing.T) {
+		// the private key of the first RFC 8032 Ed25519 test vector
+		seed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+		privateKey := ed25519.NewKeyFromSeed(seed)
+		_, marshalledEd25519PrivateKey, err := crypto.NewEd25519Marshaler().Marshal(privateKey)
+		if err != nil {
+			t.Fatalf("an error occurred during Ed25519 key encoding, error: %s", err.Error())
+		}
+
+		// a chain of two signatures, the first one chained to the device ID
+		firstSignature, _ := base64.StdEncoding.DecodeString("DJExSc7cFmPRg5V6tu2q/PiPqDUWk2CuWB5JxSzjjAPr32vznbH401YXFERKAxvjFbpFBhtiVqjbJU1mXGCkBA==")
+		secondSignature, _ := base64.StdEncoding.DecodeString("m1AmRcuc7tEiokJAmd1n9qjaZP2GxnqK4u/D5iF4hcKE91nxbQavcg+3wJwUB1oYj/W477M5mssjcCakpizrDQ==")
+		testVectors := []struct {
+			lastSignature  string
+			signatureCount int
+			expected       []byte
+		}{
+			{"deviceId", 0, firstSignature},
+			{string(firstSignature), 1, secondSignature},
+		}
+		for _, tv := range testVectors {
+			signer, _ := crypto.NewEd25519Signer(marshalledEd25519PrivateKey, tv.lastSignature, tv.signatureCount)
+			for i := 0; i < 2; i++ {
+				signature, err := signer.Sign([]byte("test data"))
+				if err != nil {
+					t.Fatalf("an error occurred during signing, error: %s", err.Error())
+				}
+				if !bytes.Equal(signature, tv.expected) {
+					t.Errorf("expected signature %d to be %s, got %s", tv.signatureCount, base64.StdEncoding.EncodeToString(tv.expected), base64.StdEncoding.EncodeToString(signature))
+				}
+			}
+		}
+	})
+	t.Run("sign with malformed private keys", func(t *testing.T) {
+		rsaSigner, _ := crypto.NewRSASigner(signerParams.devicePrivateKey, signerParams.lastSignature, signerParams.signatureCount)
+		ecdsaSigner, _ := crypto.NewECDSASigner(signerParams.devicePrivateKey, signerParams.lastSignature, signerParams.signatureCount)
+		ed25519Signer, _ := crypto.NewEd25519Signer(signerParams.devicePrivateKey, signerParams.lastSignature, signerParams.signatureCount)
+		for _, signer := range []crypto.Signer{rsaSigner, ecdsaSigner, ed25519Signer} {
+			if _, err := signer.Sign([]byte("test data")); err == nil {
+				t.Errorf("expected %T private key decoding error", signer)
+			}
+		}
+	})
 }
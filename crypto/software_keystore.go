@@ -0,0 +1,230 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/PaoloModica/signing-service-challenge-go/internal/fsync"
+	"github.com/google/uuid"
+)
+
+const softwareKeyFileExtension = ".key.json"
+
+// softwareKey is a key held by a SoftwareKeyStore, with its private key sealed.
+type softwareKey struct {
+	Algorithm  KeyAlgorithm `json:"algorithm"`
+	PublicKey  []byte       `json:"public_key"`
+	PrivateKey *SealedKey   `json:"sealed_private_key"`
+}
+
+// SoftwareKeyStore is a KeyStore generating keys in process. Private keys are sealed with
+// envelope encryption under the master keys of a Keyring, bound to their handle and
+// algorithm, and only decrypted for the time of a signing operation. Keys are kept in memory and, when a directory is given, each of
+// them is also written to its own file there, so that they outlive the process.
+type SoftwareKeyStore struct {
+	lock      sync.RWMutex
+	keyring   *Keyring
+	directory string
+	keys      map[KeyHandle]*softwareKey
+}
+
+// NewSoftwareKeyStore creates a SoftwareKeyStore sealing keys with keyring and, unless
+// directory is empty, persisting them there, loading the keys already stored.
+func NewSoftwareKeyStore(keyring *Keyring, directory string) (*SoftwareKeyStore, error) {
+	s := &SoftwareKeyStore{keyring: keyring, directory: directory, keys: map[KeyHandle]*softwareKey{}}
+	if directory == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, softwareKeyFileExtension) {
+			continue
+		}
+		keyBytes, err := os.ReadFile(filepath.Join(directory, fileName))
+		if err != nil {
+			return nil, err
+		}
+		var key softwareKey
+		if err := json.Unmarshal(keyBytes, &key); err != nil {
+			return nil, fmt.Errorf("key file %s is corrupted: %w", fileName, err)
+		}
+		s.keys[KeyHandle(strings.TrimSuffix(fileName, softwareKeyFileExtension))] = &key
+	}
+	return s, nil
+}
+
+func (s *SoftwareKeyStore) GenerateKey(algorithm KeyAlgorithm) (KeyHandle, error) {
+	publicKey, privateKey, err := generateEncodedKeyPair(algorithm)
+	if err != nil {
+		return "", err
+	}
+	handle := KeyHandle(uuid.NewString())
+	sealedPrivateKey, err := s.keyring.Seal(privateKey, sealingContext(handle, algorithm))
+	clear(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := &softwareKey{Algorithm: algorithm, PublicKey: publicKey, PrivateKey: sealedPrivateKey}
+	if err := s.write(handle, key); err != nil {
+		return "", err
+	}
+	s.keys[handle] = key
+	return handle, nil
+}
+
+func (s *SoftwareKeyStore) PublicKey(handle KeyHandle) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	key, found := s.keys[handle]
+	if !found {
+		return nil, keyNotFound(handle)
+	}
+	return key.PublicKey, nil
+}
+
+// Sign decrypts the private key of handle, signs message and clears the private key.
+func (s *SoftwareKeyStore) Sign(handle KeyHandle, message []byte) ([]byte, error) {
+	s.lock.RLock()
+	key, found := s.keys[handle]
+	s.lock.RUnlock()
+	if !found {
+		return nil, keyNotFound(handle)
+	}
+
+	privateKey, err := s.keyring.Open(key.PrivateKey, sealingContext(handle, key.Algorithm))
+	if err != nil {
+		return nil, err
+	}
+	defer clear(privateKey)
+
+	algorithm, err := DefaultAlgorithmRegistry.Lookup(key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := algorithm.Marshaler.Unmarshal(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return algorithm.Sign(signer, message)
+}
+
+func (s *SoftwareKeyStore) Destroy(handle KeyHandle) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.keys[handle]; !found {
+		return keyNotFound(handle)
+	}
+	if s.directory != "" {
+		if err := os.Remove(s.keyPath(handle)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := fsync.Directory(s.directory); err != nil {
+			return err
+		}
+	}
+	delete(s.keys, handle)
+	return nil
+}
+
+// RewrapKeys re-wraps the private keys sealed with a previous master key with the current
+// one, returning the number of re-wrapped keys. It completes a master key rotation: once
+// done, the previous master keys can be dropped from the keyring. Keys sealed before they
+// were bound to their handle and algorithm are sealed again, bound to them.
+func (s *SoftwareKeyStore) RewrapKeys() (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rewrapped := 0
+	for handle, key := range s.keys {
+		if key.PrivateKey.ContextBound && key.PrivateKey.MasterKeyId == s.keyring.CurrentMasterKeyId() {
+			continue
+		}
+		sealedPrivateKey, err := s.rewrap(handle, key)
+		if err != nil {
+			return rewrapped, fmt.Errorf("key %s cannot be re-wrapped: %w", handle, err)
+		}
+		rewrappedKey := &softwareKey{Algorithm: key.Algorithm, PublicKey: key.PublicKey, PrivateKey: sealedPrivateKey}
+		if err := s.write(handle, rewrappedKey); err != nil {
+			return rewrapped, err
+		}
+		s.keys[handle] = rewrappedKey
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+// rewrap wraps the private key of handle with the current master key, sealing it again
+// bound to its handle and algorithm if it is not.
+func (s *SoftwareKeyStore) rewrap(handle KeyHandle, key *softwareKey) (*SealedKey, error) {
+	if key.PrivateKey.ContextBound {
+		return s.keyring.Rewrap(key.PrivateKey)
+	}
+	context := sealingContext(handle, key.Algorithm)
+	privateKey, err := s.keyring.Open(key.PrivateKey, context)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(privateKey)
+	return s.keyring.Seal(privateKey, context)
+}
+
+// sealingContext is the context private keys are sealed for: their handle and algorithm,
+// so that a sealed key cannot be swapped between handles or algorithms.
+func sealingContext(handle KeyHandle, algorithm KeyAlgorithm) []byte {
+	return []byte(string(algorithm) + ":" + string(handle))
+}
+
+func (s *SoftwareKeyStore) keyPath(handle KeyHandle) string {
+	return filepath.Join(s.directory, string(handle)+softwareKeyFileExtension)
+}
+
+// write durably stores key in its own file, replacing any previous version atomically.
+func (s *SoftwareKeyStore) write(handle KeyHandle, key *softwareKey) error {
+	if s.directory == "" {
+		return nil
+	}
+	keyBytes, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	temporaryPath := s.keyPath(handle) + ".tmp"
+	if err := fsync.WriteFile(temporaryPath, keyBytes); err != nil {
+		return err
+	}
+	if err := os.Rename(temporaryPath, s.keyPath(handle)); err != nil {
+		return err
+	}
+	return fsync.Directory(s.directory)
+}
+
+// generateEncodedKeyPair generates a key pair for algorithm and returns its encoded
+// public and private keys.
+func generateEncodedKeyPair(name KeyAlgorithm) ([]byte, []byte, error) {
+	algorithm, err := DefaultAlgorithmRegistry.Lookup(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := algorithm.Generate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return algorithm.Marshaler.Marshal(privateKey)
+}
@@ -0,0 +1,81 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+)
+
+// Verifier defines a contract for different types of signature verification implementations.
+// Verify reconstructs the secured data string signed by a device and reports whether the
+// signature matches it; an error is returned only when verification cannot be performed.
+type Verifier interface {
+	Verify(dataToBeSigned []byte, signature []byte) (bool, error)
+}
+
+// RSAVerifier verifies RSA-PSS signatures against an RSA public key.
+type RSAVerifier struct {
+	devicePublicKey []byte
+	lastSignature   string
+	signatureCount  int
+	marshaler       RSAMarshaler
+}
+
+func NewRSAVerifier(devicePublicKey []byte, lastSignature string, signatureCount int) (*RSAVerifier, error) {
+	return &RSAVerifier{devicePublicKey: devicePublicKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: RSAMarshaler{}}, nil
+}
+
+func (v *RSAVerifier) Verify(dataToBeSigned []byte, signature []byte) (bool, error) {
+	publicKey, err := v.marshaler.UnmarshalPublic(v.devicePublicKey)
+	if err != nil {
+		return false, err
+	}
+	msgHashSum := signatureDigest(SignatureInput(v.signatureCount, dataToBeSigned, v.lastSignature))
+
+	return rsa.VerifyPSS(publicKey.(*rsa.PublicKey), crypto.SHA256, msgHashSum, signature, nil) == nil, nil
+}
+
+// ECDSAVerifier verifies ASN.1 encoded ECDSA signatures against an ECC public key.
+type ECDSAVerifier struct {
+	devicePublicKey []byte
+	lastSignature   string
+	signatureCount  int
+	marshaler       ECCMarshaler
+}
+
+func NewECDSAVerifier(devicePublicKey []byte, lastSignature string, signatureCount int) (*ECDSAVerifier, error) {
+	return &ECDSAVerifier{devicePublicKey: devicePublicKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: ECCMarshaler{}}, nil
+}
+
+func (v *ECDSAVerifier) Verify(dataToBeSigned []byte, signature []byte) (bool, error) {
+	publicKey, err := v.marshaler.UnmarshalPublic(v.devicePublicKey)
+	if err != nil {
+		return false, err
+	}
+	msgHashSum := signatureDigest(SignatureInput(v.signatureCount, dataToBeSigned, v.lastSignature))
+
+	return ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), msgHashSum, signature), nil
+}
+
+// Ed25519Verifier verifies Ed25519 signatures against an Ed25519 public key.
+type Ed25519Verifier struct {
+	devicePublicKey []byte
+	lastSignature   string
+	signatureCount  int
+	marshaler       Ed25519Marshaler
+}
+
+func NewEd25519Verifier(devicePublicKey []byte, lastSignature string, signatureCount int) (*Ed25519Verifier, error) {
+	return &Ed25519Verifier{devicePublicKey: devicePublicKey, lastSignature: lastSignature, signatureCount: signatureCount, marshaler: Ed25519Marshaler{}}, nil
+}
+
+func (v *Ed25519Verifier) Verify(dataToBeSigned []byte, signature []byte) (bool, error) {
+	publicKey, err := v.marshaler.UnmarshalPublic(v.devicePublicKey)
+	if err != nil {
+		return false, err
+	}
+	message := []byte(SignatureInput(v.signatureCount, dataToBeSigned, v.lastSignature))
+
+	return ed25519.Verify(publicKey.(ed25519.PublicKey), message, signature), nil
+}
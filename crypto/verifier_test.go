@@ -0,0 +1,87 @@
+package crypto_test
+
+import (
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+func TestVerifier(t *testing.T) {
+	RSAMarshaler := crypto.NewRSAMarshaler()
+	RSAKeyGen := &crypto.RSAGenerator{}
+	RSAKeyPair, _ := RSAKeyGen.Generate()
+	marshalledRSAPublicKey, marshalledRSAPrivateKey, _ := RSAMarshaler.Marshal(RSAKeyPair.Private)
+
+	ECCMarshaler := crypto.NewECCMarshaler()
+	ECCKeyGen := &crypto.ECCGenerator{}
+	ECCKeyPair, _ := ECCKeyGen.Generate()
+	marshalledECCPublicKey, marshalledECCPrivateKey, _ := ECCMarshaler.Marshal(ECCKeyPair.Private)
+
+	Ed25519KeyPair, _ := (&crypto.Ed25519Generator{}).Generate()
+	marshalledEd25519PublicKey, marshalledEd25519PrivateKey, _ := crypto.NewEd25519Marshaler().Marshal(Ed25519KeyPair.Private)
+
+	lastSignature := "lastSignature"
+	signatureCount := 4
+	dataToBeSigned := []byte("test data")
+
+	rsaSigner, _ := crypto.NewRSASigner(marshalledRSAPrivateKey, lastSignature, signatureCount)
+	rsaSignature, _ := rsaSigner.Sign(dataToBeSigned)
+	ecdsaSigner, _ := crypto.NewECDSASigner(marshalledECCPrivateKey, lastSignature, signatureCount)
+	ecdsaSignature, _ := ecdsaSigner.Sign(dataToBeSigned)
+	ed25519Signer, _ := crypto.NewEd25519Signer(marshalledEd25519PrivateKey, lastSignature, signatureCount)
+	ed25519Signature, _ := ed25519Signer.Sign(dataToBeSigned)
+
+	verifierTestCases := []struct {
+		description    string
+		newVerifier    func(publicKey []byte, lastSignature string, signatureCount int) (crypto.Verifier, error)
+		publicKey      []byte
+		signature      []byte
+		lastSignature  string
+		signatureCount int
+		dataToBeSigned []byte
+		expected       bool
+	}{
+		{"RSA valid signature", newRSAVerifier, marshalledRSAPublicKey, rsaSignature, lastSignature, signatureCount, dataToBeSigned, true},
+		{"RSA tampered data", newRSAVerifier, marshalledRSAPublicKey, rsaSignature, lastSignature, signatureCount, []byte("tampered data"), false},
+		{"RSA wrong counter", newRSAVerifier, marshalledRSAPublicKey, rsaSignature, lastSignature, signatureCount + 1, dataToBeSigned, false},
+		{"RSA wrong last signature", newRSAVerifier, marshalledRSAPublicKey, rsaSignature, "otherSignature", signatureCount, dataToBeSigned, false},
+		{"ECDSA valid signature", newECDSAVerifier, marshalledECCPublicKey, ecdsaSignature, lastSignature, signatureCount, dataToBeSigned, true},
+		{"ECDSA tampered data", newECDSAVerifier, marshalledECCPublicKey, ecdsaSignature, lastSignature, signatureCount, []byte("tampered data"), false},
+		{"ECDSA wrong counter", newECDSAVerifier, marshalledECCPublicKey, ecdsaSignature, lastSignature, signatureCount + 1, dataToBeSigned, false},
+		{"ECDSA wrong last signature", newECDSAVerifier, marshalledECCPublicKey, ecdsaSignature, "otherSignature", signatureCount, dataToBeSigned, false},
+		{"Ed25519 valid signature", newEd25519Verifier, marshalledEd25519PublicKey, ed25519Signature, lastSignature, signatureCount, dataToBeSigned, true},
+		{"Ed25519 tampered data", newEd25519Verifier, marshalledEd25519PublicKey, ed25519Signature, lastSignature, signatureCount, []byte("tampered data"), false},
+		{"Ed25519 wrong counter", newEd25519Verifier, marshalledEd25519PublicKey, ed25519Signature, lastSignature, signatureCount + 1, dataToBeSigned, false},
+		{"Ed25519 wrong last signature", newEd25519Verifier, marshalledEd25519PublicKey, ed25519Signature, "otherSignature", signatureCount, dataToBeSigned, false},
+	}
+	for _, tc := range verifierTestCases {
+		t.Run(tc.description, func(t *testing.T) {
+			verifier, _ := tc.newVerifier(tc.publicKey, tc.lastSignature, tc.signatureCount)
+			valid, err := verifier.Verify(tc.dataToBeSigned, tc.signature)
+			if err != nil {
+				t.Fatalf("an error occurred during signature verification, error: %s", err.Error())
+			}
+			if valid != tc.expected {
+				t.Errorf("expected signature verification to be %t, got %t", tc.expected, valid)
+			}
+		})
+	}
+	t.Run("verify with a key that is not PEM encoded", func(t *testing.T) {
+		verifier, _ := crypto.NewRSAVerifier([]byte("publicKey"), lastSignature, signatureCount)
+		if _, err := verifier.Verify(dataToBeSigned, rsaSignature); err == nil {
+			t.Errorf("expected public key decoding error")
+		}
+	})
+}
+
+func newRSAVerifier(publicKey []byte, lastSignature string, signatureCount int) (crypto.Verifier, error) {
+	return crypto.NewRSAVerifier(publicKey, lastSignature, signatureCount)
+}
+
+func newECDSAVerifier(publicKey []byte, lastSignature string, signatureCount int) (crypto.Verifier, error) {
+	return crypto.NewECDSAVerifier(publicKey, lastSignature, signatureCount)
+}
+
+func newEd25519Verifier(publicKey []byte, lastSignature string, signatureCount int) (crypto.Verifier, error) {
+	return crypto.NewEd25519Verifier(publicKey, lastSignature, signatureCount)
+}
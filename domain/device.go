@@ -1,38 +1,122 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"hash/fnv"
+	"maps"
 	"sync"
+	"time"
 
 	"github.com/PaoloModica/signing-service-challenge-go/crypto"
 	"github.com/google/uuid"
 )
 
+// KeyGenAlgorithm is the algorithm, and strength, of the key of a signature device.
 type KeyGenAlgorithm string
 
 const (
-	ECC KeyGenAlgorithm = "ECC"
-	RSA KeyGenAlgorithm = "RSA"
+	RSA2048   KeyGenAlgorithm = KeyGenAlgorithm(crypto.RSA2048KeyAlgorithm)
+	RSA3072   KeyGenAlgorithm = KeyGenAlgorithm(crypto.RSA3072KeyAlgorithm)
+	RSA4096   KeyGenAlgorithm = KeyGenAlgorithm(crypto.RSA4096KeyAlgorithm)
+	ECDSAP256 KeyGenAlgorithm = KeyGenAlgorithm(crypto.ECDSAP256KeyAlgorithm)
+	ECDSAP384 KeyGenAlgorithm = KeyGenAlgorithm(crypto.ECDSAP384KeyAlgorithm)
+	ECDSAP521 KeyGenAlgorithm = KeyGenAlgorithm(crypto.ECDSAP521KeyAlgorithm)
+	Ed25519   KeyGenAlgorithm = KeyGenAlgorithm(crypto.Ed25519KeyAlgorithm)
+
+	// ECC and RSA are kept for compatibility, as ECDSA P-384 and RSA 2048-bit keys.
+	ECC KeyGenAlgorithm = KeyGenAlgorithm(crypto.ECCKeyAlgorithm)
+	RSA KeyGenAlgorithm = KeyGenAlgorithm(crypto.RSAKeyAlgorithm)
 )
 
+// KeyGenAlgorithms returns the supported key generation algorithms.
+func KeyGenAlgorithms() []KeyGenAlgorithm {
+	algorithms := []KeyGenAlgorithm{}
+	for _, algorithm := range crypto.KeyAlgorithms() {
+		algorithms = append(algorithms, KeyGenAlgorithm(algorithm))
+	}
+	return algorithms
+}
+
+// Parameters returns the key parameters of the algorithm, or a KeyTypeNotValidError if the
+// algorithm is not supported.
+func (a KeyGenAlgorithm) Parameters() (crypto.KeyAlgorithmParameters, error) {
+	algorithm, err := a.algorithm()
+	if err != nil {
+		return crypto.KeyAlgorithmParameters{}, err
+	}
+	return algorithm.Parameters, nil
+}
+
+// algorithm resolves the algorithm from the crypto.DefaultAlgorithmRegistry, returning a
+// KeyTypeNotValidError if it is not registered.
+func (a KeyGenAlgorithm) algorithm() (crypto.Algorithm, error) {
+	algorithm, err := crypto.DefaultAlgorithmRegistry.Lookup(crypto.KeyAlgorithm(a))
+	if err != nil {
+		return crypto.Algorithm{}, KeyTypeNotValidError(fmt.Sprintf("key generation algorithm %q not valid or unknown", a))
+	}
+	return algorithm, nil
+}
+
 type KeyTypeNotValidError string
 
 func (e KeyTypeNotValidError) Error() string {
 	return string(e)
 }
 
+// SignatureDevice holds the metadata, signature chain and lifecycle state of a device. Its key
+// material lives in a crypto.KeyStore: the device only references its key by handle.
 type SignatureDevice struct {
 	Id               string
 	Label            string
-	PrivateKey       []byte
+	Owner            string
+	Tags             map[string]string
+	PublicKey        []byte
+	KeyHandle        crypto.KeyHandle
 	KeyType          KeyGenAlgorithm
 	signatureCounter int
 	lastSignature    []byte
+	state            DeviceState
+	retirement       *Retirement
+	// previousKeys are the keys the device has been rotated away from, by version, and
+	// keyActiveFromCounter the counter of the first signature of the current key.
+	previousKeys         []KeyVersion
+	keyActiveFromCounter int
+	deletedAt            *time.Time
+	createdAt            time.Time
+	updatedAt            time.Time
+	lastSignedAt         *time.Time
+	// revision is the revision of the device as read from stores rejecting stale writes,
+	// bumped by every write; it is not part of the device document.
+	revision int
 }
 
-func NewSignatureDevice(label string, privateKey []byte, keytype KeyGenAlgorithm) (*SignatureDevice, error) {
-	return &SignatureDevice{Id: uuid.NewString(), Label: label, PrivateKey: privateKey, KeyType: keytype}, nil
+func NewSignatureDevice(label string, publicKey []byte, keyHandle crypto.KeyHandle, keytype KeyGenAlgorithm) (*SignatureDevice, error) {
+	createdAt := time.Now().UTC()
+	return &SignatureDevice{
+		Id:        uuid.NewString(),
+		Label:     label,
+		PublicKey: publicKey,
+		KeyHandle: keyHandle,
+		KeyType:   keytype,
+		state:     DeviceActive,
+		createdAt: createdAt,
+		updatedAt: createdAt,
+	}, nil
+}
+
+// GetRevision returns the revision of the device, as set by the store it has been read from.
+func (s *SignatureDevice) GetRevision() int {
+	return s.revision
+}
+
+// SetRevision records the revision the device has been read, or written, at by a store.
+func (s *SignatureDevice) SetRevision(revision int) {
+	s.revision = revision
 }
 
 func (s *SignatureDevice) GetSignatureCounter() int {
@@ -48,11 +132,109 @@ func (s *SignatureDevice) GetLastSignature() ([]byte, error) {
 	return s.lastSignature, nil
 }
 
+// GetSignatureChainSeed returns the reference the first signature of the device chains
+// from, in place of a last signature: the device ID, so that every device chain has its
+// own root.
+func (s *SignatureDevice) GetSignatureChainSeed() []byte {
+	return []byte(s.Id)
+}
+
+// GetChainingSignature returns the signature the next signature of the device chains
+// from: the last signature or, when the device has not signed anything yet, its
+// signature chain seed.
+func (s *SignatureDevice) GetChainingSignature() []byte {
+	if s.signatureCounter == 0 {
+		return s.GetSignatureChainSeed()
+	}
+	return s.lastSignature
+}
+
+// signatureDeviceDocument is the serialized form of a SignatureDevice, including its
+// signature chain and lifecycle state, its previous keys, its deletion and its timestamps,
+// used by stores to persist devices.
+type signatureDeviceDocument struct {
+	Id               string            `json:"id"`
+	Label            string            `json:"label"`
+	Owner            string            `json:"owner,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	PublicKey        []byte            `json:"public_key"`
+	KeyHandle        crypto.KeyHandle  `json:"key_handle"`
+	KeyType          KeyGenAlgorithm   `json:"key_type"`
+	SignatureCounter int               `json:"signature_counter"`
+	LastSignature    []byte            `json:"last_signature"`
+	State            DeviceState       `json:"state,omitempty"`
+	Retirement       *Retirement       `json:"retirement,omitempty"`
+	PreviousKeys     []KeyVersion      `json:"previous_keys,omitempty"`
+	KeyActiveFrom    int               `json:"key_active_from_counter,omitempty"`
+	DeletedAt        *time.Time        `json:"deleted_at,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+	LastSignedAt     *time.Time        `json:"last_signed_at,omitempty"`
+}
+
+func (s SignatureDevice) MarshalJSON() ([]byte, error) {
+	return json.Marshal(signatureDeviceDocument{
+		Id:               s.Id,
+		Label:            s.Label,
+		Owner:            s.Owner,
+		Tags:             s.Tags,
+		PublicKey:        s.PublicKey,
+		KeyHandle:        s.KeyHandle,
+		KeyType:          s.KeyType,
+		SignatureCounter: s.signatureCounter,
+		LastSignature:    s.lastSignature,
+		State:            s.GetState(),
+		Retirement:       s.retirement,
+		PreviousKeys:     s.previousKeys,
+		KeyActiveFrom:    s.keyActiveFromCounter,
+		DeletedAt:        s.deletedAt,
+		CreatedAt:        s.createdAt,
+		UpdatedAt:        s.updatedAt,
+		LastSignedAt:     s.lastSignedAt,
+	})
+}
+
+func (s *SignatureDevice) UnmarshalJSON(data []byte) error {
+	var document signatureDeviceDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	*s = SignatureDevice{
+		Id:                   document.Id,
+		Label:                document.Label,
+		Owner:                document.Owner,
+		Tags:                 document.Tags,
+		PublicKey:            document.PublicKey,
+		KeyHandle:            document.KeyHandle,
+		KeyType:              document.KeyType,
+		signatureCounter:     document.SignatureCounter,
+		lastSignature:        document.LastSignature,
+		state:                document.State,
+		retirement:           document.Retirement,
+		previousKeys:         document.PreviousKeys,
+		keyActiveFromCounter: document.KeyActiveFrom,
+		deletedAt:            document.DeletedAt,
+		createdAt:            document.CreatedAt,
+		updatedAt:            document.UpdatedAt,
+		lastSignedAt:         document.LastSignedAt,
+	}
+	return nil
+}
+
+// SignatureDeviceStore persists the signature devices. FindById, Update and Delete return
+// a DeviceNotFoundError for unknown devices, FindAll returns the devices in creation
+// order and Query the pages of the devices selected by a DeviceQuery. Delete is a soft
+// delete: the device is marked deleted and no longer listed by FindAll nor Query, but
+// FindById still returns it. Implementations must be safe for concurrent
+// use; the storetest package holds the conformance suite every implementation is
+// expected to pass.
 type SignatureDeviceStore interface {
 	FindById(id string) (*SignatureDevice, error)
 	FindAll() ([]*SignatureDevice, error)
+	Query(query DeviceQuery) (*DevicePage, error)
 	Create(*SignatureDevice) (string, error)
 	Update(*SignatureDevice) error
+	Delete(id string) error
 }
 
 type DeviceNotFoundError string
@@ -61,134 +243,525 @@ func (e DeviceNotFoundError) Error() string {
 	return string(e)
 }
 
+// StaleDeviceUpdateError is returned by stores rejecting the update of a device which has
+// been concurrently changed since it was read.
+type StaleDeviceUpdateError string
+
+func (e StaleDeviceUpdateError) Error() string {
+	return string(e)
+}
+
+// KeyGenerationError is returned when the key of a new device cannot be generated by the
+// key store. It wraps the key store error.
+type KeyGenerationError struct {
+	KeyType KeyGenAlgorithm
+	Err     error
+}
+
+func (e *KeyGenerationError) Error() string {
+	return fmt.Sprintf("%s key generation failed: %s", e.KeyType, e.Err.Error())
+}
+
+func (e *KeyGenerationError) Unwrap() error {
+	return e.Err
+}
+
+// KeyDecodingError is returned when the stored public key of a device cannot be decoded,
+// so that its signatures cannot be verified.
+type KeyDecodingError struct {
+	DeviceId string
+	Err      error
+}
+
+func (e *KeyDecodingError) Error() string {
+	return fmt.Sprintf("public key of device %s cannot be decoded: %s", e.DeviceId, e.Err.Error())
+}
+
+func (e *KeyDecodingError) Unwrap() error {
+	return e.Err
+}
+
+// SigningError is returned when the key store fails to sign with the key of a device.
+// It wraps the key store error, e.g. a crypto.KeyNotFoundError.
+type SigningError struct {
+	DeviceId string
+	Err      error
+}
+
+func (e *SigningError) Error() string {
+	return fmt.Sprintf("signing with device %s failed: %s", e.DeviceId, e.Err.Error())
+}
+
+func (e *SigningError) Unwrap() error {
+	return e.Err
+}
+
 type SignatureDeviceRepository interface {
 	FindById(id string) (*SignatureDevice, error)
 	FindAll() ([]*SignatureDevice, error)
+	Query(query DeviceQuery) (*DevicePage, error)
 	Create(*SignatureDevice) (string, error)
 	Update(*SignatureDevice) error
+	UpdateAtomically(id string, update func(*SignatureDevice) error) error
+	SignAtomically(id string, ledger SignatureRecordStore, sign func(*SignatureDevice) (*SignatureRecord, error)) error
+	Delete(id string) error
 }
 
+// deviceLockStripes is the number of locks the device IDs are hashed into.
+const deviceLockStripes = 256
+
+// signatureDeviceRepository serializes writes per device: device IDs are hashed into a
+// fixed set of RWMutex stripes, so operations on independent devices mostly run in
+// parallel, read-only calls only take a shared lock and looking up any number of IDs
+// does not grow the repository. The underlying store must be safe for concurrent use.
 type signatureDeviceRepository struct {
-	lock  sync.RWMutex
-	store SignatureDeviceStore
+	deviceLocks [deviceLockStripes]sync.RWMutex
+	store       SignatureDeviceStore
 }
 
 func NewSignatureDeviceRepository(s SignatureDeviceStore) (*signatureDeviceRepository, error) {
-	return &signatureDeviceRepository{lock: sync.RWMutex{}, store: s}, nil
+	return &signatureDeviceRepository{store: s}, nil
+}
+
+func (r *signatureDeviceRepository) deviceLock(id string) *sync.RWMutex {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return &r.deviceLocks[hash.Sum32()%deviceLockStripes]
 }
 
 func (r *signatureDeviceRepository) FindById(id string) (*SignatureDevice, error) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
+	lock := r.deviceLock(id)
+	lock.RLock()
+	defer lock.RUnlock()
 
 	return r.store.FindById(id)
 }
 
 func (r *signatureDeviceRepository) FindAll() ([]*SignatureDevice, error) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-
 	return r.store.FindAll()
 }
 
+func (r *signatureDeviceRepository) Query(query DeviceQuery) (*DevicePage, error) {
+	return r.store.Query(query)
+}
+
 func (r *signatureDeviceRepository) Create(d *SignatureDevice) (string, error) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
+	lock := r.deviceLock(d.Id)
+	lock.Lock()
+	defer lock.Unlock()
 
 	return r.store.Create(d)
 }
 
 func (r *signatureDeviceRepository) Update(d *SignatureDevice) error {
-	r.lock.Lock()
-	defer r.lock.Unlock()
+	lock := r.deviceLock(d.Id)
+	lock.Lock()
+	defer lock.Unlock()
 
 	return r.store.Update(d)
 }
 
+func (r *signatureDeviceRepository) Delete(id string) error {
+	lock := r.deviceLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	return r.store.Delete(id)
+}
+
+// UpdateAtomically loads the device identified by id, applies update to a copy of it
+// and stores the result as a single unit: no other write can interleave between the
+// read and the update, and readers never observe a partially updated device. The update
+// time of the device is recorded along with the update.
+func (r *signatureDeviceRepository) UpdateAtomically(id string, update func(*SignatureDevice) error) error {
+	lock := r.deviceLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	device, err := r.store.FindById(id)
+	if err != nil {
+		return err
+	}
+	updatedDevice := *device
+	if err := update(&updatedDevice); err != nil {
+		return err
+	}
+	updatedDevice.touch(time.Now())
+	return r.store.Update(&updatedDevice)
+}
+
+// SignAtomically applies sign to a copy of the device identified by id as UpdateAtomically
+// does, storing the signature record sign returns along with the device it advances. When
+// the ledger is the device store itself and a SignatureCommitter, the two are committed as
+// one write; otherwise the record is appended to the ledger before the device is updated.
+func (r *signatureDeviceRepository) SignAtomically(id string, ledger SignatureRecordStore, sign func(*SignatureDevice) (*SignatureRecord, error)) error {
+	lock := r.deviceLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	device, err := r.store.FindById(id)
+	if err != nil {
+		return err
+	}
+	updatedDevice := *device
+	record, err := sign(&updatedDevice)
+	if err != nil {
+		return err
+	}
+	updatedDevice.touch(time.Now())
+
+	if committer, ok := ledger.(SignatureCommitter); ok && interface{}(ledger) == interface{}(r.store) {
+		return committer.CommitSignature(&updatedDevice, record)
+	}
+	if err := ledger.Append(record); err != nil {
+		return err
+	}
+	return r.store.Update(&updatedDevice)
+}
+
 type SignatureDeviceService interface {
 	FindById(id string) (*SignatureDevice, error)
 	FindAll() ([]*SignatureDevice, error)
-	Create(label string, keyType KeyGenAlgorithm) (string, error)
+	Query(query DeviceQuery) (*DevicePage, error)
+	Create(label string, keyType KeyGenAlgorithm, metadata DeviceMetadata) (string, error)
 	Update(id string, signature []byte) error
+	UpdateDevice(id string, update DeviceUpdate) (*SignatureDevice, error)
+	SetState(id string, state DeviceState, reason string) (*SignatureDevice, error)
+	RotateKey(id string) (*SignatureDevice, error)
+	Delete(id string) error
+	SignTransaction(id string, dataToBeSigned []byte) (*SignedTransaction, error)
+	VerifySignature(id string, signatureCounter int, dataToBeSigned []byte, lastSignature []byte, signature []byte) (bool, error)
+	FindSignatures(id string, fromCounter int, toCounter int) ([]*SignatureRecord, error)
+	AuditSignatureChain(id string) (*AuditReport, error)
+}
+
+// SignedTransaction is the outcome of a signing operation: the signature, the exact
+// secured data string it has been computed on and the version of the key it has been
+// computed with.
+type SignedTransaction struct {
+	Counter    int
+	Signature  []byte
+	SignedData string
+	KeyVersion int
 }
 
 type signatureDeviceService struct {
-	repository      SignatureDeviceRepository
-	rsaKeyGenerator *crypto.RSAGenerator
-	rsaKeyMarshaler *crypto.RSAMarshaler
-	eccKeyGenerator *crypto.ECCGenerator
-	eccKeyMarshaler *crypto.ECCMarshaler
+	repository SignatureDeviceRepository
+	signatures SignatureRecordStore
+	keys       crypto.KeyStore
 }
 
-func NewSignatureDeviceService(repository SignatureDeviceRepository) (*signatureDeviceService, error) {
-	return &signatureDeviceService{repository: repository, rsaKeyGenerator: &crypto.RSAGenerator{}, rsaKeyMarshaler: &crypto.RSAMarshaler{}, eccKeyGenerator: &crypto.ECCGenerator{}, eccKeyMarshaler: &crypto.ECCMarshaler{}}, nil
+// NewSignatureDeviceService creates a signature device service keeping the device keys in
+// keys: private keys never leave the key store, devices only hold a handle to sign with.
+func NewSignatureDeviceService(repository SignatureDeviceRepository, signatures SignatureRecordStore, keys crypto.KeyStore) (*signatureDeviceService, error) {
+	return &signatureDeviceService{repository: repository, signatures: signatures, keys: keys}, nil
 }
 
 func (s *signatureDeviceService) FindAll() ([]*SignatureDevice, error) {
 	return s.repository.FindAll()
 }
 
+// Query returns the page of the devices selected by query.
+func (s *signatureDeviceService) Query(query DeviceQuery) (*DevicePage, error) {
+	return s.repository.Query(query)
+}
+
 func (s *signatureDeviceService) FindById(id string) (*SignatureDevice, error) {
 	return s.repository.FindById(id)
 }
 
-func (s *signatureDeviceService) createAndDecodePrivateKey(keyType KeyGenAlgorithm) ([]byte, error) {
-	switch keyType {
-	case RSA:
-		keyPair, err := s.rsaKeyGenerator.Generate()
-		if err != nil {
-			log.Fatalf("an error occurred while generating RSA key pair: %s", err.Error())
-			return nil, err
+// Create generates the key of a new device in the key store and stores the device, along
+// with its metadata; the key is destroyed if the device cannot be stored.
+func (s *signatureDeviceService) Create(label string, keyType KeyGenAlgorithm, metadata DeviceMetadata) (string, error) {
+	if _, err := keyType.Parameters(); err != nil {
+		return "", err
+	}
+	keyHandle, err := s.keys.GenerateKey(crypto.KeyAlgorithm(keyType))
+	if err != nil {
+		return "", &KeyGenerationError{KeyType: keyType, Err: err}
+	}
+	publicKey, err := s.keys.PublicKey(keyHandle)
+	if err != nil {
+		s.keys.Destroy(keyHandle)
+		return "", &KeyGenerationError{KeyType: keyType, Err: err}
+	}
+	device, err := NewSignatureDevice(label, publicKey, keyHandle, keyType)
+	if err != nil {
+		s.keys.Destroy(keyHandle)
+		return "", err
+	}
+	device.setMetadata(metadata)
+	id, err := s.repository.Create(device)
+	if err != nil {
+		s.keys.Destroy(keyHandle)
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *signatureDeviceService) Update(id string, signature []byte) error {
+	return s.repository.UpdateAtomically(id, func(device *SignatureDevice) error {
+		device.SetLastSignature(signature)
+		return nil
+	})
+}
+
+// DeviceUpdate holds the changes UpdateDevice applies to a signature device; nil fields
+// are left unchanged. Tags replace all the device tags, and Reason is recorded when the
+// device is retired.
+type DeviceUpdate struct {
+	Label  *string
+	Tags   map[string]string
+	State  *DeviceState
+	Reason string
+}
+
+// UpdateDevice applies update to the device identified by id as a single unit, returning
+// the updated device. Deleted devices cannot be updated.
+func (s *signatureDeviceService) UpdateDevice(id string, update DeviceUpdate) (*SignatureDevice, error) {
+	var updatedDevice *SignatureDevice
+	err := s.repository.UpdateAtomically(id, func(device *SignatureDevice) error {
+		if err := device.deviceDeleted(); err != nil {
+			return err
 		}
-		_, privateKey, err := s.rsaKeyMarshaler.Marshal(*keyPair)
-		if err != nil {
-			log.Fatalf("an error occurred while marshaling RSA key pair: %s", err.Error())
-			return nil, err
-		} else {
-			return privateKey, nil
+		if update.State != nil {
+			if err := device.Transition(*update.State, update.Reason, time.Now()); err != nil {
+				return err
+			}
 		}
-	case ECC:
-		keyPair, err := s.eccKeyGenerator.Generate()
-		if err != nil {
-			log.Fatalf("an error occurred while generating ECC key pair: %s", err.Error())
+		if update.Label != nil {
+			device.Label = *update.Label
+		}
+		if update.Tags != nil {
+			device.Tags = maps.Clone(update.Tags)
+		}
+		updatedDevice = device
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updatedDevice, nil
+}
+
+// SetState moves the device identified by id to the lifecycle state, returning the
+// updated device. The reason is recorded when the device is retired.
+func (s *signatureDeviceService) SetState(id string, state DeviceState, reason string) (*SignatureDevice, error) {
+	return s.UpdateDevice(id, DeviceUpdate{State: &state, Reason: reason})
+}
+
+// Delete soft deletes the device identified by id and destroys its private key. The
+// device public keys and signatures are kept, so that its signatures can still be
+// verified and audited. Deleting a deleted device retries the destruction of its key.
+func (s *signatureDeviceService) Delete(id string) error {
+	if err := s.repository.Delete(id); err != nil {
+		return err
+	}
+	// deleted devices do not rotate their key anymore, the key handle read here is final
+	device, err := s.repository.FindById(id)
+	if err != nil {
+		return err
+	}
+	var notFoundErr crypto.KeyNotFoundError
+	if err := s.keys.Destroy(device.KeyHandle); err != nil && !errors.As(err, &notFoundErr) {
+		return err
+	}
+	return nil
+}
+
+// RotateKey generates a new key for the device identified by id, with the device key type,
+// and makes it the current key of the device from its next signature on. The previous
+// private key is destroyed once the rotation is stored, while its public key is kept to
+// verify the signatures it produced. The keys of retired and deleted devices cannot be rotated.
+func (s *signatureDeviceService) RotateKey(id string) (*SignatureDevice, error) {
+	device, err := s.repository.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	keyHandle, err := s.keys.GenerateKey(crypto.KeyAlgorithm(device.KeyType))
+	if err != nil {
+		return nil, &KeyGenerationError{KeyType: device.KeyType, Err: err}
+	}
+	publicKey, err := s.keys.PublicKey(keyHandle)
+	if err != nil {
+		s.keys.Destroy(keyHandle)
+		return nil, &KeyGenerationError{KeyType: device.KeyType, Err: err}
+	}
+
+	var rotatedDevice *SignatureDevice
+	var previousKeyHandle crypto.KeyHandle
+	err = s.repository.UpdateAtomically(id, func(device *SignatureDevice) error {
+		if err := device.deviceDeleted(); err != nil {
+			return err
+		}
+		if device.GetState() == DeviceRetired {
+			return DeviceNotActiveError(fmt.Sprintf("device %s is %s and its key cannot be rotated", device.Id, DeviceRetired))
+		}
+		previousKeyHandle = device.KeyHandle
+		device.RotateKey(publicKey, keyHandle)
+		rotatedDevice = device
+		return nil
+	})
+	if err != nil {
+		s.keys.Destroy(keyHandle)
+		return nil, err
+	}
+	// the rotation is stored: a previous key which cannot be destroyed is only left unused
+	s.keys.Destroy(previousKeyHandle)
+	return rotatedDevice, nil
+}
+
+// SignTransaction signs the given data with the device identified by id, chaining it
+// to the device signature counter and last signature (or chain seed, for the first one). Reading the chain state, signing,
+// recording the signature and advancing the counter happen as one serialized unit per device,
+// committed as one write by the stores holding both the devices and the ledger.
+// The secured data string is signed by the key store, with the device key; deleted devices
+// and devices which are not active refuse to sign.
+func (s *signatureDeviceService) SignTransaction(id string, dataToBeSigned []byte) (*SignedTransaction, error) {
+	var transaction *SignedTransaction
+	err := s.repository.SignAtomically(id, s.signatures, func(device *SignatureDevice) (*SignatureRecord, error) {
+		if err := device.deviceDeleted(); err != nil {
 			return nil, err
 		}
-		_, privateKey, err := s.eccKeyMarshaler.Encode(*keyPair)
+		if state := device.GetState(); state != DeviceActive {
+			return nil, DeviceNotActiveError(fmt.Sprintf("device %s is %s and cannot sign", device.Id, state))
+		}
+		lastSignature := device.GetChainingSignature()
+		counter := device.GetSignatureCounter()
+		signedData := crypto.SignatureInput(counter, dataToBeSigned, string(lastSignature))
+
+		signature, err := s.keys.Sign(device.KeyHandle, []byte(signedData))
 		if err != nil {
-			log.Fatalf("an error occurred while marshaling ECC key pair: %s", err.Error())
-			return nil, err
-		} else {
-			return privateKey, nil
+			return nil, &SigningError{DeviceId: device.Id, Err: err}
 		}
-	default:
-		return nil, KeyTypeNotValidError("key generation algorithm not valid or unknown")
+		dataHash := sha256.Sum256(dataToBeSigned)
+		timestamp := time.Now().UTC()
+		device.SetLastSignature(signature)
+		device.signedAt(timestamp)
+		transaction = &SignedTransaction{Counter: counter, Signature: signature, SignedData: signedData, KeyVersion: device.GetKeyVersion()}
+		return &SignatureRecord{
+			DeviceId:   device.Id,
+			Counter:    counter,
+			DataHash:   hex.EncodeToString(dataHash[:]),
+			SignedData: signedData,
+			Signature:  signature,
+			Timestamp:  timestamp,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return transaction, nil
 }
 
-func (s *signatureDeviceService) Create(label string, keyType KeyGenAlgorithm) (string, error) {
-	privateKey, err := s.createAndDecodePrivateKey(keyType)
+// newVerifier creates the verifier of the signature with the given counter, against the
+// public key of the device key version it has been produced with.
+func (s *signatureDeviceService) newVerifier(device *SignatureDevice, signatureCounter int, lastSignature []byte) (crypto.Verifier, error) {
+	algorithm, err := device.KeyType.algorithm()
 	if err != nil {
-		log.Fatalf("an error occurred while creating signature device: %s", err.Error())
-		return "", err
+		return nil, err
+	}
+	return algorithm.NewVerifier(device.KeyVersionAt(signatureCounter).PublicKey, string(lastSignature), signatureCounter)
+}
+
+// VerifySignature reconstructs the secured data string from the signature counter, the
+// signed data and the previous signature, and checks the signature against the public
+// key of the device identified by id which was current at that counter.
+func (s *signatureDeviceService) VerifySignature(id string, signatureCounter int, dataToBeSigned []byte, lastSignature []byte, signature []byte) (bool, error) {
+	device, err := s.repository.FindById(id)
+	if err != nil {
+		return false, err
 	}
-	device, err := NewSignatureDevice(label, privateKey, keyType)
+	verifier, err := s.newVerifier(device, signatureCounter, lastSignature)
 	if err != nil {
-		log.Fatalf("an error occurred while creating signature device: %s", err.Error())
-		return "", err
+		return false, err
 	}
-	id, err := s.repository.Create(device)
+	valid, err := verifier.Verify(dataToBeSigned, signature)
 	if err != nil {
-		log.Fatalf("an error occurred while creating signature device: %s", err.Error())
-		return "", err
+		return false, &KeyDecodingError{DeviceId: device.Id, Err: err}
 	}
-	return id, nil
+	return valid, nil
 }
 
-func (s *signatureDeviceService) Update(id string, signature []byte) error {
+// FindSignatures returns the signature ledger entries of the device identified by id
+// with counter in [fromCounter, toCounter); a negative toCounter leaves the range unbounded.
+func (s *signatureDeviceService) FindSignatures(id string, fromCounter int, toCounter int) ([]*SignatureRecord, error) {
+	if _, err := s.repository.FindById(id); err != nil {
+		return nil, err
+	}
+	return s.signatures.FindByDeviceId(id, fromCounter, toCounter)
+}
+
+// auditPageSize is the number of signature records loaded at once while auditing a chain.
+const auditPageSize = 1000
+
+// AuditSignatureChain walks the signature ledger of the device identified by id from
+// counter 0, checking that every signed data embeds its counter and the base64 encoded
+// previous signature (the device chain seed for counter 0), and that every signature verifies against the device public key
+// it has been produced with, so that the chain continues across key rotations.
+// The report holds the first broken link found, if any.
+func (s *signatureDeviceService) AuditSignatureChain(id string) (*AuditReport, error) {
 	device, err := s.repository.FindById(id)
-	if device == nil || err != nil {
-		return DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", id))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditReport{DeviceId: id}
+	lastSignature := device.GetSignatureChainSeed()
+	signatureCounter := device.GetSignatureCounter()
+	for counter := 0; counter < signatureCounter; {
+		records, err := s.signatures.FindByDeviceId(id, counter, min(counter+auditPageSize, signatureCounter))
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			report.BrokenLink = &ChainBreak{Counter: counter, Reason: "signature missing from the ledger"}
+			return report, nil
+		}
+		for _, record := range records {
+			chainBreak, err := s.auditSignatureRecord(device, counter, lastSignature, record)
+			if err != nil {
+				return nil, err
+			}
+			if chainBreak != nil {
+				report.BrokenLink = chainBreak
+				return report, nil
+			}
+			lastSignature = record.Signature
+			report.VerifiedSignatures++
+			counter++
+		}
+	}
+	return report, nil
+}
+
+// auditSignatureRecord checks a single link of the signature chain, returning nil if valid.
+// An error is returned when the link cannot be checked, as the device key type is unknown
+// or its public key cannot be decoded.
+func (s *signatureDeviceService) auditSignatureRecord(device *SignatureDevice, counter int, lastSignature []byte, record *SignatureRecord) (*ChainBreak, error) {
+	if record.Counter != counter {
+		return &ChainBreak{Counter: counter, Reason: fmt.Sprintf("expected signature %d, found signature %d", counter, record.Counter)}, nil
+	}
+	signatureCount, dataToBeSigned, encodedLastSignature, err := crypto.ParseSignatureInput(record.SignedData)
+	if err != nil {
+		return &ChainBreak{Counter: counter, Reason: err.Error()}, nil
+	}
+	if signatureCount != counter {
+		return &ChainBreak{Counter: counter, Reason: fmt.Sprintf("signed data embeds counter %d", signatureCount)}, nil
+	}
+	if encodedLastSignature != base64.StdEncoding.EncodeToString(lastSignature) {
+		return &ChainBreak{Counter: counter, Reason: "signed data does not embed the previous signature"}, nil
+	}
+	verifier, err := s.newVerifier(device, counter, lastSignature)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := verifier.Verify(dataToBeSigned, record.Signature)
+	if err != nil {
+		return nil, &KeyDecodingError{DeviceId: device.Id, Err: err}
+	}
+	if !valid {
+		return &ChainBreak{Counter: counter, Reason: fmt.Sprintf("signature does not verify against the device public key version %d", device.KeyVersionAt(counter).Version)}, nil
 	}
-	device.SetLastSignature(signature)
-	return s.repository.Update(device)
+	return nil, nil
 }
@@ -1,8 +1,23 @@
 package domain_test
 
 import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
 	"github.com/PaoloModica/signing-service-challenge-go/domain"
 	test_utils "github.com/PaoloModica/signing-service-challenge-go/internal"
 )
@@ -10,19 +25,20 @@ import (
 type signatureDeviceTestCase struct {
 	description string
 	label       string
-	privateKey  []byte
+	publicKey   []byte
+	keyHandle   crypto.KeyHandle
 	keytype     domain.KeyGenAlgorithm
 }
 
 func TestSignatureDevice(t *testing.T) {
 	t.Run("create SignatureDevice instance", func(t *testing.T) {
 		signatureDevicesTestCases := []signatureDeviceTestCase{
-			{"RSA signature device", "myRSADevice", []byte("PrivateKey"), domain.RSA},
-			{"ECC signature device", "myECCDevice", []byte("PublicKey"), domain.RSA},
+			{"RSA signature device", "myRSADevice", []byte("PublicKey"), "keyHandle", domain.RSA},
+			{"ECC signature device", "myECCDevice", []byte("PublicKey"), "keyHandle", domain.ECC},
 		}
 		for _, tc := range signatureDevicesTestCases {
 			t.Run(tc.description, func(t *testing.T) {
-				device, err := domain.NewSignatureDevice(tc.label, tc.privateKey, tc.keytype)
+				device, err := domain.NewSignatureDevice(tc.label, tc.publicKey, tc.keyHandle, tc.keytype)
 
 				test_utils.AssertErrorNotNil(t, "signature device creation", err)
 				assertSignatureDeviceInitialStatus(t, device)
@@ -30,8 +46,39 @@ func TestSignatureDevice(t *testing.T) {
 		}
 	})
 
+	t.Run("signature chain is seeded from the device ID", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.RSA)
+
+		if string(device.GetChainingSignature()) != device.Id {
+			t.Errorf("expected first signature to chain from device ID %s, got %s", device.Id, device.GetChainingSignature())
+		}
+
+		lastSignature := []byte("lastSignature")
+		device.SetLastSignature(lastSignature)
+		if string(device.GetChainingSignature()) != string(lastSignature) {
+			t.Errorf("expected next signature to chain from last signature %s, got %s", lastSignature, device.GetChainingSignature())
+		}
+	})
+	t.Run("serialize SignatureDevice with its signature chain state", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.ECC)
+		device.SetLastSignature([]byte("lastSignature"))
+
+		serializedDevice, err := json.Marshal(device)
+		test_utils.AssertErrorNotNil(t, "signature device serialization", err)
+		var deserializedDevice domain.SignatureDevice
+		err = json.Unmarshal(serializedDevice, &deserializedDevice)
+		test_utils.AssertErrorNotNil(t, "signature device deserialization", err)
+
+		lastSignature, _ := deserializedDevice.GetLastSignature()
+		if deserializedDevice.Id != device.Id || deserializedDevice.KeyType != device.KeyType || deserializedDevice.KeyHandle != device.KeyHandle {
+			t.Errorf("expected deserialized device to match device %s", device.Id)
+		}
+		if deserializedDevice.GetSignatureCounter() != 1 || string(lastSignature) != "lastSignature" {
+			t.Errorf("expected deserialized device to keep its signature chain state")
+		}
+	})
 	t.Run("set last signature and get SignatureDevice instance counter", func(t *testing.T) {
-		device, err := domain.NewSignatureDevice("device", []byte("privateKey"), domain.RSA)
+		device, err := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.RSA)
 
 		lastSignature := []byte("lastSignature")
 		test_utils.AssertErrorNotNil(t, "signature device creation", err)
@@ -64,7 +111,7 @@ func TestSignatureDeviceRepository(t *testing.T) {
 	})
 	t.Run("SignatureDeviceRepository capabilities", func(t *testing.T) {
 		repository, _ := domain.NewSignatureDeviceRepository(&store)
-		device, _ := domain.NewSignatureDevice("testDevice", []byte("privateKey"), domain.RSA)
+		device, _ := domain.NewSignatureDevice("testDevice", []byte("publicKey"), "keyHandle", domain.RSA)
 
 		t.Run("create new signature device", func(t *testing.T) {
 			devices, _ := repository.FindAll()
@@ -102,20 +149,20 @@ func TestSignatureDeviceRepository(t *testing.T) {
 }
 
 func TestSignatureDeviceService(t *testing.T) {
-	device, _ := domain.NewSignatureDevice("testDevice1", []byte("privateKey"), "RSA")
+	device, _ := domain.NewSignatureDevice("testDevice1", []byte("publicKey"), "keyHandle", "RSA")
 	store := test_utils.StubSignatureDeviceStore{
 		Store: map[string]*domain.SignatureDevice{device.Id: device},
 	}
 	repository, _ := domain.NewSignatureDeviceRepository(&store)
 	t.Run("create new signature device service", func(t *testing.T) {
-		service, err := domain.NewSignatureDeviceService(repository)
+		service, err := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
 
 		if service == nil || err != nil {
 			t.Errorf("expected SignatureDeviceRepository to have been created")
 		}
 	})
 	t.Run("signature device service capabilities", func(t *testing.T) {
-		service, _ := domain.NewSignatureDeviceService(repository)
+		service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
 		t.Run("find all signature devices", func(t *testing.T) {
 			expectedDeviceLen := 1
 			devices, err := service.FindAll()
@@ -133,12 +180,22 @@ func TestSignatureDeviceService(t *testing.T) {
 			devices, _ := service.FindAll()
 			expectedDeviceLen := len(devices) + 1
 
-			id, err := service.Create("testDevice", "RSA")
+			id, err := service.Create("testDevice", "RSA", domain.DeviceMetadata{})
 			test_utils.AssertSignatureDeviceId(t, id, err)
 
 			devices, _ = service.FindAll()
 			test_utils.AssertSignatureDeviceStoreLen(t, expectedDeviceLen, len(devices))
 		})
+		t.Run("create new signature device retains its public key", func(t *testing.T) {
+			id, _ := service.Create("publicKeyDevice", domain.ECC, domain.DeviceMetadata{})
+			d, _ := service.FindById(id)
+
+			publicKey, _, err := crypto.ParsePublicKey(d.PublicKey)
+			test_utils.AssertErrorNotNil(t, "public key decoding", err)
+			if publicKey == nil {
+				t.Errorf("expected signature device public key to be set")
+			}
+		})
 		t.Run("update signature device counter, existing device", func(t *testing.T) {
 			lastSignature := []byte("lastSignature")
 			expectedCounter := device.GetSignatureCounter() + 1
@@ -160,6 +217,893 @@ func TestSignatureDeviceService(t *testing.T) {
 				t.Errorf("expected not found error")
 			}
 		})
+		t.Run("sign transaction, existing device", func(t *testing.T) {
+			for _, keyType := range []domain.KeyGenAlgorithm{domain.RSA, domain.ECC, domain.Ed25519} {
+				t.Run(string(keyType), func(t *testing.T) {
+					id, _ := service.Create("signingDevice", keyType, domain.DeviceMetadata{})
+					dataToBeSigned := []byte("test data")
+
+					first, err := service.SignTransaction(id, dataToBeSigned)
+					test_utils.AssertErrorNotNil(t, "transaction signing", err)
+					expectedSignedData := fmt.Sprintf("0_%s_%s", dataToBeSigned, base64.StdEncoding.EncodeToString([]byte(id)))
+					if first.SignedData != expectedSignedData {
+						t.Errorf("expected signed data to be %s, got %s", expectedSignedData, first.SignedData)
+					}
+
+					second, err := service.SignTransaction(id, dataToBeSigned)
+					test_utils.AssertErrorNotNil(t, "transaction signing", err)
+					expectedSignedData = fmt.Sprintf("1_%s_%s", dataToBeSigned, base64.StdEncoding.EncodeToString(first.Signature))
+					if second.SignedData != expectedSignedData {
+						t.Errorf("expected signed data to be %s, got %s", expectedSignedData, second.SignedData)
+					}
+
+					d, _ := service.FindById(id)
+					if d.GetSignatureCounter() != 2 {
+						t.Errorf("expected device signature counter to be 2, got %d", d.GetSignatureCounter())
+					}
+				})
+			}
+		})
+		t.Run("verify transaction signature", func(t *testing.T) {
+			for _, keyType := range []domain.KeyGenAlgorithm{domain.RSA, domain.ECC, domain.Ed25519} {
+				t.Run(string(keyType), func(t *testing.T) {
+					id, _ := service.Create("verifyingDevice", keyType, domain.DeviceMetadata{})
+					dataToBeSigned := []byte("test data")
+					first, _ := service.SignTransaction(id, dataToBeSigned)
+					second, _ := service.SignTransaction(id, dataToBeSigned)
+
+					valid, err := service.VerifySignature(id, second.Counter, dataToBeSigned, first.Signature, second.Signature)
+					test_utils.AssertErrorNotNil(t, "signature verification", err)
+					if !valid {
+						t.Errorf("expected signature to be valid")
+					}
+
+					valid, _ = service.VerifySignature(id, second.Counter, []byte("tampered data"), first.Signature, second.Signature)
+					if valid {
+						t.Errorf("expected signature over tampered data to be invalid")
+					}
+				})
+			}
+		})
+		t.Run("verify signature with unknown ID", func(t *testing.T) {
+			_, err := service.VerifySignature("unknownId", 0, []byte("test data"), nil, []byte("signature"))
+			if err == nil {
+				t.Errorf("expected not found error")
+			}
+		})
+		t.Run("sign transaction records signatures in the device ledger", func(t *testing.T) {
+			id, _ := service.Create("ledgerDevice", domain.ECC, domain.DeviceMetadata{})
+			transactions := []*domain.SignedTransaction{}
+			for i := 0; i < 3; i++ {
+				transaction, _ := service.SignTransaction(id, []byte(fmt.Sprintf("transaction %d", i)))
+				transactions = append(transactions, transaction)
+			}
+
+			records, err := service.FindSignatures(id, 0, -1)
+			test_utils.AssertErrorNotNil(t, "signature records retrieval", err)
+			if len(records) != len(transactions) {
+				t.Fatalf("expected %d signature records, got %d", len(transactions), len(records))
+			}
+			for i, record := range records {
+				dataHash := sha256.Sum256([]byte(fmt.Sprintf("transaction %d", i)))
+				if record.Counter != i || record.SignedData != transactions[i].SignedData || !bytes.Equal(record.Signature, transactions[i].Signature) {
+					t.Errorf("expected signature record %d to match signed transaction", i)
+				}
+				if record.DataHash != hex.EncodeToString(dataHash[:]) {
+					t.Errorf("expected signature record %d data hash to be %x, got %s", i, dataHash, record.DataHash)
+				}
+				if record.Timestamp.IsZero() {
+					t.Errorf("expected signature record %d timestamp to be set", i)
+				}
+			}
+
+			records, _ = service.FindSignatures(id, 1, 2)
+			if len(records) != 1 || records[0].Counter != 1 {
+				t.Errorf("expected signature records range to hold only counter 1")
+			}
+		})
+		t.Run("find signatures with unknown ID", func(t *testing.T) {
+			_, err := service.FindSignatures("unknownId", 0, -1)
+			if err == nil {
+				t.Errorf("expected not found error")
+			}
+		})
+		t.Run("sign transaction with unknown ID", func(t *testing.T) {
+			_, err := service.SignTransaction("unknownId", []byte("test data"))
+			if err == nil {
+				t.Errorf("expected not found error")
+			}
+		})
+	})
+}
+
+func TestSignatureDeviceKeyStore(t *testing.T) {
+	store := test_utils.StubSignatureDeviceStore{
+		Store: map[string]*domain.SignatureDevice{},
+	}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	keyStore := test_utils.NewStubKeyStore(t)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, keyStore)
+
+	t.Run("devices only hold a reference to their key", func(t *testing.T) {
+		for _, keyType := range []domain.KeyGenAlgorithm{domain.RSA, domain.ECC, domain.Ed25519} {
+			id, _ := service.Create("device", keyType, domain.DeviceMetadata{})
+			device, _ := store.FindById(id)
+
+			publicKey, err := keyStore.PublicKey(device.KeyHandle)
+			test_utils.AssertErrorNotNil(t, "public key retrieval", err)
+			if !bytes.Equal(publicKey, device.PublicKey) {
+				t.Errorf("expected device %s public key to be the one of key %s", id, device.KeyHandle)
+			}
+			serializedDevice, _ := json.Marshal(device)
+			if bytes.Contains(serializedDevice, []byte("PRIVATE")) {
+				t.Errorf("expected device %s not to hold private key material", id)
+			}
+		}
+	})
+	t.Run("sign transaction with the key store", func(t *testing.T) {
+		id, _ := service.Create("device", domain.ECC, domain.DeviceMetadata{})
+
+		transaction, err := service.SignTransaction(id, []byte("data"))
+		test_utils.AssertErrorNotNil(t, "transaction signing", err)
+		valid, _ := service.VerifySignature(id, 0, []byte("data"), []byte(id), transaction.Signature)
+		if !valid {
+			t.Errorf("expected key store signature to verify against the device public key")
+		}
+	})
+	t.Run("sign transaction with destroyed key", func(t *testing.T) {
+		id, _ := service.Create("device", domain.RSA, domain.DeviceMetadata{})
+		device, _ := store.FindById(id)
+		keyStore.Destroy(device.KeyHandle)
+
+		_, err := service.SignTransaction(id, []byte("data"))
+		var signingErr *domain.SigningError
+		if !errors.As(err, &signingErr) || signingErr.DeviceId != id {
+			t.Errorf("expected signing error for device %s, got %v", id, err)
+		}
+		var keyNotFound crypto.KeyNotFoundError
+		if !errors.As(err, &keyNotFound) {
+			t.Errorf("expected key not found error, got %v", err)
+		}
+		if device, _ := store.FindById(id); device.GetSignatureCounter() != 0 {
+			t.Errorf("expected failed signing not to advance the signature counter")
+		}
+	})
+}
+
+func TestSignatureDeviceServiceErrors(t *testing.T) {
+	store := test_utils.StubSignatureDeviceStore{
+		Store: map[string]*domain.SignatureDevice{},
+	}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	keyStoreErr := errors.New("token removed")
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, &failingKeyStore{err: keyStoreErr})
+
+	t.Run("key generation failure is returned as KeyGenerationError", func(t *testing.T) {
+		_, err := service.Create("device", domain.ECDSAP256, domain.DeviceMetadata{})
+		var keyGenerationErr *domain.KeyGenerationError
+		if !errors.As(err, &keyGenerationErr) || keyGenerationErr.KeyType != domain.ECDSAP256 {
+			t.Errorf("expected key generation error for %s, got %v", domain.ECDSAP256, err)
+		}
+		if !errors.Is(err, keyStoreErr) {
+			t.Errorf("expected key generation error to wrap the key store error, got %v", err)
+		}
+		if devices, _ := store.FindAll(); len(devices) != 0 {
+			t.Errorf("expected no device to be stored, found %d", len(devices))
+		}
+	})
+	t.Run("undecodable public key is returned as KeyDecodingError", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.RSA)
+		id, _ := store.Create(device)
+
+		_, err := service.VerifySignature(id, 0, []byte("data"), []byte(id), []byte("signature"))
+		var keyDecodingErr *domain.KeyDecodingError
+		if !errors.As(err, &keyDecodingErr) || keyDecodingErr.DeviceId != id {
+			t.Errorf("expected key decoding error for device %s, got %v", id, err)
+		}
+	})
+	t.Run("unknown device is returned as DeviceNotFoundError", func(t *testing.T) {
+		_, err := service.SignTransaction("unknownId", []byte("data"))
+		var notFoundErr domain.DeviceNotFoundError
+		if !errors.As(err, &notFoundErr) {
+			t.Errorf("expected device not found error, got %v", err)
+		}
+	})
+}
+
+// failingKeyStore is a crypto.KeyStore failing every operation with err.
+type failingKeyStore struct {
+	err error
+}
+
+func (s *failingKeyStore) GenerateKey(algorithm crypto.KeyAlgorithm) (crypto.KeyHandle, error) {
+	return "", s.err
+}
+
+func (s *failingKeyStore) PublicKey(handle crypto.KeyHandle) ([]byte, error) {
+	return nil, s.err
+}
+
+func (s *failingKeyStore) Sign(handle crypto.KeyHandle, message []byte) ([]byte, error) {
+	return nil, s.err
+}
+
+func (s *failingKeyStore) Destroy(handle crypto.KeyHandle) error {
+	return s.err
+}
+
+func TestSignatureDeviceRegisteredAlgorithm(t *testing.T) {
+	// a test-only algorithm, signing the SHA-256 digest of the secured data string with
+	// Ed25519, registered under a name of its own so that test runs do not collide
+	keyType := domain.KeyGenAlgorithm(fmt.Sprintf("TEST-Ed25519-SHA256-%d", testAlgorithmRuns.Add(1)))
+	ed25519Algorithm, _ := crypto.DefaultAlgorithmRegistry.Lookup(crypto.Ed25519KeyAlgorithm)
+	sign := func(privateKey gocrypto.Signer, message []byte) ([]byte, error) {
+		digest := sha256.Sum256(message)
+		return ed25519Algorithm.Sign(privateKey, digest[:])
+	}
+	err := crypto.RegisterAlgorithm(crypto.KeyAlgorithm(keyType), crypto.Algorithm{
+		Parameters: crypto.KeyAlgorithmParameters{Family: "TEST", KeySize: 256},
+		Generate:   ed25519Algorithm.Generate,
+		Marshaler:  ed25519Algorithm.Marshaler,
+		Sign:       sign,
+		NewVerifier: func(devicePublicKey []byte, lastSignature string, signatureCount int) (crypto.Verifier, error) {
+			return &digestEd25519Verifier{publicKey: devicePublicKey, lastSignature: lastSignature, signatureCount: signatureCount}, nil
+		},
+	})
+	test_utils.AssertErrorNotNil(t, "algorithm registration", err)
+
+	store := test_utils.StubSignatureDeviceStore{
+		Store: map[string]*domain.SignatureDevice{},
+	}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
+
+	t.Run("registered algorithm is a supported key generation algorithm", func(t *testing.T) {
+		parameters, err := keyType.Parameters()
+		test_utils.AssertErrorNotNil(t, "algorithm parameters", err)
+		if parameters.Family != "TEST" {
+			t.Errorf("expected registered algorithm family to be TEST, got %s", parameters.Family)
+		}
+	})
+	t.Run("sign, verify and audit with registered algorithm", func(t *testing.T) {
+		id, err := service.Create("testDevice", keyType, domain.DeviceMetadata{})
+		test_utils.AssertErrorNotNil(t, "signature device creation", err)
+		first, err := service.SignTransaction(id, []byte("data"))
+		test_utils.AssertErrorNotNil(t, "transaction signing", err)
+		second, err := service.SignTransaction(id, []byte("data"))
+		test_utils.AssertErrorNotNil(t, "transaction signing", err)
+
+		valid, err := service.VerifySignature(id, second.Counter, []byte("data"), first.Signature, second.Signature)
+		test_utils.AssertErrorNotNil(t, "signature verification", err)
+		if !valid {
+			t.Errorf("expected registered algorithm signature to be valid")
+		}
+		report, err := service.AuditSignatureChain(id)
+		test_utils.AssertErrorNotNil(t, "signature chain audit", err)
+		if !report.Valid() || report.VerifiedSignatures != 2 {
+			t.Errorf("expected 2 valid signatures, got %d and broken link %v", report.VerifiedSignatures, report.BrokenLink)
+		}
+	})
+}
+
+var testAlgorithmRuns atomic.Int64
+
+// digestEd25519Verifier verifies the signatures of the test-only algorithm registered by
+// TestSignatureDeviceRegisteredAlgorithm.
+type digestEd25519Verifier struct {
+	publicKey      []byte
+	lastSignature  string
+	signatureCount int
+}
+
+func (v *digestEd25519Verifier) Verify(dataToBeSigned []byte, signature []byte) (bool, error) {
+	publicKey, err := crypto.NewEd25519Marshaler().UnmarshalPublic(v.publicKey)
+	if err != nil {
+		return false, err
+	}
+	digest := sha256.Sum256([]byte(crypto.SignatureInput(v.signatureCount, dataToBeSigned, v.lastSignature)))
+	return ed25519.Verify(publicKey.(ed25519.PublicKey), digest[:], signature), nil
+}
+
+func TestSignatureChainAudit(t *testing.T) {
+	store := test_utils.StubSignatureDeviceStore{
+		Store: map[string]*domain.SignatureDevice{},
+	}
+	signatures := test_utils.StubSignatureRecordStore{
+		Records: map[string][]*domain.SignatureRecord{},
+	}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &signatures, test_utils.NewStubKeyStore(t))
+
+	newSignedDevice := func(keyType domain.KeyGenAlgorithm, transactionsCount int) string {
+		id, _ := service.Create("auditedDevice", keyType, domain.DeviceMetadata{})
+		for i := 0; i < transactionsCount; i++ {
+			service.SignTransaction(id, []byte(fmt.Sprintf("transaction_%d", i)))
+		}
+		return id
+	}
+
+	t.Run("audit intact signature chain", func(t *testing.T) {
+		for _, keyType := range []domain.KeyGenAlgorithm{domain.RSA, domain.ECC, domain.Ed25519} {
+			t.Run(string(keyType), func(t *testing.T) {
+				id := newSignedDevice(keyType, 5)
+
+				report, err := service.AuditSignatureChain(id)
+				test_utils.AssertErrorNotNil(t, "signature chain audit", err)
+				if !report.Valid() || report.VerifiedSignatures != 5 {
+					t.Errorf("expected 5 valid signatures, got %d and broken link %v", report.VerifiedSignatures, report.BrokenLink)
+				}
+			})
+		}
+	})
+	t.Run("audit device without signatures", func(t *testing.T) {
+		id := newSignedDevice(domain.ECC, 0)
+
+		report, err := service.AuditSignatureChain(id)
+		test_utils.AssertErrorNotNil(t, "signature chain audit", err)
+		if !report.Valid() || report.VerifiedSignatures != 0 {
+			t.Errorf("expected empty signature chain to be valid")
+		}
+	})
+	t.Run("audit broken signature chain", func(t *testing.T) {
+		brokenChainTestCases := []struct {
+			description string
+			tamper      func(records []*domain.SignatureRecord) []*domain.SignatureRecord
+		}{
+			{"tampered signed data", func(records []*domain.SignatureRecord) []*domain.SignatureRecord {
+				records[2].SignedData = strings.Replace(records[2].SignedData, "transaction_2", "transaction_X", 1)
+				return records
+			}},
+			{"tampered signature", func(records []*domain.SignatureRecord) []*domain.SignatureRecord {
+				records[2].Signature = records[1].Signature
+				return records
+			}},
+			{"signed data not chained to previous signature", func(records []*domain.SignatureRecord) []*domain.SignatureRecord {
+				records[2].SignedData = crypto.SignatureInput(2, []byte("transaction_2"), "otherSignature")
+				return records
+			}},
+			{"signed data with wrong counter", func(records []*domain.SignatureRecord) []*domain.SignatureRecord {
+				records[2].SignedData = "3" + strings.TrimPrefix(records[2].SignedData, "2")
+				return records
+			}},
+			{"missing signature", func(records []*domain.SignatureRecord) []*domain.SignatureRecord {
+				return records[:2]
+			}},
+		}
+		for _, tc := range brokenChainTestCases {
+			t.Run(tc.description, func(t *testing.T) {
+				id := newSignedDevice(domain.ECC, 4)
+				signatures.Records[id] = tc.tamper(signatures.Records[id])
+
+				report, err := service.AuditSignatureChain(id)
+				test_utils.AssertErrorNotNil(t, "signature chain audit", err)
+				if report.Valid() || report.BrokenLink.Counter != 2 {
+					t.Errorf("expected signature chain to be broken at counter 2, got %v", report.BrokenLink)
+				}
+				if report.VerifiedSignatures != 2 {
+					t.Errorf("expected 2 verified signatures, got %d", report.VerifiedSignatures)
+				}
+			})
+		}
+	})
+	t.Run("audit device with unknown ID", func(t *testing.T) {
+		_, err := service.AuditSignatureChain("unknownId")
+		if err == nil {
+			t.Errorf("expected not found error")
+		}
+	})
+}
+
+func TestSignatureDeviceServiceConcurrency(t *testing.T) {
+	store := test_utils.StubSignatureDeviceStore{
+		Store: map[string]*domain.SignatureDevice{},
+	}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
+
+	t.Run("concurrent transaction signing keeps counter and chain consistent", func(t *testing.T) {
+		id, _ := service.Create("concurrentDevice", domain.ECC, domain.DeviceMetadata{})
+		transactionsCount := 500
+
+		var wg sync.WaitGroup
+		transactions := make(chan *domain.SignedTransaction, transactionsCount)
+		for i := 0; i < transactionsCount; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				transaction, err := service.SignTransaction(id, []byte(fmt.Sprintf("transaction %d", i)))
+				if err != nil {
+					t.Errorf("an error occurred during transaction signing, error: %s", err.Error())
+					return
+				}
+				transactions <- transaction
+			}(i)
+		}
+		wg.Wait()
+		close(transactions)
+
+		chain := make([]*domain.SignedTransaction, transactionsCount)
+		for transaction := range transactions {
+			if transaction.Counter < 0 || transaction.Counter >= transactionsCount {
+				t.Fatalf("expected signature counter in [0, %d), got %d", transactionsCount, transaction.Counter)
+			}
+			if chain[transaction.Counter] != nil {
+				t.Fatalf("expected signature counter %d to be used once, found duplicate", transaction.Counter)
+			}
+			chain[transaction.Counter] = transaction
+		}
+
+		for counter, transaction := range chain {
+			if transaction == nil {
+				t.Fatalf("expected a signature with counter %d, found none", counter)
+			}
+			if !strings.HasPrefix(transaction.SignedData, fmt.Sprintf("%d_", counter)) {
+				t.Errorf("expected signed data %s to start with counter %d", transaction.SignedData, counter)
+			}
+			expectedLastSignature := base64.StdEncoding.EncodeToString([]byte(id))
+			if counter > 0 {
+				expectedLastSignature = base64.StdEncoding.EncodeToString(chain[counter-1].Signature)
+			}
+			if !strings.HasSuffix(transaction.SignedData, "_"+expectedLastSignature) {
+				t.Errorf("expected signed data %s to chain from signature %d", transaction.SignedData, counter-1)
+			}
+		}
+
+		device, _ := service.FindById(id)
+		if device.GetSignatureCounter() != transactionsCount {
+			t.Errorf("expected device signature counter to be %d, got %d", transactionsCount, device.GetSignatureCounter())
+		}
+	})
+}
+
+func TestSignatureDeviceServiceIndependentDevices(t *testing.T) {
+	store := test_utils.StubSignatureDeviceStore{
+		Store: map[string]*domain.SignatureDevice{},
+	}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
+
+	t.Run("concurrent transaction signing on independent devices", func(t *testing.T) {
+		devicesCount, transactionsPerDevice := 8, 50
+		deviceIds := make([]string, devicesCount)
+		for i := range deviceIds {
+			deviceIds[i], _ = service.Create(fmt.Sprintf("device%d", i), domain.ECC, domain.DeviceMetadata{})
+		}
+
+		var wg sync.WaitGroup
+		for _, id := range deviceIds {
+			for i := 0; i < transactionsPerDevice; i++ {
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					if _, err := service.SignTransaction(id, []byte("test data")); err != nil {
+						t.Errorf("an error occurred during transaction signing, error: %s", err.Error())
+					}
+					service.FindAll()
+				}(id)
+			}
+		}
+		wg.Wait()
+
+		for _, id := range deviceIds {
+			device, _ := service.FindById(id)
+			if device.GetSignatureCounter() != transactionsPerDevice {
+				t.Errorf("expected device %s signature counter to be %d, got %d", id, transactionsPerDevice, device.GetSignatureCounter())
+			}
+		}
+	})
+}
+
+// BenchmarkSignTransaction signs transactions in parallel, spreading them across a growing
+// number of devices: with per-device locking throughput scales with the devices count
+// (up to the available CPUs) instead of being capped at a single signing at a time.
+func BenchmarkSignTransaction(b *testing.B) {
+	for _, devicesCount := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("devices=%d", devicesCount), func(b *testing.B) {
+			store := test_utils.StubSignatureDeviceStore{
+				Store: map[string]*domain.SignatureDevice{},
+			}
+			repository, _ := domain.NewSignatureDeviceRepository(&store)
+			service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(b))
+
+			deviceIds := make([]string, devicesCount)
+			for i := range deviceIds {
+				deviceIds[i], _ = service.Create(fmt.Sprintf("device%d", i), domain.ECC, domain.DeviceMetadata{})
+			}
+
+			var next atomic.Uint64
+			b.SetParallelism(devicesCount)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				id := deviceIds[int(next.Add(1))%devicesCount]
+				for pb.Next() {
+					if _, err := service.SignTransaction(id, []byte("test data")); err != nil {
+						b.Fatalf("an error occurred during transaction signing, error: %s", err.Error())
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestSignatureDeviceLifecycle(t *testing.T) {
+	t.Run("new devices are active", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.ECC)
+		if device.GetState() != domain.DeviceActive || device.GetRetirement() != nil {
+			t.Errorf("expected new device to be active, got %s", device.GetState())
+		}
+	})
+	t.Run("device state transitions", func(t *testing.T) {
+		for _, tc := range []struct {
+			description   string
+			transitions   []domain.DeviceState
+			reason        string
+			expectedState domain.DeviceState
+			expectedErr   error
+		}{
+			{"suspend", []domain.DeviceState{domain.DeviceSuspended}, "", domain.DeviceSuspended, nil},
+			{"reactivate", []domain.DeviceState{domain.DeviceSuspended, domain.DeviceActive}, "", domain.DeviceActive, nil},
+			{"retire", []domain.DeviceState{domain.DeviceRetired}, "compromised", domain.DeviceRetired, nil},
+			{"retire suspended device", []domain.DeviceState{domain.DeviceSuspended, domain.DeviceRetired}, "compromised", domain.DeviceRetired, nil},
+			{"retire without reason", []domain.DeviceState{domain.DeviceRetired}, " ", domain.DeviceActive, domain.DeviceStateTransitionError("")},
+			{"reactivate retired device", []domain.DeviceState{domain.DeviceRetired, domain.DeviceActive}, "compromised", domain.DeviceRetired, domain.DeviceStateTransitionError("")},
+			{"suspend retired device", []domain.DeviceState{domain.DeviceRetired, domain.DeviceSuspended}, "compromised", domain.DeviceRetired, domain.DeviceStateTransitionError("")},
+			{"unknown state", []domain.DeviceState{"DESTROYED"}, "", domain.DeviceActive, domain.DeviceStateNotValidError("")},
+		} {
+			t.Run(tc.description, func(t *testing.T) {
+				device, _ := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.ECC)
+				var err error
+				for _, state := range tc.transitions {
+					if err = device.Transition(state, tc.reason, time.Now()); err != nil {
+						break
+					}
+				}
+
+				if reflect.TypeOf(err) != reflect.TypeOf(tc.expectedErr) {
+					t.Errorf("expected %T error, got %v", tc.expectedErr, err)
+				}
+				if device.GetState() != tc.expectedState {
+					t.Errorf("expected device to be %s, got %s", tc.expectedState, device.GetState())
+				}
+			})
+		}
+	})
+	t.Run("retirement is recorded with its reason and timestamp", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.ECC)
+		retiredAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		device.Transition(domain.DeviceRetired, "key compromised", retiredAt)
+		device.Transition(domain.DeviceRetired, "retired again", time.Now())
+
+		retirement := device.GetRetirement()
+		if retirement == nil || retirement.Reason != "key compromised" || !retirement.RetiredAt.Equal(retiredAt) {
+			t.Errorf("expected retirement to be recorded once, got %+v", retirement)
+		}
+	})
+	t.Run("serialize SignatureDevice with its lifecycle state", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey"), "keyHandle", domain.ECC)
+		device.Transition(domain.DeviceRetired, "key compromised", time.Now())
+
+		serializedDevice, _ := json.Marshal(device)
+		var deserializedDevice domain.SignatureDevice
+		err := json.Unmarshal(serializedDevice, &deserializedDevice)
+		test_utils.AssertErrorNotNil(t, "signature device deserialization", err)
+
+		if deserializedDevice.GetState() != domain.DeviceRetired || deserializedDevice.GetRetirement() == nil || deserializedDevice.GetRetirement().Reason != "key compromised" {
+			t.Errorf("expected deserialized device to keep its lifecycle state")
+		}
+	})
+	t.Run("devices stored without state are active", func(t *testing.T) {
+		var device domain.SignatureDevice
+		err := json.Unmarshal([]byte(`{"id": "legacyDevice", "label": "legacy", "key_type": "ECC", "signature_counter": 3}`), &device)
+		test_utils.AssertErrorNotNil(t, "signature device deserialization", err)
+
+		if device.GetState() != domain.DeviceActive {
+			t.Errorf("expected legacy device to be active, got %s", device.GetState())
+		}
+	})
+
+	store := test_utils.StubSignatureDeviceStore{Store: map[string]*domain.SignatureDevice{}}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
+
+	t.Run("only active devices sign", func(t *testing.T) {
+		id, _ := service.Create("device", domain.Ed25519, domain.DeviceMetadata{})
+		service.SignTransaction(id, []byte("first"))
+
+		device, err := service.SetState(id, domain.DeviceSuspended, "")
+		test_utils.AssertErrorNotNil(t, "device suspension", err)
+		if device.GetState() != domain.DeviceSuspended {
+			t.Errorf("expected suspended device, got %s", device.GetState())
+		}
+		_, err = service.SignTransaction(id, []byte("second"))
+		var notActiveErr domain.DeviceNotActiveError
+		if !errors.As(err, &notActiveErr) {
+			t.Errorf("expected DeviceNotActiveError, got %v", err)
+		}
+
+		service.SetState(id, domain.DeviceActive, "")
+		transaction, err := service.SignTransaction(id, []byte("second"))
+		test_utils.AssertErrorNotNil(t, "transaction signing", err)
+		if transaction.Counter != 1 {
+			t.Errorf("expected reactivated device to continue its chain at counter 1, got %d", transaction.Counter)
+		}
+	})
+	t.Run("retired devices keep their signatures verifiable", func(t *testing.T) {
+		id, _ := service.Create("device", domain.ECC, domain.DeviceMetadata{})
+		transaction, _ := service.SignTransaction(id, []byte("data"))
+		_, err := service.SetState(id, domain.DeviceRetired, "decommissioned")
+		test_utils.AssertErrorNotNil(t, "device retirement", err)
+
+		if _, err := service.SetState(id, domain.DeviceActive, ""); err == nil {
+			t.Errorf("expected retired device not to be reactivated")
+		}
+		if _, err := service.SignTransaction(id, []byte("data")); err == nil {
+			t.Errorf("expected retired device not to sign")
+		}
+		valid, err := service.VerifySignature(id, transaction.Counter, []byte("data"), []byte(id), transaction.Signature)
+		if !valid || err != nil {
+			t.Errorf("expected signature of retired device to verify, error: %v", err)
+		}
+		report, err := service.AuditSignatureChain(id)
+		if err != nil || !report.Valid() || report.VerifiedSignatures != 1 {
+			t.Errorf("expected signature chain of retired device to be intact, error: %v", err)
+		}
+	})
+	t.Run("set state of unknown device", func(t *testing.T) {
+		_, err := service.SetState("unknownId", domain.DeviceSuspended, "")
+		var notFoundErr domain.DeviceNotFoundError
+		if !errors.As(err, &notFoundErr) {
+			t.Errorf("expected device not found error, got %v", err)
+		}
+	})
+}
+
+func TestSignatureDeviceKeyRotation(t *testing.T) {
+	t.Run("rotated keys are versioned by the counter they became active at", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey1"), "keyHandle1", domain.ECC)
+		device.SetLastSignature([]byte("signature0"))
+		device.SetLastSignature([]byte("signature1"))
+		device.RotateKey([]byte("publicKey2"), "keyHandle2")
+		device.RotateKey([]byte("publicKey3"), "keyHandle3")
+		device.SetLastSignature([]byte("signature2"))
+
+		if device.GetKeyVersion() != 3 || string(device.PublicKey) != "publicKey3" || device.KeyHandle != "keyHandle3" {
+			t.Errorf("expected device to use key version 3, got version %d", device.GetKeyVersion())
+		}
+		if string(device.GetChainingSignature()) != "signature2" {
+			t.Errorf("expected signature chain to continue across rotations")
+		}
+		for counter, expectedVersion := range []int{1, 1, 3, 3} {
+			if got := device.KeyVersionAt(counter); got.Version != expectedVersion {
+				t.Errorf("expected signature %d to use key version %d, got %d", counter, expectedVersion, got.Version)
+			}
+		}
+		keyVersion, err := device.FindKeyVersion(2)
+		if err != nil || string(keyVersion.PublicKey) != "publicKey2" || keyVersion.ActiveFromCounter != 2 {
+			t.Errorf("expected key version 2 to be kept, got %+v", keyVersion)
+		}
+		var notFoundErr domain.KeyVersionNotFoundError
+		if _, err := device.FindKeyVersion(4); !errors.As(err, &notFoundErr) {
+			t.Errorf("expected KeyVersionNotFoundError, got %v", err)
+		}
+	})
+	t.Run("serialize SignatureDevice with its key versions", func(t *testing.T) {
+		device, _ := domain.NewSignatureDevice("device", []byte("publicKey1"), "keyHandle1", domain.ECC)
+		device.SetLastSignature([]byte("signature0"))
+		device.RotateKey([]byte("publicKey2"), "keyHandle2")
+
+		serializedDevice, _ := json.Marshal(device)
+		var deserializedDevice domain.SignatureDevice
+		json.Unmarshal(serializedDevice, &deserializedDevice)
+
+		if deserializedDevice.GetKeyVersion() != 2 || deserializedDevice.KeyVersionAt(0).Version != 1 || deserializedDevice.KeyVersionAt(1).Version != 2 {
+			t.Errorf("expected deserialized device to keep its key versions, got %+v", deserializedDevice.GetKeyVersions())
+		}
+	})
+
+	keyStore := test_utils.NewStubKeyStore(t)
+	store := test_utils.StubSignatureDeviceStore{Store: map[string]*domain.SignatureDevice{}}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, keyStore)
+
+	t.Run("signature chain continues across key rotations", func(t *testing.T) {
+		for _, keyType := range []domain.KeyGenAlgorithm{domain.RSA, domain.ECC, domain.Ed25519} {
+			t.Run(string(keyType), func(t *testing.T) {
+				id, _ := service.Create("rotatedDevice", keyType, domain.DeviceMetadata{})
+				firstTransaction, _ := service.SignTransaction(id, []byte("first"))
+				lastTransaction, _ := service.SignTransaction(id, []byte("second"))
+				device, _ := service.FindById(id)
+				previousKeyHandle := device.KeyHandle
+
+				rotatedDevice, err := service.RotateKey(id)
+				test_utils.AssertErrorNotNil(t, "key rotation", err)
+				if rotatedDevice.GetKeyVersion() != 2 || rotatedDevice.GetSignatureCounter() != 2 || rotatedDevice.KeyHandle == previousKeyHandle {
+					t.Errorf("expected device to use a new key version 2 at counter 2, got version %d at counter %d", rotatedDevice.GetKeyVersion(), rotatedDevice.GetSignatureCounter())
+				}
+				if _, err := keyStore.Sign(previousKeyHandle, []byte("data")); err == nil {
+					t.Errorf("expected previous private key to be destroyed")
+				}
+
+				transaction, err := service.SignTransaction(id, []byte("third"))
+				test_utils.AssertErrorNotNil(t, "transaction signing", err)
+				expectedSignedData := crypto.SignatureInput(2, []byte("third"), string(lastTransaction.Signature))
+				if transaction.Counter != 2 || transaction.KeyVersion != 2 || transaction.SignedData != expectedSignedData {
+					t.Errorf("expected signature 2 with key version 2 to chain from the last signature of the previous key, got %+v", transaction)
+				}
+
+				valid, err := service.VerifySignature(id, lastTransaction.Counter, []byte("second"), firstTransaction.Signature, lastTransaction.Signature)
+				if err != nil || !valid {
+					t.Errorf("expected signature of the previous key to verify, error: %v", err)
+				}
+				report, err := service.AuditSignatureChain(id)
+				if err != nil || !report.Valid() || report.VerifiedSignatures != 3 {
+					t.Errorf("expected signature chain to be intact across the rotation, got %+v, error: %v", report, err)
+				}
+			})
+		}
+	})
+	t.Run("retired devices keys are not rotated", func(t *testing.T) {
+		id, _ := service.Create("retiredDevice", domain.Ed25519, domain.DeviceMetadata{})
+		service.SetState(id, domain.DeviceRetired, "decommissioned")
+
+		_, err := service.RotateKey(id)
+		var notActiveErr domain.DeviceNotActiveError
+		if !errors.As(err, &notActiveErr) {
+			t.Errorf("expected DeviceNotActiveError, got %v", err)
+		}
+		device, _ := service.FindById(id)
+		if device.GetKeyVersion() != 1 {
+			t.Errorf("expected retired device to keep its key, got version %d", device.GetKeyVersion())
+		}
+	})
+	t.Run("rotate key of unknown device", func(t *testing.T) {
+		_, err := service.RotateKey("unknownId")
+		var notFoundErr domain.DeviceNotFoundError
+		if !errors.As(err, &notFoundErr) {
+			t.Errorf("expected device not found error, got %v", err)
+		}
+	})
+}
+
+func TestSignatureDeviceMetadata(t *testing.T) {
+	store := test_utils.StubSignatureDeviceStore{Store: map[string]*domain.SignatureDevice{}}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, test_utils.NewStubKeyStore(t))
+
+	t.Run("devices are created with their metadata", func(t *testing.T) {
+		tags := map[string]string{"site": "berlin"}
+		id, err := service.Create("device", domain.Ed25519, domain.DeviceMetadata{Owner: "tenant-42", Tags: tags})
+		test_utils.AssertErrorNotNil(t, "device creation", err)
+		tags["site"] = "munich"
+
+		device, _ := service.FindById(id)
+		if device.Owner != "tenant-42" || device.Tags["site"] != "berlin" || device.KeyType != domain.Ed25519 {
+			t.Errorf("expected device to be created with its metadata, got owner %q, tags %v", device.Owner, device.Tags)
+		}
+		if device.GetCreatedAt().IsZero() || !device.GetUpdatedAt().Equal(device.GetCreatedAt()) || device.GetLastSignedAt() != nil {
+			t.Errorf("expected new device timestamps, got created at %v, updated at %v, last signed at %v", device.GetCreatedAt(), device.GetUpdatedAt(), device.GetLastSignedAt())
+		}
+	})
+	t.Run("signing and updates are timestamped", func(t *testing.T) {
+		id, _ := service.Create("device", domain.Ed25519, domain.DeviceMetadata{})
+		created, _ := service.FindById(id)
+
+		service.SignTransaction(id, []byte("data"))
+		signed, _ := service.FindById(id)
+		if signed.GetLastSignedAt() == nil || signed.GetLastSignedAt().Before(created.GetCreatedAt()) || signed.GetUpdatedAt().Before(*signed.GetLastSignedAt()) {
+			t.Errorf("expected signing to be timestamped, got updated at %v, last signed at %v", signed.GetUpdatedAt(), signed.GetLastSignedAt())
+		}
+
+		suspended, _ := service.SetState(id, domain.DeviceSuspended, "")
+		if suspended.GetUpdatedAt().Before(signed.GetUpdatedAt()) || !suspended.GetLastSignedAt().Equal(*signed.GetLastSignedAt()) {
+			t.Errorf("expected update to be timestamped, got updated at %v", suspended.GetUpdatedAt())
+		}
+		if !suspended.GetCreatedAt().Equal(created.GetCreatedAt()) {
+			t.Errorf("expected creation time to be kept, got %v", suspended.GetCreatedAt())
+		}
+	})
+	t.Run("serialize SignatureDevice with its metadata", func(t *testing.T) {
+		id, _ := service.Create("device", domain.ECC, domain.DeviceMetadata{Owner: "tenant-42", Tags: map[string]string{"site": "berlin"}})
+		service.SignTransaction(id, []byte("data"))
+		device, _ := service.FindById(id)
+
+		serializedDevice, _ := json.Marshal(device)
+		var deserializedDevice domain.SignatureDevice
+		json.Unmarshal(serializedDevice, &deserializedDevice)
+
+		if deserializedDevice.Owner != device.Owner || !reflect.DeepEqual(deserializedDevice.Tags, device.Tags) {
+			t.Errorf("expected deserialized device to keep owner and tags, got owner %q, tags %v", deserializedDevice.Owner, deserializedDevice.Tags)
+		}
+		if !deserializedDevice.GetCreatedAt().Equal(device.GetCreatedAt()) || !deserializedDevice.GetUpdatedAt().Equal(device.GetUpdatedAt()) || !deserializedDevice.GetLastSignedAt().Equal(*device.GetLastSignedAt()) {
+			t.Errorf("expected deserialized device to keep its timestamps")
+		}
+	})
+}
+
+func TestSignatureDeviceUpdateAndDeletion(t *testing.T) {
+	keyStore := test_utils.NewStubKeyStore(t)
+	store := test_utils.StubSignatureDeviceStore{Store: map[string]*domain.SignatureDevice{}}
+	repository, _ := domain.NewSignatureDeviceRepository(&store)
+	service, _ := domain.NewSignatureDeviceService(repository, &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}, keyStore)
+
+	t.Run("update label, tags and state at once", func(t *testing.T) {
+		id, _ := service.Create("device", domain.Ed25519, domain.DeviceMetadata{})
+		label := "renamed device"
+		suspended := domain.DeviceSuspended
+
+		device, err := service.UpdateDevice(id, domain.DeviceUpdate{Label: &label, Tags: map[string]string{"site": "berlin"}, State: &suspended})
+		test_utils.AssertErrorNotNil(t, "device update", err)
+		if device.Label != label || device.Tags["site"] != "berlin" || device.GetState() != domain.DeviceSuspended {
+			t.Errorf("expected device to be updated, got label %q, tags %v, state %s", device.Label, device.Tags, device.GetState())
+		}
+
+		device, err = service.UpdateDevice(id, domain.DeviceUpdate{})
+		test_utils.AssertErrorNotNil(t, "device update", err)
+		if device.Label != label || len(device.Tags) != 1 || device.GetState() != domain.DeviceSuspended {
+			t.Errorf("expected empty update to leave the device unchanged, got label %q, tags %v, state %s", device.Label, device.Tags, device.GetState())
+		}
+	})
+	t.Run("invalid transitions leave the device unchanged", func(t *testing.T) {
+		id, _ := service.Create("device", domain.Ed25519, domain.DeviceMetadata{})
+		label := "renamed device"
+		retired := domain.DeviceRetired
+
+		if _, err := service.UpdateDevice(id, domain.DeviceUpdate{Label: &label, State: &retired}); err == nil {
+			t.Errorf("expected retirement without reason to fail")
+		}
+		device, _ := service.FindById(id)
+		if device.Label != "device" || device.GetState() != domain.DeviceActive {
+			t.Errorf("expected device to be unchanged, got label %q, state %s", device.Label, device.GetState())
+		}
+	})
+	t.Run("deleted devices keep their signatures verifiable", func(t *testing.T) {
+		id, _ := service.Create("device", domain.ECC, domain.DeviceMetadata{})
+		transaction, _ := service.SignTransaction(id, []byte("data"))
+		device, _ := service.FindById(id)
+		keyHandle := device.KeyHandle
+
+		err := service.Delete(id)
+		test_utils.AssertErrorNotNil(t, "device deletion", err)
+		if _, err := keyStore.Sign(keyHandle, []byte("data")); err == nil {
+			t.Errorf("expected private key of deleted device to be destroyed")
+		}
+		device, err = service.FindById(id)
+		if err != nil || !device.IsDeleted() || len(device.PublicKey) == 0 {
+			t.Errorf("expected deleted device to be kept with its public key, error: %v", err)
+		}
+		devices, _ := service.FindAll()
+		for _, d := range devices {
+			if d.Id == id {
+				t.Errorf("expected deleted device not to be listed")
+			}
+		}
+
+		var deletedErr domain.DeviceDeletedError
+		if _, err := service.SignTransaction(id, []byte("data")); !errors.As(err, &deletedErr) {
+			t.Errorf("expected DeviceDeletedError on signing, got %v", err)
+		}
+		if _, err := service.UpdateDevice(id, domain.DeviceUpdate{Tags: map[string]string{"site": "berlin"}}); !errors.As(err, &deletedErr) {
+			t.Errorf("expected DeviceDeletedError on update, got %v", err)
+		}
+		if _, err := service.RotateKey(id); !errors.As(err, &deletedErr) {
+			t.Errorf("expected DeviceDeletedError on key rotation, got %v", err)
+		}
+
+		valid, err := service.VerifySignature(id, transaction.Counter, []byte("data"), []byte(id), transaction.Signature)
+		if !valid || err != nil {
+			t.Errorf("expected signature of deleted device to verify, error: %v", err)
+		}
+		report, err := service.AuditSignatureChain(id)
+		if err != nil || !report.Valid() || report.VerifiedSignatures != 1 {
+			t.Errorf("expected signature chain of deleted device to be intact, error: %v", err)
+		}
+	})
+	t.Run("delete unknown device", func(t *testing.T) {
+		err := service.Delete("unknownId")
+		var notFoundErr domain.DeviceNotFoundError
+		if !errors.As(err, &notFoundErr) {
+			t.Errorf("expected device not found error, got %v", err)
+		}
 	})
 }
 
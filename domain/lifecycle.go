@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DeviceState is the lifecycle state of a signature device. Only active devices sign;
+// suspended devices can be reactivated, retired devices cannot leave their state.
+type DeviceState string
+
+const (
+	DeviceActive    DeviceState = "ACTIVE"
+	DeviceSuspended DeviceState = "SUSPENDED"
+	DeviceRetired   DeviceState = "RETIRED"
+)
+
+// DeviceStates returns the lifecycle states of signature devices.
+func DeviceStates() []DeviceState {
+	return []DeviceState{DeviceActive, DeviceSuspended, DeviceRetired}
+}
+
+// Valid reports whether the state is one of the DeviceStates.
+func (s DeviceState) Valid() bool {
+	for _, state := range DeviceStates() {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Retirement records why and when a signature device has been retired.
+type Retirement struct {
+	Reason    string    `json:"reason"`
+	RetiredAt time.Time `json:"retired_at"`
+}
+
+type DeviceStateNotValidError string
+
+func (e DeviceStateNotValidError) Error() string {
+	return string(e)
+}
+
+// DeviceStateTransitionError is returned for transitions the lifecycle does not allow,
+// i.e. out of the retired state.
+type DeviceStateTransitionError string
+
+func (e DeviceStateTransitionError) Error() string {
+	return string(e)
+}
+
+// DeviceNotActiveError is returned when a device which is not active is asked to sign.
+type DeviceNotActiveError string
+
+func (e DeviceNotActiveError) Error() string {
+	return string(e)
+}
+
+// DeviceDeletedError is returned when a deleted device is asked to sign or to change.
+type DeviceDeletedError string
+
+func (e DeviceDeletedError) Error() string {
+	return string(e)
+}
+
+// GetState returns the lifecycle state of the device. Devices stored before lifecycle
+// states existed are active.
+func (s *SignatureDevice) GetState() DeviceState {
+	if s.state == "" {
+		return DeviceActive
+	}
+	return s.state
+}
+
+// GetRetirement returns the retirement of the device, or nil if it is not retired.
+func (s *SignatureDevice) GetRetirement() *Retirement {
+	return s.retirement
+}
+
+// Transition moves the device to state. Retiring requires a reason, recorded along with
+// at, and is irreversible; transitions to the current state are no-ops.
+func (s *SignatureDevice) Transition(state DeviceState, reason string, at time.Time) error {
+	if !state.Valid() {
+		return DeviceStateNotValidError(fmt.Sprintf("device state %q not valid or unknown", state))
+	}
+	current := s.GetState()
+	if current == DeviceRetired {
+		if state == DeviceRetired {
+			return nil
+		}
+		return DeviceStateTransitionError(fmt.Sprintf("device %s is retired and cannot become %s", s.Id, state))
+	}
+	if state == DeviceRetired {
+		if strings.TrimSpace(reason) == "" {
+			return DeviceStateTransitionError(fmt.Sprintf("device %s cannot be retired without a reason", s.Id))
+		}
+		s.retirement = &Retirement{Reason: reason, RetiredAt: at.UTC()}
+	}
+	s.state = state
+	return nil
+}
+
+// GetDeletedAt returns when the device has been deleted, or nil if it is not deleted.
+func (s *SignatureDevice) GetDeletedAt() *time.Time {
+	return s.deletedAt
+}
+
+func (s *SignatureDevice) IsDeleted() bool {
+	return s.deletedAt != nil
+}
+
+// MarkDeleted soft deletes the device: it keeps its public keys and signatures, but does
+// not sign nor change anymore. Devices already deleted keep their deletion time.
+func (s *SignatureDevice) MarkDeleted(at time.Time) {
+	if s.deletedAt != nil {
+		return
+	}
+	deletedAt := at.UTC()
+	s.deletedAt = &deletedAt
+	s.touch(at)
+}
+
+// deviceDeleted returns a DeviceDeletedError for deleted devices, nil otherwise.
+func (s *SignatureDevice) deviceDeleted() error {
+	if s.deletedAt == nil {
+		return nil
+	}
+	return DeviceDeletedError(fmt.Sprintf("device %s has been deleted", s.Id))
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"maps"
+	"time"
+)
+
+// DeviceMetadata is the operator metadata a signature device is created with: the owner,
+// or tenant, the device belongs to and its tags.
+type DeviceMetadata struct {
+	Owner string
+	Tags  map[string]string
+}
+
+// GetCreatedAt returns when the device has been created. Devices stored before creation
+// times were recorded have a zero creation time.
+func (s *SignatureDevice) GetCreatedAt() time.Time {
+	return s.createdAt
+}
+
+// GetUpdatedAt returns when the device has last changed, signatures included.
+func (s *SignatureDevice) GetUpdatedAt() time.Time {
+	return s.updatedAt
+}
+
+// GetLastSignedAt returns when the device has last signed, or nil if it has not signed
+// anything yet.
+func (s *SignatureDevice) GetLastSignedAt() *time.Time {
+	return s.lastSignedAt
+}
+
+func (s *SignatureDevice) setMetadata(metadata DeviceMetadata) {
+	s.Owner = metadata.Owner
+	s.Tags = maps.Clone(metadata.Tags)
+}
+
+// touch records at as the time the device has last changed.
+func (s *SignatureDevice) touch(at time.Time) {
+	s.updatedAt = at.UTC()
+}
+
+// signedAt records at as the time the device has last signed.
+func (s *SignatureDevice) signedAt(at time.Time) {
+	lastSignedAt := at.UTC()
+	s.lastSignedAt = &lastSignedAt
+	s.touch(at)
+}
@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeviceSortField is the field the devices listed by a DeviceQuery are sorted by.
+type DeviceSortField string
+
+const (
+	SortByCreatedAt DeviceSortField = "created_at"
+	SortByCounter   DeviceSortField = "counter"
+)
+
+// DeviceQuery selects the devices listed by SignatureDeviceStore.Query: the devices which
+// are not deleted and match every filter set, sorted by SortBy (creation time by default)
+// with ties broken by ID, in pages of at most Limit devices. Devices hold every one of
+// Tags. Cursor is the NextCursor of the previous page, empty for the first page.
+type DeviceQuery struct {
+	KeyType     KeyGenAlgorithm
+	LabelPrefix string
+	State       DeviceState
+	Tags        map[string]string
+	SortBy      DeviceSortField
+	Descending  bool
+	Limit       int
+	Cursor      string
+}
+
+// DevicePage is a page of the devices selected by a DeviceQuery. NextCursor is empty on
+// the last page.
+type DevicePage struct {
+	Devices    []*SignatureDevice
+	NextCursor string
+}
+
+// DeviceQueryNotValidError is returned for queries with an unknown sort field or a cursor
+// which has not been returned by a query with the same sort.
+type DeviceQueryNotValidError string
+
+func (e DeviceQueryNotValidError) Error() string {
+	return string(e)
+}
+
+// DeviceCursor is the position of a page in the devices selected by a query: the sort key
+// and ID of the last device of the previous page, along with the sort of the query, so
+// that cursors are not reused with a different sort. Clients only see cursors encoded.
+type DeviceCursor struct {
+	SortBy     DeviceSortField `json:"s"`
+	Descending bool            `json:"d,omitempty"`
+	CreatedAt  time.Time       `json:"t"`
+	Counter    int             `json:"c,omitempty"`
+	Id         string          `json:"i"`
+}
+
+// Sort returns the field the devices are sorted by, validating it.
+func (q DeviceQuery) Sort() (DeviceSortField, error) {
+	switch q.SortBy {
+	case "":
+		return SortByCreatedAt, nil
+	case SortByCreatedAt, SortByCounter:
+		return q.SortBy, nil
+	}
+	return "", DeviceQueryNotValidError("devices cannot be sorted by " + string(q.SortBy))
+}
+
+// DecodeCursor returns the position the query starts after, or nil for the first page.
+func (q DeviceQuery) DecodeCursor() (*DeviceCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	sortBy, err := q.Sort()
+	if err != nil {
+		return nil, err
+	}
+	document, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, DeviceQueryNotValidError("cursor not valid")
+	}
+	var cursor DeviceCursor
+	if err := json.Unmarshal(document, &cursor); err != nil || cursor.Id == "" {
+		return nil, DeviceQueryNotValidError("cursor not valid")
+	}
+	if cursor.SortBy != sortBy || cursor.Descending != q.Descending {
+		return nil, DeviceQueryNotValidError("cursor has been returned by a query with a different sort")
+	}
+	return &cursor, nil
+}
+
+// NextCursor returns the cursor of the page following the given last device of a page.
+func (q DeviceQuery) NextCursor(last *SignatureDevice) string {
+	sortBy, _ := q.Sort()
+	document, _ := json.Marshal(DeviceCursor{
+		SortBy:     sortBy,
+		Descending: q.Descending,
+		CreatedAt:  last.GetCreatedAt(),
+		Counter:    last.GetSignatureCounter(),
+		Id:         last.Id,
+	})
+	return base64.RawURLEncoding.EncodeToString(document)
+}
+
+// Matches reports whether the device is not deleted and matches the query filters.
+func (q DeviceQuery) Matches(device *SignatureDevice) bool {
+	if device.IsDeleted() {
+		return false
+	}
+	if q.KeyType != "" && device.KeyType != q.KeyType {
+		return false
+	}
+	if q.State != "" && device.GetState() != q.State {
+		return false
+	}
+	if !strings.HasPrefix(device.Label, q.LabelPrefix) {
+		return false
+	}
+	for key, value := range q.Tags {
+		if deviceValue, found := device.Tags[key]; !found || deviceValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply runs the query on devices, for stores which hold their devices in memory.
+func (q DeviceQuery) Apply(devices []*SignatureDevice) (*DevicePage, error) {
+	sortBy, err := q.Sort()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := q.DecodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []*SignatureDevice{}
+	for _, device := range devices {
+		if !q.Matches(device) {
+			continue
+		}
+		if cursor != nil && q.compare(sortBy, cursorOf(device), *cursor) <= 0 {
+			continue
+		}
+		selected = append(selected, device)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return q.compare(sortBy, cursorOf(selected[i]), cursorOf(selected[j])) < 0
+	})
+
+	page := &DevicePage{Devices: selected}
+	if q.Limit > 0 && len(selected) > q.Limit {
+		page.Devices = selected[:q.Limit]
+		page.NextCursor = q.NextCursor(page.Devices[q.Limit-1])
+	}
+	return page, nil
+}
+
+func cursorOf(device *SignatureDevice) DeviceCursor {
+	return DeviceCursor{CreatedAt: device.GetCreatedAt(), Counter: device.GetSignatureCounter(), Id: device.Id}
+}
+
+// compare orders the positions a and b by sortBy and ID, in the direction of the query.
+func (q DeviceQuery) compare(sortBy DeviceSortField, a DeviceCursor, b DeviceCursor) int {
+	result := 0
+	switch {
+	case sortBy == SortByCounter && a.Counter != b.Counter:
+		result = a.Counter - b.Counter
+	case sortBy == SortByCreatedAt && !a.CreatedAt.Equal(b.CreatedAt):
+		result = a.CreatedAt.Compare(b.CreatedAt)
+	default:
+		result = strings.Compare(a.Id, b.Id)
+	}
+	if q.Descending {
+		return -result
+	}
+	return result
+}
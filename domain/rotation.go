@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
+)
+
+// KeyVersion is a key a signature device has signed with: the key with version 1 is the
+// key the device has been created with, every rotation adds a version. ActiveFromCounter
+// is the counter of the first signature produced with the key.
+type KeyVersion struct {
+	Version           int    `json:"version"`
+	PublicKey         []byte `json:"public_key"`
+	ActiveFromCounter int    `json:"active_from_counter"`
+}
+
+type KeyVersionNotFoundError string
+
+func (e KeyVersionNotFoundError) Error() string {
+	return string(e)
+}
+
+// GetKeyVersion returns the version of the current key of the device.
+func (s *SignatureDevice) GetKeyVersion() int {
+	return len(s.previousKeys) + 1
+}
+
+// GetKeyVersions returns every key of the device, by version, the current key last.
+func (s *SignatureDevice) GetKeyVersions() []KeyVersion {
+	return append(append([]KeyVersion{}, s.previousKeys...), s.currentKeyVersion())
+}
+
+func (s *SignatureDevice) currentKeyVersion() KeyVersion {
+	return KeyVersion{Version: s.GetKeyVersion(), PublicKey: s.PublicKey, ActiveFromCounter: s.keyActiveFromCounter}
+}
+
+// FindKeyVersion returns the key of the device with the given version, or a
+// KeyVersionNotFoundError.
+func (s *SignatureDevice) FindKeyVersion(version int) (KeyVersion, error) {
+	versions := s.GetKeyVersions()
+	if version < 1 || version > len(versions) {
+		return KeyVersion{}, KeyVersionNotFoundError(fmt.Sprintf("key version %d of device %s not found", version, s.Id))
+	}
+	return versions[version-1], nil
+}
+
+// KeyVersionAt returns the key the signature with the given counter has been, or is to be,
+// produced with.
+func (s *SignatureDevice) KeyVersionAt(counter int) KeyVersion {
+	versions := s.GetKeyVersions()
+	for i := len(versions) - 1; i > 0; i-- {
+		if versions[i].ActiveFromCounter <= counter {
+			return versions[i]
+		}
+	}
+	return versions[0]
+}
+
+// RotateKey makes the given key the current key of the device, from the next signature
+// on. The previous public key is kept to verify the signatures it produced; the signature
+// chain is not affected, so that the first signature of the new key chains from the last
+// signature of the previous one.
+func (s *SignatureDevice) RotateKey(publicKey []byte, keyHandle crypto.KeyHandle) {
+	// the previous keys are copied, as devices are updated on shallow copies
+	s.previousKeys = append(append([]KeyVersion{}, s.previousKeys...), s.currentKeyVersion())
+	s.PublicKey = publicKey
+	s.KeyHandle = keyHandle
+	s.keyActiveFromCounter = s.signatureCounter
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"time"
+)
+
+// SignatureRecord is an entry of a device signature ledger: it keeps every signature
+// produced by a device, so that the whole signature chain can be reconstructed and audited.
+type SignatureRecord struct {
+	DeviceId   string    `json:"device_id"`
+	Counter    int       `json:"counter"`
+	DataHash   string    `json:"data_hash"`
+	SignedData string    `json:"signed_data"`
+	Signature  []byte    `json:"signature"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// SignatureRecordStore persists the signature ledger of the signature devices. The
+// ledger is append-only: Append adds the record following the last one of the device,
+// returning a SignatureRecordConflictError if a record with the same counter exists, so
+// that a committed signature is never overwritten. FindByDeviceId returns the records
+// with counter in [fromCounter, toCounter), ordered by counter; a negative toCounter
+// leaves the range unbounded.
+type SignatureRecordStore interface {
+	Append(*SignatureRecord) error
+	FindByDeviceId(deviceId string, fromCounter int, toCounter int) ([]*SignatureRecord, error)
+}
+
+// SignatureCommitter is implemented by the stores holding both the signature devices and
+// their ledger. CommitSignature appends the signature record and updates the device it
+// advances as one write, returning the errors of Append and Update, so that a crash never
+// leaves a record in the ledger which the device has not advanced past.
+type SignatureCommitter interface {
+	CommitSignature(device *SignatureDevice, record *SignatureRecord) error
+}
+
+type SignatureRecordGapError string
+
+func (e SignatureRecordGapError) Error() string {
+	return string(e)
+}
+
+// SignatureRecordConflictError is returned when appending a signature record with the
+// counter of a record already in the ledger, e.g. by a concurrent signer of the device.
+type SignatureRecordConflictError string
+
+func (e SignatureRecordConflictError) Error() string {
+	return string(e)
+}
+
+// ChainBreak describes the first broken link found while auditing a signature chain.
+type ChainBreak struct {
+	Counter int
+	Reason  string
+}
+
+// AuditReport is the outcome of a signature chain audit.
+type AuditReport struct {
+	DeviceId           string
+	VerifiedSignatures int
+	BrokenLink         *ChainBreak
+}
+
+// Valid reports whether the audited chain is unbroken.
+func (r *AuditReport) Valid() bool {
+	return r.BrokenLink == nil
+}
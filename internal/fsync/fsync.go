@@ -0,0 +1,34 @@
+// Package fsync holds the durable file writes shared by the stores keeping their state
+// on disk.
+package fsync
+
+import "os"
+
+// WriteFile writes data to the file at path, creating or truncating it, and fsyncs it
+// before closing it.
+func WriteFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Directory fsyncs the directory at path, so that the files created, renamed or removed
+// in it are durable.
+func Directory(path string) error {
+	directory, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer directory.Close()
+	return directory.Sync()
+}
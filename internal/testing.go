@@ -2,16 +2,26 @@ package test_utils
 
 import (
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
 	"github.com/PaoloModica/signing-service-challenge-go/domain"
 )
 
+// StubSignatureDeviceStore is a map backed SignatureDeviceStore. Devices seeded directly
+// in Store are listed by FindAll after the ones added through Create, in creation order.
 type StubSignatureDeviceStore struct {
+	lock  sync.RWMutex
 	Store map[string]*domain.SignatureDevice
+	order []string
 }
 
 func (s *StubSignatureDeviceStore) FindById(id string) (*domain.SignatureDevice, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	d, found := s.Store[id]
 	if !found {
 		return nil, domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", id))
@@ -20,27 +30,107 @@ func (s *StubSignatureDeviceStore) FindById(id string) (*domain.SignatureDevice,
 }
 
 func (s *StubSignatureDeviceStore) FindAll() ([]*domain.SignatureDevice, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	devices := []*domain.SignatureDevice{}
-	for _, v := range s.Store {
-		devices = append(devices, v)
+	created := map[string]bool{}
+	for _, id := range s.order {
+		if !s.Store[id].IsDeleted() {
+			devices = append(devices, s.Store[id])
+		}
+		created[id] = true
+	}
+	for id, d := range s.Store {
+		if !created[id] && !d.IsDeleted() {
+			devices = append(devices, d)
+		}
 	}
 	return devices, nil
 }
 
+// Query runs the query on the devices listed by FindAll.
+func (s *StubSignatureDeviceStore) Query(query domain.DeviceQuery) (*domain.DevicePage, error) {
+	devices, err := s.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(devices)
+}
+
 func (s *StubSignatureDeviceStore) Create(d *domain.SignatureDevice) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.Store[d.Id]; !found {
+		s.order = append(s.order, d.Id)
+	}
 	s.Store[d.Id] = d
 	return d.Id, nil
 }
 
 func (s *StubSignatureDeviceStore) Update(d *domain.SignatureDevice) error {
-	d, err := s.FindById(d.Id)
-	if err != nil {
-		return nil
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.Store[d.Id]; !found {
+		return domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", d.Id))
 	}
 	s.Store[d.Id] = d
 	return nil
 }
 
+func (s *StubSignatureDeviceStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	d, found := s.Store[id]
+	if !found {
+		return domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", id))
+	}
+	deletedDevice := *d
+	deletedDevice.MarkDeleted(time.Now())
+	s.Store[id] = &deletedDevice
+	return nil
+}
+
+type StubSignatureRecordStore struct {
+	lock    sync.RWMutex
+	Records map[string][]*domain.SignatureRecord
+}
+
+func (s *StubSignatureRecordStore) Append(r *domain.SignatureRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	records := s.Records[r.DeviceId]
+	if r.Counter < 0 || r.Counter > len(records) {
+		return domain.SignatureRecordGapError(fmt.Sprintf("signature %d of device %s does not follow signature %d", r.Counter, r.DeviceId, len(records)-1))
+	}
+	if r.Counter < len(records) {
+		return domain.SignatureRecordConflictError(fmt.Sprintf("signature %d of device %s already recorded", r.Counter, r.DeviceId))
+	}
+	s.Records[r.DeviceId] = append(records, r)
+	return nil
+}
+
+func (s *StubSignatureRecordStore) FindByDeviceId(deviceId string, fromCounter int, toCounter int) ([]*domain.SignatureRecord, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	records := s.Records[deviceId]
+	if toCounter < 0 || toCounter > len(records) {
+		toCounter = len(records)
+	}
+	if fromCounter < 0 {
+		fromCounter = 0
+	}
+	if fromCounter >= toCounter {
+		return []*domain.SignatureRecord{}, nil
+	}
+	return records[fromCounter:toCounter], nil
+}
+
 func AssertErrorNotNil(t *testing.T, message string, err error) {
 	t.Helper()
 
@@ -64,3 +154,29 @@ func AssertSignatureDeviceStoreLen(t *testing.T, exp int, got int) {
 		t.Errorf("expected %d devices in store, got %d", exp, got)
 	}
 }
+
+// NewStubKeyring returns a keyring holding a single random master key.
+func NewStubKeyring(t testing.TB) *crypto.Keyring {
+	t.Helper()
+
+	masterKey, err := crypto.GenerateMasterKey("stubMasterKey")
+	if err != nil {
+		t.Fatalf("an error occurred during master key generation, error: %s", err.Error())
+	}
+	keyring, err := crypto.NewKeyring(masterKey)
+	if err != nil {
+		t.Fatalf("an error occurred during keyring creation, error: %s", err.Error())
+	}
+	return keyring
+}
+
+// NewStubKeyStore returns an in-memory software key store sealing keys with a stub keyring.
+func NewStubKeyStore(t testing.TB) *crypto.SoftwareKeyStore {
+	t.Helper()
+
+	keyStore, err := crypto.NewSoftwareKeyStore(NewStubKeyring(t), "")
+	if err != nil {
+		t.Fatalf("an error occurred during key store creation, error: %s", err.Error())
+	}
+	return keyStore
+}
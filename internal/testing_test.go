@@ -0,0 +1,21 @@
+package test_utils_test
+
+import (
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+	test_utils "github.com/PaoloModica/signing-service-challenge-go/internal"
+	"github.com/PaoloModica/signing-service-challenge-go/persistence/storetest"
+)
+
+func TestStubSignatureDeviceStore(t *testing.T) {
+	storetest.TestSignatureDeviceStore(t, func() domain.SignatureDeviceStore {
+		return &test_utils.StubSignatureDeviceStore{Store: map[string]*domain.SignatureDevice{}}
+	})
+}
+
+func TestStubSignatureRecordStore(t *testing.T) {
+	storetest.TestSignatureRecordStore(t, func() domain.SignatureRecordStore {
+		return &test_utils.StubSignatureRecordStore{Records: map[string][]*domain.SignatureRecord{}}
+	})
+}
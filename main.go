@@ -1,9 +1,15 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/PaoloModica/signing-service-challenge-go/api"
+	"github.com/PaoloModica/signing-service-challenge-go/cli"
+	"github.com/PaoloModica/signing-service-challenge-go/crypto"
 	"github.com/PaoloModica/signing-service-challenge-go/domain"
 	"github.com/PaoloModica/signing-service-challenge-go/persistence"
 )
@@ -13,18 +19,51 @@ const (
 	// TODO: add further configuration parameters here ...
 )
 
+// MasterKeysEnvironmentVariable holds the master keys, when no master key file is given.
+const MasterKeysEnvironmentVariable = "SIGNATURE_SERVICE_MASTER_KEYS"
+
+const (
+	InMemoryStore = "memory"
+	FileStore     = "file"
+	SQLiteStore   = "sqlite"
+)
+
 func main() {
-	signatureDeviceInMemoryStore, err := persistence.NewInMemorySignatureDeviceStore()
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := cli.RunAudit(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+
+	store := flag.String("store", InMemoryStore, fmt.Sprintf("signature device store, one of %q, %q, %q", InMemoryStore, FileStore, SQLiteStore))
+	dataDirectory := flag.String("data-dir", "data", "directory holding the file store write-ahead log and snapshots, or the SQLite database")
+	snapshotInterval := flag.Int("snapshot-interval", persistence.DefaultSnapshotInterval, "number of file store changes between two snapshots")
+	masterKeyFile := flag.String("master-key-file", "", fmt.Sprintf("file holding the master keys sealing device private keys, one <id>:<base64 key> per line, current key first (default $%s)", MasterKeysEnvironmentVariable))
+	flag.Parse()
+
+	keyring, err := loadKeyring(*masterKeyFile, *store)
+	if err != nil {
+		log.Fatalf("an error occurred while loading master keys: %s", err.Error())
+		return
+	}
+
+	signatureDeviceStore, signatureRecordStore, err := newStores(*store, *dataDirectory, *snapshotInterval)
 	if err != nil {
 		log.Fatalf("an error occurred while setting signature device store: %s", err.Error())
 		return
 	}
-	signatureDeviceRepository, err := domain.NewSignatureDeviceRepository(signatureDeviceInMemoryStore)
+	signatureDeviceRepository, err := domain.NewSignatureDeviceRepository(signatureDeviceStore)
 	if err != nil {
 		log.Fatalf("an error occurred while setting signature device repository: %s", err.Error())
 		return
 	}
-	signatureDeviceService, err := domain.NewSignatureDeviceService(signatureDeviceRepository)
+	keyStore, err := newKeyStore(keyring, *store, *dataDirectory)
+	if err != nil {
+		log.Fatalf("an error occurred while setting key store: %s", err.Error())
+		return
+	}
+	signatureDeviceService, err := domain.NewSignatureDeviceService(signatureDeviceRepository, signatureRecordStore, keyStore)
 	if err != nil {
 		log.Fatalf("an error occurred while setting signature device service: %s", err.Error())
 		return
@@ -37,3 +76,84 @@ func main() {
 		log.Fatal("Could not start server on ", ListenAddress)
 	}
 }
+
+// loadKeyring reads the master keys from masterKeyFile or, if not given, from the
+// environment. Without master keys, the in-memory store falls back to an ephemeral
+// master key, as its devices do not outlive the process anyway.
+func loadKeyring(masterKeyFile string, store string) (*crypto.Keyring, error) {
+	if masterKeyFile != "" {
+		masterKeys, err := os.ReadFile(masterKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.ParseKeyring(masterKeys)
+	}
+	if masterKeys, found := os.LookupEnv(MasterKeysEnvironmentVariable); found {
+		return crypto.ParseKeyring([]byte(masterKeys))
+	}
+	if store != InMemoryStore {
+		return nil, fmt.Errorf("the %s store requires master keys, set -master-key-file or $%s", store, MasterKeysEnvironmentVariable)
+	}
+	log.Printf("no master key given, device private keys are sealed with an ephemeral master key")
+	masterKey, err := crypto.GenerateMasterKey("ephemeral")
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewKeyring(masterKey)
+}
+
+// newKeyStore instantiates the software key store, persisting keys under the data
+// directory unless devices are kept in memory, and completes any master key rotation
+// by re-wrapping the stored keys with the current master key.
+func newKeyStore(keyring *crypto.Keyring, store string, dataDirectory string) (*crypto.SoftwareKeyStore, error) {
+	keyDirectory := ""
+	if store != InMemoryStore {
+		keyDirectory = filepath.Join(dataDirectory, "keys")
+	}
+	keyStore, err := crypto.NewSoftwareKeyStore(keyring, keyDirectory)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped, err := keyStore.RewrapKeys()
+	if err != nil {
+		return nil, err
+	}
+	if rewrapped > 0 {
+		log.Printf("%d device private keys re-wrapped with master key %s", rewrapped, keyring.CurrentMasterKeyId())
+	}
+	return keyStore, nil
+}
+
+// newStores instantiates the signature device and signature record stores of the given kind.
+func newStores(store string, dataDirectory string, snapshotInterval int) (domain.SignatureDeviceStore, domain.SignatureRecordStore, error) {
+	switch store {
+	case InMemoryStore:
+		signatureDeviceStore, err := persistence.NewInMemorySignatureDeviceStore()
+		if err != nil {
+			return nil, nil, err
+		}
+		signatureRecordStore, err := persistence.NewInMemorySignatureRecordStore()
+		if err != nil {
+			return nil, nil, err
+		}
+		return signatureDeviceStore, signatureRecordStore, nil
+	case FileStore:
+		fileStore, err := persistence.NewFileSignatureDeviceStore(dataDirectory, snapshotInterval)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("signature devices recovered from %s", dataDirectory)
+		return fileStore, fileStore, nil
+	case SQLiteStore:
+		if err := os.MkdirAll(dataDirectory, 0o700); err != nil {
+			return nil, nil, err
+		}
+		sqliteStore, err := persistence.NewSQLiteSignatureDeviceStore(filepath.Join(dataDirectory, "signature-service.db"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return sqliteStore, sqliteStore, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown store %q", store)
+	}
+}
@@ -0,0 +1,417 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+	"github.com/PaoloModica/signing-service-challenge-go/internal/fsync"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	DefaultSnapshotInterval = 1000
+)
+
+type walEntryType string
+
+const (
+	deviceCreated   walEntryType = "device_created"
+	deviceUpdated   walEntryType = "device_updated"
+	deviceDeleted   walEntryType = "device_deleted"
+	signatureStored walEntryType = "signature_stored"
+	// deviceSigned entries hold a signature along with the device it advances
+	deviceSigned walEntryType = "device_signed"
+)
+
+// walEntry is a single change appended to the write-ahead log.
+type walEntry struct {
+	Type      walEntryType            `json:"type"`
+	Device    *domain.SignatureDevice `json:"device,omitempty"`
+	Signature *domain.SignatureRecord `json:"signature,omitempty"`
+}
+
+// fileStoreSnapshot is the whole store state, as written in the snapshot file.
+type fileStoreSnapshot struct {
+	Devices    []*domain.SignatureDevice `json:"devices"`
+	Signatures []*domain.SignatureRecord `json:"signatures"`
+}
+
+// FileSignatureDeviceStore is a durable SignatureDeviceStore and SignatureRecordStore backed
+// by a local directory. Every change is appended to a write-ahead log and fsynced before
+// being applied, and the log is compacted into a snapshot every snapshotInterval changes.
+// At startup the state is recovered from the last snapshot and the log entries following it.
+// Signatures are logged along with the device they advance, in a single entry.
+// The whole state is also kept in memory to serve reads, devices in creation order. It is safe for concurrent use.
+type FileSignatureDeviceStore struct {
+	lock             sync.RWMutex
+	directory        string
+	snapshotInterval int
+	wal              *os.File
+	walLength        int64
+	walEntries       int
+	devices          map[string]*domain.SignatureDevice
+	deviceOrder      []string
+	signatures       map[string][]*domain.SignatureRecord
+}
+
+func NewFileSignatureDeviceStore(directory string, snapshotInterval int) (*FileSignatureDeviceStore, error) {
+	if snapshotInterval < 1 {
+		return nil, fmt.Errorf("snapshot interval must be positive, got %d", snapshotInterval)
+	}
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, err
+	}
+	s := &FileSignatureDeviceStore{
+		directory:        directory,
+		snapshotInterval: snapshotInterval,
+		devices:          map[string]*domain.SignatureDevice{},
+		signatures:       map[string][]*domain.SignatureRecord{},
+	}
+
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// recover loads the last snapshot and replays the write-ahead log on top of it. An incomplete
+// entry at the end of the log, left by a crash during a write, is discarded.
+func (s *FileSignatureDeviceStore) recover() error {
+	snapshotBytes, err := os.ReadFile(filepath.Join(s.directory, snapshotFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var snapshot fileStoreSnapshot
+		if err := json.Unmarshal(snapshotBytes, &snapshot); err != nil {
+			return fmt.Errorf("snapshot is corrupted: %w", err)
+		}
+		for _, device := range snapshot.Devices {
+			s.apply(walEntry{Type: deviceCreated, Device: device})
+		}
+		for _, signature := range snapshot.Signatures {
+			if err := s.apply(walEntry{Type: signatureStored, Signature: signature}); err != nil {
+				return fmt.Errorf("snapshot is corrupted: %w", err)
+			}
+		}
+	}
+
+	wal, err := os.OpenFile(filepath.Join(s.directory, walFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	s.wal = wal
+
+	validLength := int64(0)
+	reader := bufio.NewReader(wal)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Printf("discarding incomplete write-ahead log entry at offset %d", validLength)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var entry walEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return fmt.Errorf("write-ahead log is corrupted at offset %d: %w", validLength, err)
+		}
+		if err := s.apply(entry); err != nil {
+			return fmt.Errorf("write-ahead log is corrupted at offset %d: %w", validLength, err)
+		}
+		validLength += int64(len(line))
+		s.walEntries++
+	}
+
+	if err := s.truncateWAL(validLength); err != nil {
+		return err
+	}
+	if err := wal.Sync(); err != nil {
+		return err
+	}
+	if s.dropUnadvancedSignatures() {
+		return s.snapshot()
+	}
+	return nil
+}
+
+// dropUnadvancedSignatures drops the signatures which the device has not advanced past,
+// reporting whether any has been dropped. Such signatures are left by the crash of a
+// store which logged a signature and the device advance as two entries: the device cannot
+// sign again while they are in the ledger, and they have never been returned to a client.
+func (s *FileSignatureDeviceStore) dropUnadvancedSignatures() bool {
+	dropped := false
+	for id, device := range s.devices {
+		records := s.signatures[id]
+		if counter := device.GetSignatureCounter(); counter < len(records) {
+			log.Printf("dropping %d signatures of device %s not advanced past", len(records)-counter, id)
+			s.signatures[id] = records[:counter]
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// truncateWAL cuts the write-ahead log at length, positioning the next write there.
+func (s *FileSignatureDeviceStore) truncateWAL(length int64) error {
+	if err := s.wal.Truncate(length); err != nil {
+		return err
+	}
+	if _, err := s.wal.Seek(length, io.SeekStart); err != nil {
+		return err
+	}
+	s.walLength = length
+	return nil
+}
+
+// apply updates the in-memory state with a write-ahead log entry.
+func (s *FileSignatureDeviceStore) apply(entry walEntry) error {
+	switch entry.Type {
+	case deviceSigned:
+		if entry.Device == nil || entry.Signature == nil {
+			return fmt.Errorf("%s entry without device or signature", entry.Type)
+		}
+		if err := s.apply(walEntry{Type: signatureStored, Signature: entry.Signature}); err != nil {
+			return err
+		}
+		return s.apply(walEntry{Type: deviceUpdated, Device: entry.Device})
+	case deviceCreated, deviceUpdated, deviceDeleted:
+		if entry.Device == nil {
+			return fmt.Errorf("%s entry without device", entry.Type)
+		}
+		if _, found := s.devices[entry.Device.Id]; !found {
+			s.deviceOrder = append(s.deviceOrder, entry.Device.Id)
+		}
+		s.devices[entry.Device.Id] = copyDevice(entry.Device)
+		return nil
+	case signatureStored:
+		if entry.Signature == nil {
+			return fmt.Errorf("%s entry without signature", entry.Type)
+		}
+		records := s.signatures[entry.Signature.DeviceId]
+		switch counter := entry.Signature.Counter; {
+		case counter < 0 || counter > len(records):
+			return domain.SignatureRecordGapError(fmt.Sprintf("signature %d of device %s does not follow signature %d", counter, entry.Signature.DeviceId, len(records)-1))
+		case counter < len(records):
+			// entries already in the snapshot are replayed after a crash during compaction
+			if !bytes.Equal(records[counter].Signature, entry.Signature.Signature) {
+				return domain.SignatureRecordConflictError(fmt.Sprintf("signature %d of device %s already recorded", counter, entry.Signature.DeviceId))
+			}
+		default:
+			s.signatures[entry.Signature.DeviceId] = append(records, entry.Signature)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown entry type %s", entry.Type)
+	}
+}
+
+// write appends an entry to the write-ahead log and fsyncs it, then applies it to the
+// in-memory state. A failed write is cut from the log, so that it is never recovered.
+// The log is compacted into a snapshot once the interval is reached.
+func (s *FileSignatureDeviceStore) write(entry walEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	entryBytes = append(entryBytes, '\n')
+	if _, err := s.wal.Write(entryBytes); err != nil {
+		s.truncateWAL(s.walLength)
+		return err
+	}
+	if err := s.wal.Sync(); err != nil {
+		s.truncateWAL(s.walLength)
+		return err
+	}
+	s.walLength += int64(len(entryBytes))
+	if err := s.apply(entry); err != nil {
+		return err
+	}
+
+	s.walEntries++
+	if s.walEntries >= s.snapshotInterval {
+		// the entry is already durable: a failed snapshot is retried on the next write
+		if err := s.snapshot(); err != nil {
+			log.Printf("an error occurred while writing store snapshot: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// snapshot writes the whole state to the snapshot file, replacing the previous one
+// atomically, and then empties the write-ahead log.
+func (s *FileSignatureDeviceStore) snapshot() error {
+	snapshot := fileStoreSnapshot{Devices: []*domain.SignatureDevice{}, Signatures: []*domain.SignatureRecord{}}
+	for _, id := range s.deviceOrder {
+		snapshot.Devices = append(snapshot.Devices, s.devices[id])
+		snapshot.Signatures = append(snapshot.Signatures, s.signatures[id]...)
+	}
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	temporaryPath := filepath.Join(s.directory, snapshotFileName+".tmp")
+	if err := fsync.WriteFile(temporaryPath, snapshotBytes); err != nil {
+		return err
+	}
+	if err := os.Rename(temporaryPath, filepath.Join(s.directory, snapshotFileName)); err != nil {
+		return err
+	}
+	if err := fsync.Directory(s.directory); err != nil {
+		return err
+	}
+
+	// entries already in the snapshot are replayed idempotently if a crash happens here
+	if err := s.truncateWAL(0); err != nil {
+		return err
+	}
+	s.walEntries = 0
+	return s.wal.Sync()
+}
+
+func (s *FileSignatureDeviceStore) FindById(id string) (*domain.SignatureDevice, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	device, found := s.devices[id]
+	if !found {
+		return nil, domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", id))
+	}
+	return copyDevice(device), nil
+}
+
+func (s *FileSignatureDeviceStore) FindAll() ([]*domain.SignatureDevice, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	devices := []*domain.SignatureDevice{}
+	for _, id := range s.deviceOrder {
+		if !s.devices[id].IsDeleted() {
+			devices = append(devices, copyDevice(s.devices[id]))
+		}
+	}
+	return devices, nil
+}
+
+// copyDevice copies a device, so that the devices held by the store are only changed
+// through the write-ahead log. The device methods replace, rather than change, the
+// slices of the device: only its tags are copied along.
+func copyDevice(d *domain.SignatureDevice) *domain.SignatureDevice {
+	device := *d
+	device.Tags = maps.Clone(d.Tags)
+	return &device
+}
+
+// Query runs the query on the devices listed by FindAll.
+func (s *FileSignatureDeviceStore) Query(query domain.DeviceQuery) (*domain.DevicePage, error) {
+	devices, err := s.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(devices)
+}
+
+func (s *FileSignatureDeviceStore) Create(d *domain.SignatureDevice) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.write(walEntry{Type: deviceCreated, Device: d}); err != nil {
+		return "", err
+	}
+	return d.Id, nil
+}
+
+func (s *FileSignatureDeviceStore) Update(d *domain.SignatureDevice) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.devices[d.Id]; !found {
+		return domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", d.Id))
+	}
+	return s.write(walEntry{Type: deviceUpdated, Device: d})
+}
+
+// Delete logs the device marked deleted, which is kept with its signatures.
+func (s *FileSignatureDeviceStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	device, found := s.devices[id]
+	if !found {
+		return domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", id))
+	}
+	if device.IsDeleted() {
+		return nil
+	}
+	deletedDevice := *device
+	deletedDevice.MarkDeleted(time.Now())
+	return s.write(walEntry{Type: deviceDeleted, Device: &deletedDevice})
+}
+
+func (s *FileSignatureDeviceStore) Append(r *domain.SignatureRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkAppend(r); err != nil {
+		return err
+	}
+	return s.write(walEntry{Type: signatureStored, Signature: r})
+}
+
+// CommitSignature logs the signature record and the device it advances as a single entry.
+func (s *FileSignatureDeviceStore) CommitSignature(d *domain.SignatureDevice, r *domain.SignatureRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.devices[d.Id]; !found {
+		return domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", d.Id))
+	}
+	if err := s.checkAppend(r); err != nil {
+		return err
+	}
+	return s.write(walEntry{Type: deviceSigned, Device: d, Signature: r})
+}
+
+// checkAppend checks that the record follows the last one of the device ledger.
+func (s *FileSignatureDeviceStore) checkAppend(r *domain.SignatureRecord) error {
+	records := s.signatures[r.DeviceId]
+	switch {
+	case r.Counter < 0 || r.Counter > len(records):
+		return domain.SignatureRecordGapError(fmt.Sprintf("signature %d of device %s does not follow signature %d", r.Counter, r.DeviceId, len(records)-1))
+	case r.Counter < len(records):
+		return domain.SignatureRecordConflictError(fmt.Sprintf("signature %d of device %s already recorded", r.Counter, r.DeviceId))
+	}
+	return nil
+}
+
+func (s *FileSignatureDeviceStore) FindByDeviceId(deviceId string, fromCounter int, toCounter int) ([]*domain.SignatureRecord, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return signatureRecordsRange(s.signatures[deviceId], fromCounter, toCounter), nil
+}
+
+// Close releases the write-ahead log file.
+func (s *FileSignatureDeviceStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.wal.Close()
+}
@@ -0,0 +1,205 @@
+package persistence_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+	test_utils "github.com/PaoloModica/signing-service-challenge-go/internal"
+	"github.com/PaoloModica/signing-service-challenge-go/persistence"
+	"github.com/PaoloModica/signing-service-challenge-go/persistence/storetest"
+)
+
+func TestFileSignatureDeviceStoreConformance(t *testing.T) {
+	storetest.TestSignatureDeviceStore(t, func() domain.SignatureDeviceStore {
+		return newFileStore(t, persistence.DefaultSnapshotInterval)
+	})
+	storetest.TestSignatureDeviceStore(t, func() domain.SignatureDeviceStore {
+		return newFileStore(t, 2)
+	})
+	storetest.TestSignatureRecordStore(t, func() domain.SignatureRecordStore {
+		return newFileStore(t, 2)
+	})
+	storetest.TestSignatureCommitter(t, func(t *testing.T, directory string) storetest.SignatureStore {
+		store, err := persistence.NewFileSignatureDeviceStore(directory, 2)
+		if err != nil {
+			panic(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestFileSignatureDeviceStore(t *testing.T) {
+	t.Run("create FileSignatureDeviceStore", func(t *testing.T) {
+		store, err := persistence.NewFileSignatureDeviceStore(t.TempDir(), persistence.DefaultSnapshotInterval)
+		test_utils.AssertErrorNotNil(t, "FileSignatureDeviceStore creation", err)
+		defer store.Close()
+
+		devices, err := store.FindAll()
+		test_utils.AssertErrorNotNil(t, "devices retrieval", err)
+		test_utils.AssertSignatureDeviceStoreLen(t, 0, len(devices))
+	})
+	t.Run("create FileSignatureDeviceStore with invalid snapshot interval", func(t *testing.T) {
+		if _, err := persistence.NewFileSignatureDeviceStore(t.TempDir(), 0); err == nil {
+			t.Errorf("expected snapshot interval error")
+		}
+	})
+	t.Run("recover devices and signatures after restart", func(t *testing.T) {
+		for _, snapshotInterval := range []int{persistence.DefaultSnapshotInterval, 2} {
+			directory := t.TempDir()
+			store, _ := persistence.NewFileSignatureDeviceStore(directory, snapshotInterval)
+			device := storeSignedDevice(t, store, 3)
+			store.Close()
+
+			recoveredStore, err := persistence.NewFileSignatureDeviceStore(directory, snapshotInterval)
+			test_utils.AssertErrorNotNil(t, "FileSignatureDeviceStore recovery", err)
+			defer recoveredStore.Close()
+
+			assertRecoveredDevice(t, recoveredStore, device, 3)
+		}
+	})
+	t.Run("compact write-ahead log into snapshot", func(t *testing.T) {
+		directory := t.TempDir()
+		// device creation and two signatures make five changes
+		store, _ := persistence.NewFileSignatureDeviceStore(directory, 5)
+		storeSignedDevice(t, store, 2)
+		defer store.Close()
+
+		if _, err := os.Stat(filepath.Join(directory, "snapshot.json")); err != nil {
+			t.Errorf("expected snapshot to have been written, error: %s", err.Error())
+		}
+		walInfo, _ := os.Stat(filepath.Join(directory, "wal.log"))
+		if walInfo.Size() != 0 {
+			t.Errorf("expected write-ahead log to be empty after snapshot, found %d bytes", walInfo.Size())
+		}
+	})
+	t.Run("discard incomplete write-ahead log entry", func(t *testing.T) {
+		directory := t.TempDir()
+		store, _ := persistence.NewFileSignatureDeviceStore(directory, persistence.DefaultSnapshotInterval)
+		device := storeSignedDevice(t, store, 2)
+		store.Close()
+
+		wal, _ := os.OpenFile(filepath.Join(directory, "wal.log"), os.O_WRONLY|os.O_APPEND, 0o600)
+		wal.Write([]byte(`{"type":"signature_stored","signature":{"device_id":`))
+		wal.Close()
+
+		recoveredStore, err := persistence.NewFileSignatureDeviceStore(directory, persistence.DefaultSnapshotInterval)
+		test_utils.AssertErrorNotNil(t, "FileSignatureDeviceStore recovery", err)
+		assertRecoveredDevice(t, recoveredStore, device, 2)
+
+		// writes following the recovery must not be appended to the discarded entry
+		recoveredDevice, _ := recoveredStore.FindById(device.Id)
+		recoveredDevice.SetLastSignature([]byte("signature2"))
+		recoveredStore.Append(&domain.SignatureRecord{DeviceId: device.Id, Counter: 2, Signature: []byte("signature2")})
+		recoveredStore.Update(recoveredDevice)
+		recoveredStore.Close()
+
+		reopenedStore, err := persistence.NewFileSignatureDeviceStore(directory, persistence.DefaultSnapshotInterval)
+		test_utils.AssertErrorNotNil(t, "FileSignatureDeviceStore recovery", err)
+		defer reopenedStore.Close()
+		assertRecoveredDevice(t, reopenedStore, device, 3)
+	})
+	t.Run("log signatures along with the device they advance", func(t *testing.T) {
+		directory := t.TempDir()
+		store, _ := persistence.NewFileSignatureDeviceStore(directory, persistence.DefaultSnapshotInterval)
+		defer store.Close()
+		repository, _ := domain.NewSignatureDeviceRepository(store)
+		service, _ := domain.NewSignatureDeviceService(repository, store, test_utils.NewStubKeyStore(t))
+		deviceId, _ := service.Create("signedDevice", domain.Ed25519, domain.DeviceMetadata{})
+
+		_, err := service.SignTransaction(deviceId, []byte("transaction"))
+		test_utils.AssertErrorNotNil(t, "transaction signing", err)
+
+		walBytes, _ := os.ReadFile(filepath.Join(directory, "wal.log"))
+		entries := strings.Split(strings.TrimSpace(string(walBytes)), "\n")
+		if len(entries) != 2 || !strings.HasPrefix(entries[1], `{"type":"device_signed"`) {
+			t.Errorf("expected the signature to be logged in a single entry, got %v", entries)
+		}
+	})
+	t.Run("refuse corrupted write-ahead log", func(t *testing.T) {
+		directory := t.TempDir()
+		os.WriteFile(filepath.Join(directory, "wal.log"), []byte("corrupted\n"), 0o600)
+
+		if _, err := persistence.NewFileSignatureDeviceStore(directory, persistence.DefaultSnapshotInterval); err == nil {
+			t.Errorf("expected corrupted write-ahead log error")
+		}
+	})
+	t.Run("devices are only changed through the store", func(t *testing.T) {
+		store := newFileStore(t, 100)
+		device, _ := domain.NewSignatureDevice("testDevice", []byte("publicKey"), "keyHandle", domain.ECC)
+		device.Tags = map[string]string{"site": "berlin"}
+		store.Create(device)
+		device.SetLastSignature([]byte("unstoredSignature"))
+		device.Tags["site"] = "munich"
+
+		storedDevice, _ := store.FindById(device.Id)
+		storedDevice.Label = "renamedDevice"
+		devices, _ := store.FindAll()
+		devices[0].Tags["floor"] = "1"
+
+		storedDevice, _ = store.FindById(device.Id)
+		if storedDevice.GetSignatureCounter() != 0 || storedDevice.Label != "testDevice" || !reflect.DeepEqual(storedDevice.Tags, map[string]string{"site": "berlin"}) {
+			t.Errorf("expected stored device not to be changed outside of the store, got counter %d, label %q, tags %v", storedDevice.GetSignatureCounter(), storedDevice.Label, storedDevice.Tags)
+		}
+	})
+	t.Run("update signature device counter, unknown device", func(t *testing.T) {
+		store, _ := persistence.NewFileSignatureDeviceStore(t.TempDir(), persistence.DefaultSnapshotInterval)
+		defer store.Close()
+		deviceNotInStore, _ := domain.NewSignatureDevice("newDevice", []byte("publicKey"), "keyHandle", domain.ECC)
+
+		if err := store.Update(deviceNotInStore); err == nil {
+			t.Errorf("expected device not to be found")
+		}
+	})
+}
+
+// storeSignedDevice creates a device in the store and records signaturesCount signatures for it.
+func storeSignedDevice(t *testing.T, store *persistence.FileSignatureDeviceStore, signaturesCount int) *domain.SignatureDevice {
+	t.Helper()
+
+	device, _ := domain.NewSignatureDevice("testDevice", []byte("publicKey"), "keyHandle", domain.ECC)
+	_, err := store.Create(device)
+	test_utils.AssertErrorNotNil(t, "device creation", err)
+	for counter := 0; counter < signaturesCount; counter++ {
+		signature := []byte{byte(counter)}
+		err := store.Append(&domain.SignatureRecord{DeviceId: device.Id, Counter: counter, Signature: signature})
+		test_utils.AssertErrorNotNil(t, "signature record append", err)
+		device.SetLastSignature(signature)
+		err = store.Update(device)
+		test_utils.AssertErrorNotNil(t, "device update", err)
+	}
+	return device
+}
+
+func assertRecoveredDevice(t *testing.T, store *persistence.FileSignatureDeviceStore, device *domain.SignatureDevice, signaturesCount int) {
+	t.Helper()
+
+	recoveredDevice, err := store.FindById(device.Id)
+	if err != nil {
+		t.Fatalf("expected device %s to be recovered, error: %s", device.Id, err.Error())
+	}
+	if recoveredDevice.Label != device.Label || recoveredDevice.KeyHandle != device.KeyHandle {
+		t.Errorf("expected recovered device to match stored device")
+	}
+	if recoveredDevice.GetSignatureCounter() != signaturesCount {
+		t.Errorf("expected recovered device signature counter to be %d, got %d", signaturesCount, recoveredDevice.GetSignatureCounter())
+	}
+	records, _ := store.FindByDeviceId(device.Id, 0, -1)
+	if len(records) != signaturesCount {
+		t.Errorf("expected %d recovered signature records, got %d", signaturesCount, len(records))
+	}
+}
+
+// newFileStore opens a file store in a temporary directory, closed at the end of the test.
+func newFileStore(t *testing.T, snapshotInterval int) *persistence.FileSignatureDeviceStore {
+	store, err := persistence.NewFileSignatureDeviceStore(t.TempDir(), snapshotInterval)
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
@@ -3,19 +3,28 @@ package persistence
 import (
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/PaoloModica/signing-service-challenge-go/domain"
 )
 
+// InMemorySignatureDeviceStore keeps signature devices in a map, along with their creation
+// order, and is safe for concurrent use. Deleted devices stay in the map, flagged as deleted.
 type InMemorySignatureDeviceStore struct {
+	lock  sync.RWMutex
 	store map[string]*domain.SignatureDevice
+	order []string
 }
 
 func NewInMemorySignatureDeviceStore() (*InMemorySignatureDeviceStore, error) {
-	return &InMemorySignatureDeviceStore{map[string]*domain.SignatureDevice{}}, nil
+	return &InMemorySignatureDeviceStore{store: map[string]*domain.SignatureDevice{}}, nil
 }
 
 func (s *InMemorySignatureDeviceStore) FindById(id string) (*domain.SignatureDevice, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	device, found := s.store[id]
 
 	if !found {
@@ -25,20 +34,43 @@ func (s *InMemorySignatureDeviceStore) FindById(id string) (*domain.SignatureDev
 }
 
 func (s *InMemorySignatureDeviceStore) FindAll() ([]*domain.SignatureDevice, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	devices := []*domain.SignatureDevice{}
-	for _, v := range s.store {
-		devices = append(devices, v)
+	for _, id := range s.order {
+		if !s.store[id].IsDeleted() {
+			devices = append(devices, s.store[id])
+		}
 	}
 	return devices, nil
 }
 
+// Query runs the query on the devices listed by FindAll.
+func (s *InMemorySignatureDeviceStore) Query(query domain.DeviceQuery) (*domain.DevicePage, error) {
+	devices, err := s.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(devices)
+}
+
 func (s *InMemorySignatureDeviceStore) Create(d *domain.SignatureDevice) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.store[d.Id]; !found {
+		s.order = append(s.order, d.Id)
+	}
 	s.store[d.Id] = d
 	log.Printf("device %s stored successfully", d.Label)
 	return d.Id, nil
 }
 
 func (s *InMemorySignatureDeviceStore) Update(d *domain.SignatureDevice) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
 	_, found := s.store[d.Id]
 
 	if !found {
@@ -49,3 +81,69 @@ func (s *InMemorySignatureDeviceStore) Update(d *domain.SignatureDevice) error {
 	log.Printf("device %s updated successfully", d.Label)
 	return nil
 }
+
+// Delete marks the device deleted, on a copy, so that devices already returned are not changed.
+func (s *InMemorySignatureDeviceStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	device, found := s.store[id]
+	if !found {
+		return domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", id))
+	}
+
+	deletedDevice := *device
+	deletedDevice.MarkDeleted(time.Now())
+	s.store[id] = &deletedDevice
+	log.Printf("device %s deleted successfully", device.Label)
+	return nil
+}
+
+// InMemorySignatureRecordStore keeps the signature ledger of every device in memory,
+// as a slice indexed by signature counter. It is safe for concurrent use.
+type InMemorySignatureRecordStore struct {
+	lock    sync.RWMutex
+	records map[string][]*domain.SignatureRecord
+}
+
+func NewInMemorySignatureRecordStore() (*InMemorySignatureRecordStore, error) {
+	return &InMemorySignatureRecordStore{records: map[string][]*domain.SignatureRecord{}}, nil
+}
+
+func (s *InMemorySignatureRecordStore) Append(r *domain.SignatureRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	records := s.records[r.DeviceId]
+	switch {
+	case r.Counter < 0 || r.Counter > len(records):
+		return domain.SignatureRecordGapError(fmt.Sprintf("signature %d of device %s does not follow signature %d", r.Counter, r.DeviceId, len(records)-1))
+	case r.Counter < len(records):
+		return domain.SignatureRecordConflictError(fmt.Sprintf("signature %d of device %s already recorded", r.Counter, r.DeviceId))
+	default:
+		s.records[r.DeviceId] = append(records, r)
+	}
+	return nil
+}
+
+func (s *InMemorySignatureRecordStore) FindByDeviceId(deviceId string, fromCounter int, toCounter int) ([]*domain.SignatureRecord, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return signatureRecordsRange(s.records[deviceId], fromCounter, toCounter), nil
+}
+
+// signatureRecordsRange copies the records with counter in [fromCounter, toCounter) out of
+// a device ledger indexed by counter; a negative toCounter leaves the range unbounded.
+func signatureRecordsRange(records []*domain.SignatureRecord, fromCounter int, toCounter int) []*domain.SignatureRecord {
+	if toCounter < 0 || toCounter > len(records) {
+		toCounter = len(records)
+	}
+	if fromCounter < 0 {
+		fromCounter = 0
+	}
+	if fromCounter >= toCounter {
+		return []*domain.SignatureRecord{}
+	}
+	return append([]*domain.SignatureRecord{}, records[fromCounter:toCounter]...)
+}
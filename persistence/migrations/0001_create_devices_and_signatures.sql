@@ -0,0 +1,20 @@
+-- Signature devices: queryable columns plus the full device document.
+CREATE TABLE devices (
+    id                TEXT PRIMARY KEY,
+    label             TEXT NOT NULL,
+    key_type          TEXT NOT NULL,
+    signature_counter INTEGER NOT NULL DEFAULT 0,
+    last_signature    BLOB,
+    document          TEXT NOT NULL
+);
+
+-- Signature ledger, one row per signature produced by a device.
+CREATE TABLE signatures (
+    device_id   TEXT NOT NULL,
+    counter     INTEGER NOT NULL,
+    data_hash   TEXT NOT NULL,
+    signed_data TEXT NOT NULL,
+    signature   BLOB NOT NULL,
+    created_at  TEXT NOT NULL,
+    PRIMARY KEY (device_id, counter)
+);
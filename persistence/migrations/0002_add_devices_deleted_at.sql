@@ -0,0 +1,2 @@
+-- Soft deleted devices keep their row, flagged by their deletion time.
+ALTER TABLE devices ADD COLUMN deleted_at TEXT;
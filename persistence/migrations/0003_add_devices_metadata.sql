@@ -0,0 +1,5 @@
+-- Device owner and timestamps; devices stored before have no creation time.
+ALTER TABLE devices ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN created_at TEXT;
+ALTER TABLE devices ADD COLUMN updated_at TEXT;
+ALTER TABLE devices ADD COLUMN last_signed_at TEXT;
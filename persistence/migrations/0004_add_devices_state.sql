@@ -0,0 +1,5 @@
+-- Device lifecycle state, queryable along with the sort keys of device listings.
+ALTER TABLE devices ADD COLUMN state TEXT NOT NULL DEFAULT 'ACTIVE';
+UPDATE devices SET state = json_extract(document, '$.state') WHERE json_extract(document, '$.state') IS NOT NULL;
+CREATE INDEX devices_created_at ON devices (COALESCE(created_at, ''), id);
+CREATE INDEX devices_signature_counter ON devices (signature_counter, id);
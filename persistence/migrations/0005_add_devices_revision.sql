@@ -0,0 +1,3 @@
+-- Revision of the device row, bumped by every write: updates and deletions only apply to the
+-- revision they have read, so that stale writers cannot undo concurrent changes.
+ALTER TABLE devices ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
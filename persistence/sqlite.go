@@ -0,0 +1,482 @@
+package persistence
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLiteSignatureDeviceStore is a SignatureDeviceStore and SignatureRecordStore backed by an
+// embedded SQLite database, with a devices and a signatures table. Device writes use
+// optimistic concurrency on the revision column, rejecting stale writes, and signatures are
+// committed along with the device they advance in a single transaction.
+type SQLiteSignatureDeviceStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteSignatureDeviceStore opens (or creates) the SQLite database at the given path
+// and brings its schema to the latest migration.
+func NewSQLiteSignatureDeviceStore(databasePath string) (*SQLiteSignatureDeviceStore, error) {
+	// immediate transactions take the write lock on begin: a transaction reading before
+	// writing, as Append, would otherwise fail as busy when another process writes
+	db, err := sql.Open("sqlite", databasePath+"?_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	// a single connection serializes writers and keeps ":memory:" databases shared
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA synchronous = FULL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("an error occurred while migrating database schema: %w", err)
+	}
+	if err := dropUnadvancedSignatures(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteSignatureDeviceStore{db: db}, nil
+}
+
+// dropUnadvancedSignatures deletes the signatures which their device has not advanced past.
+// Such signatures are left by a crash between the two transactions a signature used to be
+// stored with: the device cannot sign again while they are in the ledger, and they have
+// never been returned to a client.
+func dropUnadvancedSignatures(db *sql.DB) error {
+	result, err := db.Exec(`DELETE FROM signatures
+		WHERE counter >= (SELECT signature_counter FROM devices WHERE devices.id = signatures.device_id)`)
+	if err != nil {
+		return err
+	}
+	if dropped, err := result.RowsAffected(); err == nil && dropped > 0 {
+		log.Printf("dropped %d signatures not advanced past by their device", dropped)
+	}
+	return nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx, for reads inside and outside transactions.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// migrate applies, in version order, the embedded migrations not yet recorded in the
+// schema_migrations table. Migration files are named <version>_<description>.sql.
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	var currentVersion int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&currentVersion); err != nil {
+		return err
+	}
+
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		encodedVersion, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(encodedVersion)
+		if err != nil {
+			return fmt.Errorf("migration %s is not prefixed by its version", entry.Name())
+		}
+		if version <= currentVersion {
+			continue
+		}
+		statements, err := migrations.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(statements)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s failed: %w", entry.Name(), err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteSignatureDeviceStore) FindById(id string) (*domain.SignatureDevice, error) {
+	return findDevice(s.db, id)
+}
+
+func findDevice(q queryer, id string) (*domain.SignatureDevice, error) {
+	var document []byte
+	var revision int
+	err := q.QueryRow("SELECT document, revision FROM devices WHERE id = ?", id).Scan(&document, &revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.DeviceNotFoundError(fmt.Sprintf("device with ID %s not found", id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var device domain.SignatureDevice
+	if err := json.Unmarshal(document, &device); err != nil {
+		return nil, err
+	}
+	device.SetRevision(revision)
+	return &device, nil
+}
+
+func (s *SQLiteSignatureDeviceStore) FindAll() ([]*domain.SignatureDevice, error) {
+	rows, err := s.db.Query("SELECT document, revision FROM devices WHERE deleted_at IS NULL ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	return scanDevices(rows)
+}
+
+// scanDevices decodes the device documents and revisions of rows, closing them.
+func scanDevices(rows *sql.Rows) ([]*domain.SignatureDevice, error) {
+	defer rows.Close()
+
+	devices := []*domain.SignatureDevice{}
+	for rows.Next() {
+		var document []byte
+		var revision int
+		if err := rows.Scan(&document, &revision); err != nil {
+			return nil, err
+		}
+		var device domain.SignatureDevice
+		if err := json.Unmarshal(document, &device); err != nil {
+			return nil, err
+		}
+		device.SetRevision(revision)
+		devices = append(devices, &device)
+	}
+	return devices, rows.Err()
+}
+
+// deviceSortColumns are the columns devices are sorted by, by query sort field.
+var deviceSortColumns = map[domain.DeviceSortField]string{
+	domain.SortByCreatedAt: "COALESCE(created_at, '')",
+	domain.SortByCounter:   "signature_counter",
+}
+
+// Query selects the devices with a single statement, paging with the sort key and ID of
+// the cursor rather than an offset, so that pages are stable under concurrent inserts.
+func (s *SQLiteSignatureDeviceStore) Query(query domain.DeviceQuery) (*domain.DevicePage, error) {
+	sortBy, err := query.Sort()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := query.DecodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	if query.KeyType != "" {
+		conditions = append(conditions, "key_type = ?")
+		args = append(args, string(query.KeyType))
+	}
+	if query.LabelPrefix != "" {
+		// substr rather than LIKE, which is case insensitive and interprets % and _
+		conditions = append(conditions, "substr(label, 1, length(?)) = ?")
+		args = append(args, query.LabelPrefix, query.LabelPrefix)
+	}
+	if query.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, string(query.State))
+	}
+	for key, value := range query.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(document, '$.tags') WHERE json_each.key = ? AND json_each.value = ?)")
+		args = append(args, key, value)
+	}
+
+	sortColumn, direction, comparison := deviceSortColumns[sortBy], "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if cursor != nil {
+		var sortKey interface{} = cursor.Counter
+		if sortBy == domain.SortByCreatedAt {
+			sortKey = ""
+			if !cursor.CreatedAt.IsZero() {
+				sortKey = cursor.CreatedAt.UTC().Format(timestampLayout)
+			}
+		}
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortColumn, comparison))
+		args = append(args, sortKey, sortKey, cursor.Id)
+	}
+
+	statement := fmt.Sprintf("SELECT document, revision FROM devices WHERE %s ORDER BY %s %s, id %s",
+		strings.Join(conditions, " AND "), sortColumn, direction, direction)
+	if query.Limit > 0 {
+		// one more device than the page tells whether a next page exists
+		statement += " LIMIT ?"
+		args = append(args, query.Limit+1)
+	}
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.DevicePage{Devices: devices}
+	if query.Limit > 0 && len(page.Devices) > query.Limit {
+		page.Devices = page.Devices[:query.Limit]
+		page.NextCursor = query.NextCursor(page.Devices[query.Limit-1])
+	}
+	return page, nil
+}
+
+func (s *SQLiteSignatureDeviceStore) Create(d *domain.SignatureDevice) (string, error) {
+	document, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	lastSignature, _ := d.GetLastSignature()
+	_, err = s.db.Exec(
+		`INSERT INTO devices (id, label, key_type, signature_counter, last_signature, document, owner, created_at, updated_at, last_signed_at, state)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.Id, d.Label, string(d.KeyType), d.GetSignatureCounter(), nullIfEmpty(lastSignature), document,
+		d.Owner, formatTimestamp(d.GetCreatedAt()), formatTimestamp(d.GetUpdatedAt()), formatOptionalTimestamp(d.GetLastSignedAt()), string(d.GetState()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return d.Id, nil
+}
+
+// Update stores the device only if it is not stale: the stored revision must be the one
+// the device has been read at, so that a writer never undoes a concurrent change. Deleted
+// devices are not updated, so that they cannot be restored by a stale write.
+func (s *SQLiteSignatureDeviceStore) Update(d *domain.SignatureDevice) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateDevice(tx, d); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.SetRevision(d.GetRevision() + 1)
+	return nil
+}
+
+func updateDevice(tx *sql.Tx, d *domain.SignatureDevice) error {
+	document, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	lastSignature, _ := d.GetLastSignature()
+
+	result, err := tx.Exec(`UPDATE devices
+		SET label = ?, key_type = ?, signature_counter = ?, last_signature = ?, document = ?, owner = ?, updated_at = ?, last_signed_at = ?, state = ?, revision = revision + 1
+		WHERE id = ? AND deleted_at IS NULL AND revision = ?`,
+		d.Label, string(d.KeyType), d.GetSignatureCounter(), nullIfEmpty(lastSignature), document,
+		d.Owner, formatTimestamp(d.GetUpdatedAt()), formatOptionalTimestamp(d.GetLastSignedAt()), string(d.GetState()),
+		d.Id, d.GetRevision(),
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		storedDevice, err := findDevice(tx, d.Id)
+		if err != nil {
+			return err
+		}
+		if storedDevice.IsDeleted() {
+			return domain.DeviceDeletedError(fmt.Sprintf("device with ID %s has been deleted", d.Id))
+		}
+		return domain.StaleDeviceUpdateError(fmt.Sprintf("device with ID %s has been concurrently updated", d.Id))
+	}
+	return nil
+}
+
+// Delete stores the device marked deleted, along with its deletion time in the deleted_at
+// column. As updates, it is rejected if the device has been concurrently changed.
+func (s *SQLiteSignatureDeviceStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	device, err := findDevice(tx, id)
+	if err != nil {
+		return err
+	}
+	if device.IsDeleted() {
+		return nil
+	}
+	device.MarkDeleted(time.Now())
+	document, err := json.Marshal(device)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE devices SET deleted_at = ?, document = ?, updated_at = ?, revision = revision + 1
+		WHERE id = ? AND deleted_at IS NULL AND revision = ?`,
+		device.GetDeletedAt().Format(time.RFC3339Nano), document, formatTimestamp(device.GetUpdatedAt()),
+		id, device.GetRevision(),
+	)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return domain.StaleDeviceUpdateError(fmt.Sprintf("device with ID %s has been concurrently updated", id))
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteSignatureDeviceStore) Append(r *domain.SignatureRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := appendRecord(tx, r); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CommitSignature appends the signature record and updates the device it advances in a
+// single transaction, rolled back if the record conflicts or the device is stale.
+func (s *SQLiteSignatureDeviceStore) CommitSignature(d *domain.SignatureDevice, r *domain.SignatureRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := appendRecord(tx, r); err != nil {
+		return err
+	}
+	if err := updateDevice(tx, d); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.SetRevision(d.GetRevision() + 1)
+	return nil
+}
+
+func appendRecord(tx *sql.Tx, r *domain.SignatureRecord) error {
+	var lastCounter int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(counter), -1) FROM signatures WHERE device_id = ?", r.DeviceId).Scan(&lastCounter); err != nil {
+		return err
+	}
+	switch {
+	case r.Counter < 0 || r.Counter > lastCounter+1:
+		return domain.SignatureRecordGapError(fmt.Sprintf("signature %d of device %s does not follow signature %d", r.Counter, r.DeviceId, lastCounter))
+	case r.Counter <= lastCounter:
+		return domain.SignatureRecordConflictError(fmt.Sprintf("signature %d of device %s already recorded", r.Counter, r.DeviceId))
+	}
+	_, err := tx.Exec(
+		"INSERT INTO signatures (device_id, counter, data_hash, signed_data, signature, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		r.DeviceId, r.Counter, r.DataHash, r.SignedData, r.Signature, r.Timestamp.UTC().Format(time.RFC3339Nano),
+	)
+	return err
+}
+
+func (s *SQLiteSignatureDeviceStore) FindByDeviceId(deviceId string, fromCounter int, toCounter int) ([]*domain.SignatureRecord, error) {
+	rows, err := s.db.Query(`SELECT counter, data_hash, signed_data, signature, created_at FROM signatures
+		WHERE device_id = ? AND counter >= ? AND (? < 0 OR counter < ?)
+		ORDER BY counter`, deviceId, fromCounter, toCounter, toCounter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*domain.SignatureRecord{}
+	for rows.Next() {
+		record := domain.SignatureRecord{DeviceId: deviceId}
+		var createdAt string
+		if err := rows.Scan(&record.Counter, &record.DataHash, &record.SignedData, &record.Signature, &createdAt); err != nil {
+			return nil, err
+		}
+		if record.Timestamp, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+// Close closes the underlying database.
+func (s *SQLiteSignatureDeviceStore) Close() error {
+	return s.db.Close()
+}
+
+// nullIfEmpty maps empty byte slices to nil, so that they are all stored as NULL.
+func nullIfEmpty(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+// timestampLayout is the layout of the device timestamp columns: fixed width and in UTC,
+// so that timestamps sort as strings.
+const timestampLayout = "2006-01-02T15:04:05.000000000Z"
+
+// formatTimestamp formats t for the device timestamp columns, zero times as NULL.
+func formatTimestamp(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(timestampLayout)
+}
+
+func formatOptionalTimestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTimestamp(*t)
+}
@@ -0,0 +1,205 @@
+package persistence_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+	test_utils "github.com/PaoloModica/signing-service-challenge-go/internal"
+	"github.com/PaoloModica/signing-service-challenge-go/persistence"
+	"github.com/PaoloModica/signing-service-challenge-go/persistence/storetest"
+)
+
+func TestSQLiteSignatureDeviceStore(t *testing.T) {
+	storetest.TestSignatureDeviceStore(t, func() domain.SignatureDeviceStore {
+		return newSQLiteStore(t, "devices.db")
+	})
+
+	t.Run("reject stale device updates", func(t *testing.T) {
+		store, _ := persistence.NewSQLiteSignatureDeviceStore(filepath.Join(t.TempDir(), "devices.db"))
+		defer store.Close()
+		device, _ := domain.NewSignatureDevice("testDevice", []byte("publicKey"), "keyHandle", domain.ECC)
+		store.Create(device)
+
+		firstWriter, _ := store.FindById(device.Id)
+		secondWriter, _ := store.FindById(device.Id)
+
+		firstWriter.SetLastSignature([]byte("firstSignature"))
+		err := store.Update(firstWriter)
+		test_utils.AssertErrorNotNil(t, "device update", err)
+
+		secondWriter.SetLastSignature([]byte("secondSignature"))
+		err = store.Update(secondWriter)
+		if _, stale := err.(domain.StaleDeviceUpdateError); !stale {
+			t.Errorf("expected stale device update error, got %v", err)
+		}
+
+		staleLabelWriter, _ := store.FindById(device.Id)
+		firstWriter.SetLastSignature([]byte("thirdSignature"))
+		store.Update(firstWriter)
+		staleLabelWriter.Label = "renamedDevice"
+		err = store.Update(staleLabelWriter)
+		if _, stale := err.(domain.StaleDeviceUpdateError); !stale {
+			t.Errorf("expected stale device update error, got %v", err)
+		}
+
+		storedDevice, _ := store.FindById(device.Id)
+		lastSignature, _ := storedDevice.GetLastSignature()
+		if storedDevice.GetSignatureCounter() != 2 || string(lastSignature) != "thirdSignature" || storedDevice.Label != device.Label {
+			t.Errorf("expected stale updates not to be stored")
+		}
+	})
+	t.Run("stale signers do not overwrite the committed signature", func(t *testing.T) {
+		databasePath := filepath.Join(t.TempDir(), "devices.db")
+		firstStore, _ := persistence.NewSQLiteSignatureDeviceStore(databasePath)
+		defer firstStore.Close()
+		secondStore, _ := persistence.NewSQLiteSignatureDeviceStore(databasePath)
+		defer secondStore.Close()
+		device, _ := domain.NewSignatureDevice("testDevice", []byte("publicKey"), "keyHandle", domain.ECC)
+		firstStore.Create(device)
+
+		firstWriter, _ := firstStore.FindById(device.Id)
+		secondWriter, _ := secondStore.FindById(device.Id)
+		err := firstStore.Append(&domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("firstSignature")})
+		test_utils.AssertErrorNotNil(t, "signature record append", err)
+		err = secondStore.Append(&domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("secondSignature")})
+		if _, conflict := err.(domain.SignatureRecordConflictError); !conflict {
+			t.Errorf("expected signature record conflict error, got %v", err)
+		}
+		firstWriter.SetLastSignature([]byte("firstSignature"))
+		err = firstStore.Update(firstWriter)
+		test_utils.AssertErrorNotNil(t, "device update", err)
+		secondWriter.SetLastSignature([]byte("secondSignature"))
+		if err := secondStore.Update(secondWriter); err == nil {
+			t.Errorf("expected stale device update to be rejected")
+		}
+
+		storedDevice, _ := secondStore.FindById(device.Id)
+		lastSignature, _ := storedDevice.GetLastSignature()
+		records, _ := secondStore.FindByDeviceId(device.Id, 0, -1)
+		if len(records) != 1 || string(records[0].Signature) != "firstSignature" || string(lastSignature) != "firstSignature" {
+			t.Errorf("expected ledger and device to hold the committed signature")
+		}
+	})
+	t.Run("stale signers do not undo concurrent changes", func(t *testing.T) {
+		databasePath := filepath.Join(t.TempDir(), "devices.db")
+		firstStore, _ := persistence.NewSQLiteSignatureDeviceStore(databasePath)
+		defer firstStore.Close()
+		secondStore, _ := persistence.NewSQLiteSignatureDeviceStore(databasePath)
+		defer secondStore.Close()
+		device, _ := domain.NewSignatureDevice("testDevice", []byte("publicKey"), "keyHandle", domain.ECC)
+		firstStore.Create(device)
+
+		signer, _ := firstStore.FindById(device.Id)
+		retiredDevice, _ := secondStore.FindById(device.Id)
+		retiredDevice.Transition(domain.DeviceRetired, "decommissioned", time.Now())
+		err := secondStore.Update(retiredDevice)
+		test_utils.AssertErrorNotNil(t, "device retirement", err)
+
+		signer.SetLastSignature([]byte("staleSignature"))
+		err = firstStore.CommitSignature(signer, &domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("staleSignature")})
+		var staleErr domain.StaleDeviceUpdateError
+		if !errors.As(err, &staleErr) {
+			t.Errorf("expected stale device update error, got %v", err)
+		}
+
+		storedDevice, _ := firstStore.FindById(device.Id)
+		if storedDevice.GetState() != domain.DeviceRetired || storedDevice.GetRetirement() == nil || storedDevice.GetSignatureCounter() != 0 {
+			t.Errorf("expected device to stay retired without signatures, got %s with counter %d", storedDevice.GetState(), storedDevice.GetSignatureCounter())
+		}
+		if records, _ := firstStore.FindByDeviceId(device.Id, 0, -1); len(records) != 0 {
+			t.Errorf("expected the stale signature record to be rolled back, got %d records", len(records))
+		}
+	})
+	t.Run("concurrent signers on one database keep the signature chain intact", func(t *testing.T) {
+		databasePath := filepath.Join(t.TempDir(), "devices.db")
+		keyStore := test_utils.NewStubKeyStore(t)
+		services := []domain.SignatureDeviceService{}
+		for i := 0; i < 2; i++ {
+			store, _ := persistence.NewSQLiteSignatureDeviceStore(databasePath)
+			defer store.Close()
+			repository, _ := domain.NewSignatureDeviceRepository(store)
+			service, _ := domain.NewSignatureDeviceService(repository, store, keyStore)
+			services = append(services, service)
+		}
+		deviceId, _ := services[0].Create("testDevice", domain.Ed25519, domain.DeviceMetadata{})
+
+		var signed atomic.Int32
+		var wg sync.WaitGroup
+		for _, service := range services {
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(service domain.SignatureDeviceService) {
+					defer wg.Done()
+					_, err := service.SignTransaction(deviceId, []byte("data"))
+					var staleErr domain.StaleDeviceUpdateError
+					var conflictErr domain.SignatureRecordConflictError
+					switch {
+					case err == nil:
+						signed.Add(1)
+					case !errors.As(err, &staleErr) && !errors.As(err, &conflictErr):
+						t.Errorf("expected concurrent signing to succeed or be rejected as concurrent, got %v", err)
+					}
+				}(service)
+			}
+		}
+		wg.Wait()
+
+		report, err := services[1].AuditSignatureChain(deviceId)
+		if err != nil || !report.Valid() || signed.Load() == 0 || report.VerifiedSignatures != int(signed.Load()) {
+			t.Errorf("expected %d signatures in an intact chain, got %+v, error: %v", signed.Load(), report, err)
+		}
+	})
+	t.Run("persist devices and signatures across reopening, migrating schema once", func(t *testing.T) {
+		databasePath := filepath.Join(t.TempDir(), "devices.db")
+		store, _ := persistence.NewSQLiteSignatureDeviceStore(databasePath)
+		device, _ := domain.NewSignatureDevice("testDevice", []byte("publicKey"), "keyHandle", domain.RSA)
+		store.Create(device)
+		store.Append(&domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("signature")})
+		device.SetLastSignature([]byte("signature"))
+		store.Update(device)
+		store.Close()
+
+		reopenedStore, err := persistence.NewSQLiteSignatureDeviceStore(databasePath)
+		test_utils.AssertErrorNotNil(t, "SQLite store reopening", err)
+		defer reopenedStore.Close()
+
+		storedDevice, err := reopenedStore.FindById(device.Id)
+		test_utils.AssertErrorNotNil(t, "device retrieval", err)
+		if storedDevice.GetSignatureCounter() != 1 || string(storedDevice.PublicKey) != "publicKey" {
+			t.Errorf("expected device %s to be persisted", device.Id)
+		}
+		records, _ := reopenedStore.FindByDeviceId(device.Id, 0, -1)
+		if len(records) != 1 || string(records[0].Signature) != "signature" {
+			t.Errorf("expected device signature to be persisted")
+		}
+	})
+}
+
+func TestSQLiteSignatureRecordStore(t *testing.T) {
+	storetest.TestSignatureRecordStore(t, func() domain.SignatureRecordStore {
+		return newSQLiteStore(t, "signatures.db")
+	})
+	storetest.TestSignatureCommitter(t, func(t *testing.T, directory string) storetest.SignatureStore {
+		store, err := persistence.NewSQLiteSignatureDeviceStore(filepath.Join(directory, "signatures.db"))
+		if err != nil {
+			panic(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+// newSQLiteStore opens a SQLite store in a temporary directory, closed at the end of the test.
+func newSQLiteStore(t *testing.T, fileName string) *persistence.SQLiteSignatureDeviceStore {
+	store, err := persistence.NewSQLiteSignatureDeviceStore(filepath.Join(t.TempDir(), fileName))
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
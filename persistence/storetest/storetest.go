@@ -0,0 +1,532 @@
+// Package storetest holds the conformance suites that every SignatureDeviceStore and
+// SignatureRecordStore implementation is expected to pass, so that all the backends,
+// test stubs included, honour the same contract.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaoloModica/signing-service-challenge-go/domain"
+	test_utils "github.com/PaoloModica/signing-service-challenge-go/internal"
+)
+
+const concurrentWriters = 20
+
+// TestSignatureDeviceStore runs the conformance suite against the stores returned by
+// newStore. Every subtest asks for a new, empty store.
+func TestSignatureDeviceStore(t *testing.T, newStore func() domain.SignatureDeviceStore) {
+	t.Run("new store is empty", func(t *testing.T) {
+		store := newStore()
+
+		devices, err := store.FindAll()
+		test_utils.AssertErrorNotNil(t, "devices retrieval", err)
+		test_utils.AssertSignatureDeviceStoreLen(t, 0, len(devices))
+	})
+	t.Run("create and find signature device", func(t *testing.T) {
+		store := newStore()
+		device := newDevice(t, "testDevice")
+
+		id, err := store.Create(device)
+		test_utils.AssertSignatureDeviceId(t, id, err)
+		if id != device.Id {
+			t.Errorf("expected created device ID %s, got %s", device.Id, id)
+		}
+
+		storedDevice, err := store.FindById(device.Id)
+		test_utils.AssertErrorNotNil(t, "device retrieval", err)
+		if storedDevice.Id != device.Id || storedDevice.Label != device.Label || storedDevice.KeyType != device.KeyType {
+			t.Errorf("expected device %+v, found %+v", device, storedDevice)
+		}
+		if string(storedDevice.PublicKey) != string(device.PublicKey) || storedDevice.KeyHandle != device.KeyHandle {
+			t.Errorf("expected device %s public key and key handle to be stored", device.Id)
+		}
+		if storedDevice.GetSignatureCounter() != 0 {
+			t.Errorf("expected new device signature counter 0, got %d", storedDevice.GetSignatureCounter())
+		}
+	})
+	t.Run("find unknown signature device", func(t *testing.T) {
+		store := newStore()
+		store.Create(newDevice(t, "testDevice"))
+
+		device, err := store.FindById("unknownDevice")
+		assertDeviceNotFound(t, err)
+		if device != nil {
+			t.Errorf("expected no device, found %s", device.Id)
+		}
+	})
+	t.Run("update unknown signature device", func(t *testing.T) {
+		store := newStore()
+		store.Create(newDevice(t, "testDevice"))
+		deviceNotInStore := newDevice(t, "newDevice")
+
+		err := store.Update(deviceNotInStore)
+		assertDeviceNotFound(t, err)
+
+		_, err = store.FindById(deviceNotInStore.Id)
+		assertDeviceNotFound(t, err)
+		devices, _ := store.FindAll()
+		test_utils.AssertSignatureDeviceStoreLen(t, 1, len(devices))
+	})
+	t.Run("find all signature devices in creation order", func(t *testing.T) {
+		store := newStore()
+		devices := []*domain.SignatureDevice{}
+		for i := 0; i < 10; i++ {
+			device := newDevice(t, fmt.Sprintf("testDevice%d", i))
+			store.Create(device)
+			devices = append(devices, device)
+		}
+		// updates do not move a device in the listing
+		devices[0].SetLastSignature([]byte("signature"))
+		store.Update(devices[0])
+
+		storedDevices, err := store.FindAll()
+		test_utils.AssertErrorNotNil(t, "devices retrieval", err)
+		test_utils.AssertSignatureDeviceStoreLen(t, len(devices), len(storedDevices))
+		for i := range storedDevices {
+			if storedDevices[i].Id != devices[i].Id {
+				t.Fatalf("expected device %s at position %d, found %s", devices[i].Label, i, storedDevices[i].Label)
+			}
+		}
+	})
+	t.Run("persist signature counter and last signature", func(t *testing.T) {
+		store := newStore()
+		device := newDevice(t, "testDevice")
+		store.Create(device)
+
+		for i := 0; i < 3; i++ {
+			currentDevice, _ := store.FindById(device.Id)
+			currentDevice.SetLastSignature([]byte(fmt.Sprintf("signature%d", i)))
+			err := store.Update(currentDevice)
+			test_utils.AssertErrorNotNil(t, "device update", err)
+		}
+
+		storedDevice, _ := store.FindById(device.Id)
+		lastSignature, _ := storedDevice.GetLastSignature()
+		if storedDevice.GetSignatureCounter() != 3 {
+			t.Errorf("expected device signature counter 3, got %d", storedDevice.GetSignatureCounter())
+		}
+		if string(lastSignature) != "signature2" {
+			t.Errorf("expected device last signature %q, got %q", "signature2", lastSignature)
+		}
+	})
+	t.Run("persist lifecycle state", func(t *testing.T) {
+		store := newStore()
+		device := newDevice(t, "testDevice")
+		store.Create(device)
+
+		currentDevice, _ := store.FindById(device.Id)
+		currentDevice.Transition(domain.DeviceRetired, "decommissioned", time.Now())
+		err := store.Update(currentDevice)
+		test_utils.AssertErrorNotNil(t, "device update", err)
+
+		storedDevice, _ := store.FindById(device.Id)
+		if storedDevice.GetState() != domain.DeviceRetired || storedDevice.GetRetirement() == nil || storedDevice.GetRetirement().Reason != "decommissioned" {
+			t.Errorf("expected device to be stored as retired, got %s", storedDevice.GetState())
+		}
+	})
+	t.Run("persist key versions", func(t *testing.T) {
+		store := newStore()
+		device := newDevice(t, "testDevice")
+		store.Create(device)
+
+		currentDevice, _ := store.FindById(device.Id)
+		currentDevice.RotateKey([]byte("rotatedPublicKey"), "rotatedKeyHandle")
+		err := store.Update(currentDevice)
+		test_utils.AssertErrorNotNil(t, "device update", err)
+
+		storedDevice, _ := store.FindById(device.Id)
+		previousKey, err := storedDevice.FindKeyVersion(1)
+		if storedDevice.GetKeyVersion() != 2 || storedDevice.KeyHandle != "rotatedKeyHandle" || err != nil || string(previousKey.PublicKey) != "publicKey" {
+			t.Errorf("expected device to be stored with its key versions, got %+v", storedDevice.GetKeyVersions())
+		}
+	})
+	t.Run("persist device metadata", func(t *testing.T) {
+		store := newStore()
+		device := newDevice(t, "testDevice")
+		device.Owner = "tenant-42"
+		device.Tags = map[string]string{"site": "berlin"}
+		store.Create(device)
+
+		storedDevice, _ := store.FindById(device.Id)
+		if storedDevice.Owner != "tenant-42" || storedDevice.Tags["site"] != "berlin" || storedDevice.KeyType != domain.ECC {
+			t.Errorf("expected device to be stored with its metadata, got owner %q, tags %v", storedDevice.Owner, storedDevice.Tags)
+		}
+		if !storedDevice.GetCreatedAt().Equal(device.GetCreatedAt()) || !storedDevice.GetUpdatedAt().Equal(device.GetUpdatedAt()) {
+			t.Errorf("expected device to be stored with its timestamps, got created at %v, updated at %v", storedDevice.GetCreatedAt(), storedDevice.GetUpdatedAt())
+		}
+	})
+	t.Run("delete signature device", func(t *testing.T) {
+		store := newStore()
+		device := newDevice(t, "testDevice")
+		store.Create(device)
+		store.Create(newDevice(t, "otherDevice"))
+
+		err := store.Delete(device.Id)
+		test_utils.AssertErrorNotNil(t, "device deletion", err)
+		devices, _ := store.FindAll()
+		if len(devices) != 1 || devices[0].Id == device.Id {
+			t.Errorf("expected deleted device not to be listed, got %d devices", len(devices))
+		}
+		storedDevice, err := store.FindById(device.Id)
+		if err != nil || !storedDevice.IsDeleted() || string(storedDevice.PublicKey) != "publicKey" {
+			t.Fatalf("expected deleted device to be found with its public key, error: %v", err)
+		}
+
+		deletedAt := *storedDevice.GetDeletedAt()
+		err = store.Delete(device.Id)
+		test_utils.AssertErrorNotNil(t, "repeated device deletion", err)
+		storedDevice, _ = store.FindById(device.Id)
+		if !storedDevice.GetDeletedAt().Equal(deletedAt) {
+			t.Errorf("expected repeated deletion to keep deletion time %v, got %v", deletedAt, storedDevice.GetDeletedAt())
+		}
+	})
+	t.Run("delete unknown signature device", func(t *testing.T) {
+		store := newStore()
+
+		assertDeviceNotFound(t, store.Delete("unknownId"))
+	})
+	t.Run("query signature devices", func(t *testing.T) {
+		store := newQueriedStore(t, newStore())
+
+		for _, tc := range []struct {
+			description    string
+			query          domain.DeviceQuery
+			expectedLabels []string
+		}{
+			{"by counter", domain.DeviceQuery{SortBy: domain.SortByCounter}, []string{"kiosk-1", "till-2", "till-3", "till-1"}},
+			{"by counter descending", domain.DeviceQuery{SortBy: domain.SortByCounter, Descending: true}, []string{"till-1", "till-3", "till-2", "kiosk-1"}},
+			{"by key type", domain.DeviceQuery{KeyType: domain.ECC, SortBy: domain.SortByCounter}, []string{"kiosk-1", "till-3", "till-1"}},
+			{"by label prefix", domain.DeviceQuery{LabelPrefix: "till-", SortBy: domain.SortByCounter}, []string{"till-2", "till-3", "till-1"}},
+			{"by case sensitive label prefix", domain.DeviceQuery{LabelPrefix: "TILL"}, []string{}},
+			{"by state", domain.DeviceQuery{State: domain.DeviceSuspended}, []string{"till-3"}},
+			{"by tag", domain.DeviceQuery{Tags: map[string]string{"site": "berlin"}, SortBy: domain.SortByCounter}, []string{"till-2", "till-1"}},
+			{"by every tag", domain.DeviceQuery{Tags: map[string]string{"site": "berlin", "floor": "1"}}, []string{"till-2"}},
+		} {
+			t.Run(tc.description, func(t *testing.T) {
+				page, err := store.Query(tc.query)
+				test_utils.AssertErrorNotNil(t, "devices query", err)
+				if labels := deviceLabels(page.Devices); !reflect.DeepEqual(labels, tc.expectedLabels) || page.NextCursor != "" {
+					t.Errorf("expected devices %v in a single page, got %v", tc.expectedLabels, labels)
+				}
+			})
+		}
+	})
+	t.Run("page signature devices with cursors", func(t *testing.T) {
+		store := newQueriedStore(t, newStore())
+
+		for _, tc := range []struct {
+			description string
+			query       domain.DeviceQuery
+		}{
+			{"by creation time", domain.DeviceQuery{Limit: 3}},
+			{"by counter", domain.DeviceQuery{SortBy: domain.SortByCounter, Limit: 1}},
+			{"by counter descending", domain.DeviceQuery{SortBy: domain.SortByCounter, Descending: true, Limit: 2}},
+		} {
+			t.Run(tc.description, func(t *testing.T) {
+				unpagedQuery := tc.query
+				unpagedQuery.Limit = 0
+				allDevices, _ := store.Query(unpagedQuery)
+
+				pagedDevices := []*domain.SignatureDevice{}
+				for pages := 0; pages == 0 || tc.query.Cursor != ""; pages++ {
+					if pages > len(allDevices.Devices) {
+						t.Fatalf("expected paging to end")
+					}
+					page, err := store.Query(tc.query)
+					test_utils.AssertErrorNotNil(t, "devices query", err)
+					if len(page.Devices) > tc.query.Limit {
+						t.Errorf("expected at most %d devices per page, got %d", tc.query.Limit, len(page.Devices))
+					}
+					pagedDevices = append(pagedDevices, page.Devices...)
+					tc.query.Cursor = page.NextCursor
+				}
+				if !reflect.DeepEqual(deviceLabels(pagedDevices), deviceLabels(allDevices.Devices)) || len(pagedDevices) != 4 {
+					t.Errorf("expected pages to hold devices %v, got %v", deviceLabels(allDevices.Devices), deviceLabels(pagedDevices))
+				}
+				for i := 1; i < len(pagedDevices) && tc.query.SortBy == ""; i++ {
+					if pagedDevices[i].GetCreatedAt().Before(pagedDevices[i-1].GetCreatedAt()) {
+						t.Errorf("expected devices to be sorted by creation time, got %v", deviceLabels(pagedDevices))
+					}
+				}
+			})
+		}
+	})
+	t.Run("query signature devices with invalid sort or cursor", func(t *testing.T) {
+		store := newQueriedStore(t, newStore())
+		page, _ := store.Query(domain.DeviceQuery{SortBy: domain.SortByCounter, Limit: 1})
+
+		for _, query := range []domain.DeviceQuery{
+			{SortBy: "label"},
+			{Cursor: "not a cursor"},
+			{Cursor: page.NextCursor},
+			{SortBy: domain.SortByCounter, Descending: true, Cursor: page.NextCursor},
+		} {
+			_, err := store.Query(query)
+			var queryErr domain.DeviceQueryNotValidError
+			if !errors.As(err, &queryErr) {
+				t.Errorf("expected DeviceQueryNotValidError for query %+v, got %v", query, err)
+			}
+		}
+	})
+	t.Run("concurrent creations and updates", func(t *testing.T) {
+		store := newStore()
+		updatedDevices := []*domain.SignatureDevice{}
+		for i := 0; i < concurrentWriters; i++ {
+			device := newDevice(t, fmt.Sprintf("updatedDevice%d", i))
+			store.Create(device)
+			updatedDevices = append(updatedDevices, device)
+		}
+
+		updatesPerDevice := 5
+		var wg sync.WaitGroup
+		errs := make(chan error, concurrentWriters*(updatesPerDevice+1))
+		for i := 0; i < concurrentWriters; i++ {
+			wg.Add(2)
+			go func(label string) {
+				defer wg.Done()
+				device, err := domain.NewSignatureDevice(label, []byte("publicKey"), "keyHandle", domain.ECC)
+				if err == nil {
+					_, err = store.Create(device)
+				}
+				errs <- err
+			}(fmt.Sprintf("createdDevice%d", i))
+			go func(id string) {
+				defer wg.Done()
+				for u := 0; u < updatesPerDevice; u++ {
+					device, err := store.FindById(id)
+					if err == nil {
+						// stores may return the device they hold: it is changed on a copy, as UpdateAtomically does
+						updatedDevice := *device
+						updatedDevice.SetLastSignature([]byte(fmt.Sprintf("signature%d", u)))
+						err = store.Update(&updatedDevice)
+					}
+					errs <- err
+				}
+			}(updatedDevices[i].Id)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			test_utils.AssertErrorNotNil(t, "concurrent store access", err)
+		}
+		devices, _ := store.FindAll()
+		test_utils.AssertSignatureDeviceStoreLen(t, 2*concurrentWriters, len(devices))
+		for _, device := range updatedDevices {
+			storedDevice, _ := store.FindById(device.Id)
+			if storedDevice.GetSignatureCounter() != updatesPerDevice {
+				t.Errorf("expected device %s signature counter %d, got %d", device.Label, updatesPerDevice, storedDevice.GetSignatureCounter())
+			}
+		}
+	})
+}
+
+// TestSignatureRecordStore runs the conformance suite against the store returned by newStore.
+func TestSignatureRecordStore(t *testing.T, newStore func() domain.SignatureRecordStore) {
+	store := newStore()
+
+	deviceId := "device"
+	recordsCount := 5
+	for counter := 0; counter < recordsCount; counter++ {
+		err := store.Append(&domain.SignatureRecord{DeviceId: deviceId, Counter: counter, Signature: []byte(fmt.Sprintf("signature%d", counter))})
+		test_utils.AssertErrorNotNil(t, "signature record append", err)
+	}
+
+	t.Run("find signature records by counter range", func(t *testing.T) {
+		rangeTestCases := []struct {
+			description      string
+			fromCounter      int
+			toCounter        int
+			expectedCounters []int
+		}{
+			{"whole ledger", 0, -1, []int{0, 1, 2, 3, 4}},
+			{"bounded range", 1, 3, []int{1, 2}},
+			{"range past the last record", 3, 10, []int{3, 4}},
+			{"empty range", 5, -1, []int{}},
+		}
+		for _, tc := range rangeTestCases {
+			t.Run(tc.description, func(t *testing.T) {
+				records, err := store.FindByDeviceId(deviceId, tc.fromCounter, tc.toCounter)
+				test_utils.AssertErrorNotNil(t, "signature records retrieval", err)
+				if len(records) != len(tc.expectedCounters) {
+					t.Fatalf("expected %d signature records, got %d", len(tc.expectedCounters), len(records))
+				}
+				for i, record := range records {
+					if record.Counter != tc.expectedCounters[i] {
+						t.Errorf("expected signature record counter %d, got %d", tc.expectedCounters[i], record.Counter)
+					}
+				}
+			})
+		}
+	})
+	t.Run("find signature records of unknown device", func(t *testing.T) {
+		records, err := store.FindByDeviceId("unknownDevice", 0, -1)
+		test_utils.AssertErrorNotNil(t, "signature records retrieval", err)
+		if len(records) != 0 {
+			t.Errorf("expected no signature records, got %d", len(records))
+		}
+	})
+	t.Run("append refuses to replace a record with the same counter", func(t *testing.T) {
+		records, _ := store.FindByDeviceId(deviceId, recordsCount-1, -1)
+		signature := string(records[0].Signature)
+
+		err := store.Append(&domain.SignatureRecord{DeviceId: deviceId, Counter: recordsCount - 1, Signature: []byte("replacement")})
+		var conflictError domain.SignatureRecordConflictError
+		if !errors.As(err, &conflictError) {
+			t.Errorf("expected signature record conflict error, got %v", err)
+		}
+		records, _ = store.FindByDeviceId(deviceId, recordsCount-1, -1)
+		if len(records) != 1 || string(records[0].Signature) != signature {
+			t.Errorf("expected signature record %d to be kept", recordsCount-1)
+		}
+	})
+	t.Run("append refuses gaps in the ledger", func(t *testing.T) {
+		err := store.Append(&domain.SignatureRecord{DeviceId: deviceId, Counter: recordsCount + 1})
+		var gapError domain.SignatureRecordGapError
+		if !errors.As(err, &gapError) {
+			t.Errorf("expected signature record gap error, got %v", err)
+		}
+	})
+}
+
+// SignatureStore is a store holding both the signature devices and their ledger.
+type SignatureStore interface {
+	domain.SignatureDeviceStore
+	domain.SignatureRecordStore
+	domain.SignatureCommitter
+	Close() error
+}
+
+// TestSignatureCommitter runs the conformance suite of the stores holding both the devices
+// and their ledger. openStore opens the store keeping its data in directory, empty when
+// first opened: the suite closes and opens it again there, as after a crash.
+func TestSignatureCommitter(t *testing.T, openStore func(t *testing.T, directory string) SignatureStore) {
+	t.Run("commit a signature along with the device it advances", func(t *testing.T) {
+		directory := t.TempDir()
+		store := openStore(t, directory)
+		device := newDevice(t, "signedDevice")
+		store.Create(device)
+
+		signedDevice := *device
+		signedDevice.SetLastSignature([]byte("signature0"))
+		err := store.CommitSignature(&signedDevice, &domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("signature0")})
+		test_utils.AssertErrorNotNil(t, "signature commit", err)
+
+		store.Close()
+		store = openStore(t, directory)
+		storedDevice, err := store.FindById(device.Id)
+		test_utils.AssertErrorNotNil(t, "device retrieval", err)
+		lastSignature, _ := storedDevice.GetLastSignature()
+		if storedDevice.GetSignatureCounter() != 1 || string(lastSignature) != "signature0" {
+			t.Errorf("expected device advanced to counter 1, got %d", storedDevice.GetSignatureCounter())
+		}
+		records, _ := store.FindByDeviceId(device.Id, 0, -1)
+		if len(records) != 1 || string(records[0].Signature) != "signature0" {
+			t.Errorf("expected signature 0 in the ledger, got %d records", len(records))
+		}
+	})
+	t.Run("commit refuses conflicting signatures without advancing the device", func(t *testing.T) {
+		store := openStore(t, t.TempDir())
+		device := newDevice(t, "conflictingDevice")
+		store.Create(device)
+
+		signedDevice, staleDevice := *device, *device
+		signedDevice.SetLastSignature([]byte("signature0"))
+		store.CommitSignature(&signedDevice, &domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("signature0")})
+		staleDevice.SetLastSignature([]byte("stale"))
+		err := store.CommitSignature(&staleDevice, &domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("stale")})
+
+		var conflictError domain.SignatureRecordConflictError
+		if !errors.As(err, &conflictError) {
+			t.Errorf("expected signature record conflict error, got %v", err)
+		}
+		storedDevice, _ := store.FindById(device.Id)
+		lastSignature, _ := storedDevice.GetLastSignature()
+		if string(lastSignature) != "signature0" {
+			t.Errorf("expected committed signature to be kept, got %s", lastSignature)
+		}
+	})
+	t.Run("recover from a crash between the ledger and the device writes", func(t *testing.T) {
+		directory := t.TempDir()
+		store := openStore(t, directory)
+		device := newDevice(t, "crashedDevice")
+		store.Create(device)
+		// the signature is recorded but the device is not advanced, as by a crash between
+		// the two writes of a signature
+		store.Append(&domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("lost")})
+
+		store.Close()
+		store = openStore(t, directory)
+		records, _ := store.FindByDeviceId(device.Id, 0, -1)
+		if len(records) != 0 {
+			t.Errorf("expected the signature the device has not advanced past to be dropped, got %d records", len(records))
+		}
+		signedDevice, _ := store.FindById(device.Id)
+		signedDevice.SetLastSignature([]byte("signature0"))
+		err := store.CommitSignature(signedDevice, &domain.SignatureRecord{DeviceId: device.Id, Counter: 0, Signature: []byte("signature0")})
+		test_utils.AssertErrorNotNil(t, "signature commit after recovery", err)
+	})
+}
+
+func newDevice(t *testing.T, label string) *domain.SignatureDevice {
+	t.Helper()
+
+	device, err := domain.NewSignatureDevice(label, []byte("publicKey"), "keyHandle", domain.ECC)
+	test_utils.AssertErrorNotNil(t, "device creation", err)
+	return device
+}
+
+// newQueriedStore stores, in store, four devices to be queried, with signature counters
+// 3, 1, 2 and 0, along with a deleted device.
+func newQueriedStore(t *testing.T, store domain.SignatureDeviceStore) domain.SignatureDeviceStore {
+	t.Helper()
+
+	for _, spec := range []struct {
+		label      string
+		keyType    domain.KeyGenAlgorithm
+		state      domain.DeviceState
+		tags       map[string]string
+		signatures int
+	}{
+		{"till-1", domain.ECC, domain.DeviceActive, map[string]string{"site": "berlin"}, 3},
+		{"till-2", domain.Ed25519, domain.DeviceActive, map[string]string{"site": "berlin", "floor": "1"}, 1},
+		{"till-3", domain.ECC, domain.DeviceSuspended, map[string]string{"site": "munich"}, 2},
+		{"kiosk-1", domain.ECC, domain.DeviceActive, nil, 0},
+		{"till-4", domain.ECC, domain.DeviceActive, map[string]string{"site": "berlin"}, 4},
+	} {
+		device, err := domain.NewSignatureDevice(spec.label, []byte("publicKey"), "keyHandle", spec.keyType)
+		test_utils.AssertErrorNotNil(t, "device creation", err)
+		device.Tags = spec.tags
+		device.Transition(spec.state, "", time.Now())
+		for i := 0; i < spec.signatures; i++ {
+			device.SetLastSignature([]byte(fmt.Sprintf("signature%d", i)))
+		}
+		store.Create(device)
+		if spec.label == "till-4" {
+			store.Delete(device.Id)
+		}
+	}
+	return store
+}
+
+func deviceLabels(devices []*domain.SignatureDevice) []string {
+	labels := []string{}
+	for _, device := range devices {
+		labels = append(labels, device.Label)
+	}
+	return labels
+}
+
+func assertDeviceNotFound(t *testing.T, err error) {
+	t.Helper()
+
+	var notFound domain.DeviceNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected device not found error, got %v", err)
+	}
+}